@@ -0,0 +1,401 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/lox/gpt-5-pro-mcp/internal/config"
+	"github.com/lox/gpt-5-pro-mcp/internal/conversation"
+	"github.com/lox/gpt-5-pro-mcp/internal/usage"
+)
+
+// anthropicVersion is the Messages API version requests are made against
+const anthropicVersion = "2023-06-01"
+
+// thinkingBudgets maps reasoning_effort to an extended thinking budget in
+// tokens, which comes on top of the output cap. Minimal and the default
+// leave thinking off.
+var thinkingBudgets = map[string]int64{"low": 2048, "medium": 8192, "high": 12288}
+
+// AnthropicProvider consults Claude models through Anthropic's Messages
+// API. The API is stateless, so each request carries the conversation's
+// full history, kept in the conversation state as JSON.
+type AnthropicProvider struct {
+	config  *config.Config
+	http    *http.Client
+	baseURL string
+}
+
+// NewAnthropicProvider creates a provider for the Anthropic Messages API
+func NewAnthropicProvider(cfg *config.Config) *AnthropicProvider {
+	return &AnthropicProvider{
+		config:  cfg,
+		http:    &http.Client{},
+		baseURL: strings.TrimSuffix(cfg.AnthropicBaseURL, "/"),
+	}
+}
+
+// Name identifies the Messages API in logs and errors
+func (p *AnthropicProvider) Name() string {
+	return "Anthropic Messages API"
+}
+
+// anthropicMessage is one message of a Messages API conversation
+type anthropicMessage struct {
+	Role    string           `json:"role"`
+	Content []anthropicBlock `json:"content"`
+}
+
+// anthropicBlock is a content block; only the fields of its type are set
+type anthropicBlock struct {
+	Type string `json:"type"`
+
+	Text string `json:"text,omitempty"` // text
+
+	ID    string          `json:"id,omitempty"` // tool_use
+	Name  string          `json:"name,omitempty"`
+	Input json.RawMessage `json:"input,omitempty"`
+
+	ToolUseID string `json:"tool_use_id,omitempty"` // tool_result
+	Content   string `json:"content,omitempty"`
+	IsError   bool   `json:"is_error,omitempty"`
+
+	Thinking  string `json:"thinking,omitempty"` // thinking and redacted_thinking
+	Signature string `json:"signature,omitempty"`
+	Data      string `json:"data,omitempty"`
+}
+
+// anthropicTool is a tool definition in a Messages API request
+type anthropicTool struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	InputSchema map[string]any `json:"input_schema"`
+}
+
+// anthropicThinking turns on extended thinking
+type anthropicThinking struct {
+	Type         string `json:"type"`
+	BudgetTokens int64  `json:"budget_tokens"`
+}
+
+// anthropicRequest is the body of a Messages API request
+type anthropicRequest struct {
+	Model     string             `json:"model"`
+	MaxTokens int64              `json:"max_tokens"`
+	System    string             `json:"system,omitempty"`
+	Messages  []anthropicMessage `json:"messages"`
+	Tools     []anthropicTool    `json:"tools,omitempty"`
+	Thinking  *anthropicThinking `json:"thinking,omitempty"`
+	Stream    bool               `json:"stream,omitempty"`
+}
+
+// anthropicResponse is a Messages API response, or the message a stream builds
+type anthropicResponse struct {
+	ID         string           `json:"id"`
+	Content    []anthropicBlock `json:"content"`
+	StopReason string           `json:"stop_reason"`
+	Usage      anthropicUsage   `json:"usage"`
+}
+
+// anthropicUsage are the token counts of a response. Input tokens exclude
+// those read from or written to the prompt cache.
+type anthropicUsage struct {
+	InputTokens              int64 `json:"input_tokens"`
+	OutputTokens             int64 `json:"output_tokens"`
+	CacheCreationInputTokens int64 `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int64 `json:"cache_read_input_tokens"`
+}
+
+// usage converts the token counts to the meter's, where input read from
+// and written to the cache is part of the input
+func (u anthropicUsage) usage() usage.Usage {
+	return usage.Usage{
+		InputTokens:       u.InputTokens + u.CacheCreationInputTokens + u.CacheReadInputTokens,
+		CachedInputTokens: u.CacheReadInputTokens,
+		CacheWriteTokens:  u.CacheCreationInputTokens,
+		OutputTokens:      u.OutputTokens,
+	}
+}
+
+// anthropicError is the body of a failed request and of a stream error event
+type anthropicError struct {
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// anthropicTurn is a turn on the Messages API: the history so far,
+// including this turn's requests and replies
+type anthropicTurn struct {
+	provider *AnthropicProvider
+	system   string
+	messages []anthropicMessage
+	complete bool // the last reply was the answer, not tool calls
+}
+
+// NewTurn starts a turn from the conversation's history
+func (p *AnthropicProvider) NewTurn(state conversation.State, systemPrompt, prompt string) Turn {
+	var messages []anthropicMessage
+	if len(state.History) > 0 {
+		if err := json.Unmarshal(state.History, &messages); err != nil {
+			log.Printf("[Anthropic] WARNING: Discarding unreadable conversation history: %v", err)
+			messages = nil
+		} else {
+			log.Printf("[Anthropic] Continuing conversation: history_len=%d", len(messages))
+		}
+	}
+	messages = append(messages, anthropicMessage{
+		Role:    "user",
+		Content: []anthropicBlock{{Type: "text", Text: prompt}},
+	})
+	return &anthropicTurn{provider: p, system: systemPrompt, messages: messages}
+}
+
+// Send sends the whole history and appends the reply to it
+func (t *anthropicTurn) Send(ctx context.Context, settings callSettings, progress *progressReporter) (*Reply, error) {
+	request := anthropicRequest{
+		Model:     settings.Model,
+		MaxTokens: t.provider.config.MaxOutputTokens,
+		System:    t.system,
+		Messages:  t.messages,
+		Tools:     t.provider.buildTools(),
+		Stream:    t.provider.config.Stream,
+	}
+	if budget, ok := thinkingBudgets[settings.ReasoningEffort]; ok {
+		request.Thinking = &anthropicThinking{Type: "enabled", BudgetTokens: budget}
+		request.MaxTokens += budget
+	}
+
+	log.Printf("[Anthropic] Calling Messages API: model=%s reasoning_effort=%q messages=%d",
+		settings.Model, settings.ReasoningEffort, len(t.messages))
+	response, err := t.provider.createMessage(ctx, request, progress)
+	if err != nil {
+		if response != nil {
+			return &Reply{Usage: response.Usage.usage()}, err
+		}
+		return nil, err
+	}
+	log.Printf("[Anthropic] Received message: id=%s stop_reason=%s blocks=%d", response.ID, response.StopReason, len(response.Content))
+
+	// Empty text blocks are rejected when the history is sent back
+	content := slices.DeleteFunc(response.Content, func(block anthropicBlock) bool {
+		return block.Type == "text" && block.Text == ""
+	})
+
+	reply := &Reply{Usage: response.Usage.usage()}
+	var text []string
+	for _, block := range content {
+		switch block.Type {
+		case "text":
+			text = append(text, block.Text)
+		case "tool_use":
+			reply.ToolCalls = append(reply.ToolCalls, ToolCall{
+				ID:        block.ID,
+				Name:      block.Name,
+				Arguments: string(block.Input),
+			})
+		}
+	}
+	reply.Text = strings.Join(text, "\n")
+	if response.StopReason == "max_tokens" && len(reply.ToolCalls) == 0 && reply.Text != "" {
+		reply.Text += fmt.Sprintf("\n\n[Answer cut off at %d output tokens; raise GPT5_PRO_MCP_MAX_OUTPUT_TOKENS for longer answers]", request.MaxTokens)
+	}
+
+	if len(content) > 0 {
+		t.messages = append(t.messages, anthropicMessage{Role: "assistant", Content: content})
+		t.complete = len(reply.ToolCalls) == 0
+	}
+	return reply, nil
+}
+
+// AddToolResult adds a tool_result block answering one of the reply's
+// tool_use blocks, marked as an error if the tool failed. The results of
+// one reply share a single user message.
+func (t *anthropicTurn) AddToolResult(call ToolCall, output string, failed bool) {
+	block := anthropicBlock{Type: "tool_result", ToolUseID: call.ID, Content: output, IsError: failed}
+	if last := &t.messages[len(t.messages)-1]; last.Role == "user" {
+		last.Content = append(last.Content, block)
+		return
+	}
+	t.messages = append(t.messages, anthropicMessage{Role: "user", Content: []anthropicBlock{block}})
+}
+
+// Save records the history once the turn has its answer. A history ending
+// in unanswered tool_use blocks would be rejected by the next request, so
+// until then the conversation keeps its previous history.
+func (t *anthropicTurn) Save(state *conversation.State) {
+	if !t.complete {
+		return
+	}
+	history, err := json.Marshal(t.messages)
+	if err != nil {
+		log.Printf("[Anthropic] WARNING: Failed to save conversation history: %v", err)
+		return
+	}
+	state.History = history
+}
+
+// createMessage sends a Messages API request. When streaming, answer text is forwarded to
+// the client as it arrives, and a stream that breaks off returns the message
+// so far with its error, for its usage.
+func (p *AnthropicProvider) createMessage(ctx context.Context, request anthropicRequest, progress *progressReporter) (*anthropicResponse, error) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode request: %w", err)
+	}
+
+	header := http.Header{}
+	header.Set("X-Api-Key", p.config.AnthropicAPIKey)
+	header.Set("Anthropic-Version", anthropicVersion)
+	resp, err := postJSON(ctx, p.http, p.baseURL+"/v1/messages", header, body, progress, anthropicAPIError)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if !request.Stream {
+		var response anthropicResponse
+		if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+			return nil, fmt.Errorf("failed to decode response: %w", err)
+		}
+		return &response, nil
+	}
+
+	progress.StartAnswer()
+	defer progress.FlushPartial()
+	return readAnthropicStream(resp.Body, progress)
+}
+
+// anthropicEvent is a server-sent event of a streamed message
+type anthropicEvent struct {
+	Type         string            `json:"type"`
+	Message      anthropicResponse `json:"message"`       // message_start
+	Index        int               `json:"index"`         // content_block_*
+	ContentBlock anthropicBlock    `json:"content_block"` // content_block_start
+	Delta        struct {
+		Type        string `json:"type"`
+		Text        string `json:"text"`
+		PartialJSON string `json:"partial_json"`
+		Thinking    string `json:"thinking"`
+		Signature   string `json:"signature"`
+		StopReason  string `json:"stop_reason"`
+	} `json:"delta"`
+	Usage anthropicUsage `json:"usage"` // message_delta
+	anthropicError
+}
+
+// readAnthropicStream assembles a message from server-sent events,
+// forwarding answer text to progress as it arrives. If the stream fails
+// after the message started, the partial message is returned with the error.
+func readAnthropicStream(body io.Reader, progress *progressReporter) (*anthropicResponse, error) {
+	var response *anthropicResponse
+	done := false
+	inputs := make(map[int]*strings.Builder) // tool_use input JSON, streamed in pieces
+
+	err := readSSE(body, func(data []byte) error {
+		var event anthropicEvent
+		if err := json.Unmarshal(data, &event); err != nil {
+			return fmt.Errorf("invalid stream event: %w", err)
+		}
+
+		if event.Type == "error" {
+			return fmt.Errorf("stream error: %s: %s", event.Error.Type, event.Error.Message)
+		}
+		if event.Type == "message_start" {
+			message := event.Message
+			response = &message
+			return nil
+		}
+		if response == nil {
+			return nil
+		}
+
+		switch event.Type {
+		case "content_block_start":
+			for len(response.Content) <= event.Index {
+				response.Content = append(response.Content, anthropicBlock{})
+			}
+			block := event.ContentBlock
+			if block.Type == "tool_use" {
+				progress.Report("Model is calling %s", block.Name)
+				block.Input = nil
+				inputs[event.Index] = &strings.Builder{}
+			}
+			response.Content[event.Index] = block
+		case "content_block_delta":
+			if event.Index >= len(response.Content) {
+				return nil
+			}
+			block := &response.Content[event.Index]
+			switch event.Delta.Type {
+			case "text_delta":
+				block.Text += event.Delta.Text
+				progress.Partial(event.Delta.Text)
+			case "thinking_delta":
+				block.Thinking += event.Delta.Thinking
+			case "signature_delta":
+				block.Signature = event.Delta.Signature
+			case "input_json_delta":
+				if input := inputs[event.Index]; input != nil {
+					input.WriteString(event.Delta.PartialJSON)
+				}
+			}
+		case "content_block_stop":
+			if input := inputs[event.Index]; input != nil && event.Index < len(response.Content) {
+				response.Content[event.Index].Input = toolInput(input.String())
+			}
+		case "message_delta":
+			response.StopReason = event.Delta.StopReason
+			response.Usage.OutputTokens = event.Usage.OutputTokens
+		case "message_stop":
+			done = true
+			return io.EOF
+		}
+		return nil
+	})
+	if err != nil {
+		return response, err
+	}
+	if !done {
+		return response, fmt.Errorf("stream ended before the message was complete")
+	}
+	return response, nil
+}
+
+// toolInput returns streamed tool_use input, or an empty object for a tool
+// called without arguments
+func toolInput(input string) json.RawMessage {
+	if strings.TrimSpace(input) == "" {
+		return json.RawMessage("{}")
+	}
+	return json.RawMessage(input)
+}
+
+// anthropicAPIError turns a failed request's status and body into an error
+func anthropicAPIError(status int, body []byte) error {
+	var apiErr anthropicError
+	if json.Unmarshal(body, &apiErr) == nil && apiErr.Error.Message != "" {
+		return fmt.Errorf("%s (HTTP %d): %s", apiErr.Error.Type, status, apiErr.Error.Message)
+	}
+	return fmt.Errorf("HTTP %d: %s", status, strings.TrimSpace(string(body)))
+}
+
+// buildTools maps the file tools to Messages API tool definitions
+func (p *AnthropicProvider) buildTools() []anthropicTool {
+	var tools []anthropicTool
+	for _, tool := range fileTools() {
+		tools = append(tools, anthropicTool{
+			Name:        tool.Name,
+			Description: tool.Description,
+			InputSchema: tool.Parameters,
+		})
+	}
+	return tools
+}
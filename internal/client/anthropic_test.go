@@ -0,0 +1,260 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/lox/gpt-5-pro-mcp/internal/config"
+	"github.com/lox/gpt-5-pro-mcp/internal/conversation"
+	"github.com/lox/gpt-5-pro-mcp/internal/usage"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Recorded Messages API streams: a reply that calls read_file after some
+// text, written to the prompt cache, then the answer read back from it
+const (
+	anthropicToolUseStream = `event: message_start
+data: {"type":"message_start","message":{"id":"msg_01","type":"message","role":"assistant","model":"claude-sonnet-4-5","content":[],"stop_reason":null,"usage":{"input_tokens":1200,"cache_creation_input_tokens":3000,"cache_read_input_tokens":0,"output_tokens":2}}}
+
+event: content_block_start
+data: {"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}
+
+event: ping
+data: {"type": "ping"}
+
+event: content_block_delta
+data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"Let me read "}}
+
+event: content_block_delta
+data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"the file."}}
+
+event: content_block_stop
+data: {"type":"content_block_stop","index":0}
+
+event: content_block_start
+data: {"type":"content_block_start","index":1,"content_block":{"type":"tool_use","id":"toolu_01","name":"read_file","input":{}}}
+
+event: content_block_delta
+data: {"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":""}}
+
+event: content_block_delta
+data: {"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"{\"path\": \"ma"}}
+
+event: content_block_delta
+data: {"type":"content_block_delta","index":1,"delta":{"type":"input_json_delta","partial_json":"in.go\"}"}}
+
+event: content_block_stop
+data: {"type":"content_block_stop","index":1}
+
+event: message_delta
+data: {"type":"message_delta","delta":{"stop_reason":"tool_use","stop_sequence":null},"usage":{"output_tokens":58}}
+
+event: message_stop
+data: {"type":"message_stop"}
+
+`
+	anthropicAnswerStream = `event: message_start
+data: {"type":"message_start","message":{"id":"msg_02","type":"message","role":"assistant","model":"claude-sonnet-4-5","content":[],"stop_reason":null,"usage":{"input_tokens":300,"cache_creation_input_tokens":0,"cache_read_input_tokens":3000,"output_tokens":1}}}
+
+event: content_block_start
+data: {"type":"content_block_start","index":0,"content_block":{"type":"text","text":""}}
+
+event: content_block_delta
+data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"main.go starts the "}}
+
+event: content_block_delta
+data: {"type":"content_block_delta","index":0,"delta":{"type":"text_delta","text":"MCP server."}}
+
+event: content_block_stop
+data: {"type":"content_block_stop","index":0}
+
+event: message_delta
+data: {"type":"message_delta","delta":{"stop_reason":"end_turn","stop_sequence":null},"usage":{"output_tokens":12}}
+
+event: message_stop
+data: {"type":"message_stop"}
+
+`
+)
+
+// anthropicServer replays streams, one per request, and records the
+// requests it was sent
+func anthropicServer(t *testing.T, streams ...string) (*httptest.Server, *[]anthropicRequest) {
+	t.Helper()
+	var requests []anthropicRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/messages" || r.Header.Get("X-Api-Key") != "test-key" || r.Header.Get("Anthropic-Version") != anthropicVersion {
+			http.Error(w, `{"type":"error","error":{"type":"invalid_request_error","message":"bad request"}}`, http.StatusBadRequest)
+			return
+		}
+		var request anthropicRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		requests = append(requests, request)
+		if len(requests) > len(streams) {
+			http.Error(w, `{"type":"error","error":{"type":"invalid_request_error","message":"unexpected request"}}`, http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, streams[len(requests)-1])
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func newTestAnthropicProvider(url string) *AnthropicProvider {
+	return NewAnthropicProvider(&config.Config{
+		AnthropicAPIKey:  "test-key",
+		AnthropicBaseURL: url,
+		MaxOutputTokens:  4096,
+		Stream:           true,
+	})
+}
+
+func TestAnthropicToolUseRoundTrip(t *testing.T) {
+	server, requests := anthropicServer(t, anthropicToolUseStream, anthropicAnswerStream)
+	provider := newTestAnthropicProvider(server.URL)
+	settings := callSettings{Model: "claude-sonnet-4-5"}
+	progress := newProgressReporter(context.Background(), mcp.CallToolRequest{})
+
+	var state conversation.State
+	turn := provider.NewTurn(state, "system prompt", "What does main.go do?")
+
+	reply, err := turn.Send(context.Background(), settings, progress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply.Text != "Let me read the file." {
+		t.Errorf("text = %q", reply.Text)
+	}
+	if len(reply.ToolCalls) != 1 {
+		t.Fatalf("got %d tool calls, want 1", len(reply.ToolCalls))
+	}
+	call := reply.ToolCalls[0]
+	if call.ID != "toolu_01" || call.Name != "read_file" || call.Arguments != `{"path": "main.go"}` {
+		t.Errorf("tool call = %+v", call)
+	}
+	want := usage.Usage{InputTokens: 4200, CacheWriteTokens: 3000, OutputTokens: 58}
+	if reply.Usage != want {
+		t.Errorf("usage = %+v, want %+v", reply.Usage, want)
+	}
+
+	// The history isn't saved while the tool call is unanswered
+	turn.Save(&state)
+	if state.History != nil {
+		t.Errorf("saved history ending in a tool_use: %s", state.History)
+	}
+
+	turn.AddToolResult(call, "package main", false)
+	reply, err = turn.Send(context.Background(), settings, progress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply.Text != "main.go starts the MCP server." || len(reply.ToolCalls) != 0 {
+		t.Errorf("answer = %q with %d tool calls", reply.Text, len(reply.ToolCalls))
+	}
+	want = usage.Usage{InputTokens: 3300, CachedInputTokens: 3000, OutputTokens: 12}
+	if reply.Usage != want {
+		t.Errorf("usage = %+v, want %+v", reply.Usage, want)
+	}
+
+	// The second request sends the tool_use back, answered by a tool_result
+	if len(*requests) != 2 {
+		t.Fatalf("got %d requests, want 2", len(*requests))
+	}
+	messages := (*requests)[1].Messages
+	if len(messages) != 3 {
+		t.Fatalf("second request has %d messages, want 3", len(messages))
+	}
+	assistant, result := messages[1], messages[2]
+	if assistant.Role != "assistant" || len(assistant.Content) != 2 || assistant.Content[1].Type != "tool_use" ||
+		assistant.Content[1].ID != "toolu_01" || string(assistant.Content[1].Input) != `{"path":"main.go"}` {
+		t.Errorf("assistant message = %+v", assistant)
+	}
+	if result.Role != "user" || len(result.Content) != 1 || result.Content[0].Type != "tool_result" ||
+		result.Content[0].ToolUseID != "toolu_01" || result.Content[0].Content != "package main" || result.Content[0].IsError {
+		t.Errorf("tool result message = %+v", result)
+	}
+	if (*requests)[1].System != "system prompt" || !(*requests)[1].Stream {
+		t.Errorf("second request lost its system prompt or streaming: %+v", (*requests)[1])
+	}
+
+	turn.Save(&state)
+	var history []anthropicMessage
+	if err := json.Unmarshal(state.History, &history); err != nil || len(history) != 4 {
+		t.Fatalf("saved history = %s (%v), want 4 messages", state.History, err)
+	}
+}
+
+func TestAnthropicFailedToolResult(t *testing.T) {
+	server, requests := anthropicServer(t, anthropicToolUseStream, anthropicAnswerStream)
+	provider := newTestAnthropicProvider(server.URL)
+	settings := callSettings{Model: "claude-sonnet-4-5"}
+	progress := newProgressReporter(context.Background(), mcp.CallToolRequest{})
+
+	turn := provider.NewTurn(conversation.State{}, "system prompt", "What does main.go do?")
+	reply, err := turn.Send(context.Background(), settings, progress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	turn.AddToolResult(reply.ToolCalls[0], "Error: main.go not found", true)
+	if _, err := turn.Send(context.Background(), settings, progress); err != nil {
+		t.Fatal(err)
+	}
+
+	result := (*requests)[1].Messages[2].Content[0]
+	if result.Type != "tool_result" || !result.IsError || result.Content != "Error: main.go not found" {
+		t.Errorf("tool result = %+v, want a tool_result marked as an error", result)
+	}
+}
+
+func TestAnthropicCachePricing(t *testing.T) {
+	price, ok := usage.DefaultPrices().Lookup("claude-sonnet-4-5")
+	if !ok {
+		t.Fatal("no price for claude-sonnet-4-5")
+	}
+
+	// 1200 plain input at $3, 3000 written to the cache at $3.75, 58 output at $15
+	written := anthropicUsage{InputTokens: 1200, CacheCreationInputTokens: 3000, OutputTokens: 58}
+	if got, want := price.Cost(written.usage()), (1200*3+3000*3.75+58*15)/1e6; math.Abs(got-want) > 1e-12 {
+		t.Errorf("cost with cache writes = %v, want %v", got, want)
+	}
+
+	// 300 plain input, 3000 read from the cache at $0.30, 12 output
+	read := anthropicUsage{InputTokens: 300, CacheReadInputTokens: 3000, OutputTokens: 12}
+	if got, want := price.Cost(read.usage()), (300*3+3000*0.3+12*15)/1e6; math.Abs(got-want) > 1e-12 {
+		t.Errorf("cost with cache reads = %v, want %v", got, want)
+	}
+
+	// Prices without a cache write rate bill cache writes as input
+	plain := usage.Price{Input: 3, CachedInput: 0.3, Output: 15}
+	if got, want := plain.Cost(written.usage()), (4200*3+58*15)/1e6; math.Abs(got-want) > 1e-12 {
+		t.Errorf("cost without a cache write price = %v, want %v", got, want)
+	}
+}
+
+func TestAnthropicBrokenStreamReportsUsage(t *testing.T) {
+	// The stream breaks off after the first text delta
+	cut := anthropicToolUseStream[:strings.Index(anthropicToolUseStream, "event: content_block_stop")]
+	server, _ := anthropicServer(t, cut)
+	provider := newTestAnthropicProvider(server.URL)
+	progress := newProgressReporter(context.Background(), mcp.CallToolRequest{})
+
+	turn := provider.NewTurn(conversation.State{}, "system prompt", "What does main.go do?")
+	reply, err := turn.Send(context.Background(), callSettings{Model: "claude-sonnet-4-5"}, progress)
+	if err == nil {
+		t.Fatal("broken stream succeeded")
+	}
+	want := usage.Usage{InputTokens: 4200, CacheWriteTokens: 3000, OutputTokens: 2}
+	if reply == nil || reply.Usage != want {
+		t.Fatalf("reply = %+v, want usage %+v", reply, want)
+	}
+}
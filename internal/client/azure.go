@@ -0,0 +1,18 @@
+package client
+
+import (
+	"github.com/lox/gpt-5-pro-mcp/internal/config"
+	"github.com/openai/openai-go/azure"
+	"github.com/openai/openai-go/option"
+)
+
+// azureOptions points the OpenAI client at an Azure OpenAI resource. Dated
+// API versions route requests to the deployment named by their model; the
+// v1 API is OpenAI-compatible, with deployment names as models, so it only
+// needs its base URL.
+func azureOptions(cfg *config.Config) []option.RequestOption {
+	if cfg.AzureAPIVersion == "v1" {
+		return []option.RequestOption{option.WithBaseURL(cfg.AzureEndpoint + "/openai/v1/"), azure.WithAPIKey(cfg.APIKey)}
+	}
+	return []option.RequestOption{azure.WithEndpoint(cfg.AzureEndpoint, cfg.AzureAPIVersion), azure.WithAPIKey(cfg.APIKey)}
+}
@@ -2,244 +2,255 @@ package client
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"log"
+	"slices"
+	"strings"
 
-	contextpkg "github.com/lox/gpt-5-pro-mcp/internal/context"
-	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/lox/gpt-5-pro-mcp/internal/config"
+	"github.com/lox/gpt-5-pro-mcp/internal/conversation"
 	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
 	"github.com/openai/openai-go/shared"
 )
 
-// ChatCompletionsClient handles communication with OpenAI Chat Completions API
-// Used for custom endpoints (aihubmix, etc.) that don't support Responses API
-type ChatCompletionsClient struct {
-	client          *openai.Client
-	fileOps         FileOps
-	conversationHistory []openai.ChatCompletionMessageParamUnion
-	baseURL         string
+// ChatCompletionsProvider consults models through the Chat Completions API.
+// Used for custom endpoints (aihubmix, etc.) that don't support Responses API.
+// The API is stateless, so each turn resends the conversation's full history.
+type ChatCompletionsProvider struct {
+	client *openai.Client
+	config *config.Config
+	name   string
+	prefix string       // Routing prefix to strip from model names
+	tools  *toolSupport // Set for servers that may lack native tool calling
 }
 
-// NewChatCompletions creates a new ChatCompletionsClient instance
-func NewChatCompletions(client *openai.Client, baseURL string, fileOps FileOps) *ChatCompletionsClient {
-	return &ChatCompletionsClient{
-		client:              client,
-		fileOps:             fileOps,
-		conversationHistory: []openai.ChatCompletionMessageParamUnion{},
-		baseURL:             baseURL,
-	}
+// NewChatCompletionsProvider creates a provider for the Chat Completions API
+func NewChatCompletionsProvider(client *openai.Client, cfg *config.Config) *ChatCompletionsProvider {
+	return &ChatCompletionsProvider{client: client, config: cfg, name: "Chat Completions API"}
 }
 
-// Handle processes a consultation request using Chat Completions API
-func (c *ChatCompletionsClient) Handle(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-	prompt, err := request.RequireString("prompt")
-	if err != nil {
-		log.Printf("ERROR: Failed to get prompt: %v", err)
-		return mcp.NewToolResultError(err.Error()), nil
-	}
-
-	continueConversation := request.GetBool("continue", true)
-	gatheredContext := request.GetString("gathered_context", "")
-	autoGatherContext := request.GetBool("auto_gather_context", true)
-
-	log.Printf("[ChatCompletions] Received request: prompt_len=%d continue=%v auto_gather=%v has_context=%v",
-		len(prompt), continueConversation, autoGatherContext, gatheredContext != "")
+// Name identifies the Chat Completions API in logs and errors
+func (p *ChatCompletionsProvider) Name() string {
+	return p.name
+}
 
-	// Phase 1: Context gathering logic
-	if autoGatherContext && gatheredContext == "" {
-		log.Printf("[ChatCompletions] Analyzing prompt for code references...")
-		requirements := contextpkg.AnalyzePromptForReferences(prompt)
+// chatTurn is a turn on the Chat Completions API: the history so far,
+// including this turn's requests and replies
+type chatTurn struct {
+	provider *ChatCompletionsProvider
+	messages []openai.ChatCompletionMessageParamUnion
+	complete bool // the last reply was the answer, not tool calls
+	sent     int  // requests sent so far
+
+	// With emulated tool calling, tools are described in the system prompt
+	// and calls parsed from the reply text; results wait here for one
+	// message answering them all
+	emulate bool
+	calls   []ToolCall
+	outputs []string
+	called  int
+}
 
-		if requirements.HasCodeRefs {
-			log.Printf("[ChatCompletions] Found code references: files=%d functions=%d",
-				len(requirements.Files), len(requirements.Functions))
+// NewTurn starts a turn from the conversation's history, or from the system
+// prompt when the conversation is new
+func (p *ChatCompletionsProvider) NewTurn(state conversation.State, systemPrompt, prompt string) Turn {
+	var messages []openai.ChatCompletionMessageParamUnion
+	if len(state.Messages) == 0 {
+		messages = append(messages, openai.SystemMessage(systemPrompt))
+	} else {
+		log.Printf("[ChatCompletions] Continuing conversation: history_len=%d", len(state.Messages))
+		messages = append(messages, state.Messages...)
+	}
+	messages = append(messages, openai.UserMessage(prompt))
+	return &chatTurn{provider: p, messages: messages}
+}
 
-			contextRequest := contextpkg.BuildContextRequest(requirements)
-			responseText := contextpkg.FormatContextRequestAsText(contextRequest)
+// Send sends the whole history and appends the reply to it
+func (t *chatTurn) Send(ctx context.Context, settings callSettings, progress *progressReporter) (*Reply, error) {
+	model := strings.TrimPrefix(settings.Model, t.provider.prefix)
+	tools := t.provider.tools
+	if t.sent == 0 && tools != nil {
+		t.emulate = !tools.native(ctx, model)
+	}
+	if len(t.calls) > 0 {
+		t.messages = append(t.messages, openai.UserMessage(emulatedToolResults(t.calls, t.outputs)))
+		t.calls, t.outputs = nil, nil
+	}
 
-			log.Printf("[ChatCompletions] Returning context request to Claude Code")
-			return mcp.NewToolResultText(responseText), nil
+	completion, err := t.createCompletion(ctx, model, settings, progress)
+	if err != nil && t.sent == 0 && !t.emulate && tools != nil && tools.rejected(model, err) {
+		t.emulate = true
+		completion, err = t.createCompletion(ctx, model, settings, progress)
+	}
+	t.sent++
+	if err != nil {
+		if completion != nil {
+			return &Reply{Usage: completionUsage(completion)}, err
 		}
+		return nil, err
+	}
+	if len(completion.Choices) == 0 {
+		log.Printf("[ChatCompletions] ERROR: No choices in response")
+		return nil, fmt.Errorf("no response from API")
+	}
 
-		log.Printf("[ChatCompletions] No code references found, proceeding without context")
+	message := completion.Choices[0].Message
+	reply := &Reply{Text: message.Content, Usage: completionUsage(completion)}
+	if t.emulate {
+		reply.ToolCalls, reply.Text = parseEmulatedToolCalls(message.Content, t.called)
+		t.called += len(reply.ToolCalls)
+		t.messages = append(t.messages, openai.AssistantMessage(message.Content))
+		t.complete = len(reply.ToolCalls) == 0
+		return reply, nil
 	}
 
-	// Phase 2: Enrich prompt with gathered context if provided
-	if gatheredContext != "" {
-		log.Printf("[ChatCompletions] Enriching prompt with gathered context: len=%d", len(gatheredContext))
-		enrichedPrompt, err := contextpkg.EnrichPromptWithContext(prompt, gatheredContext)
-		if err != nil {
-			log.Printf("[ChatCompletions] ERROR: Failed to enrich prompt: %v", err)
-			return mcp.NewToolResultError(fmt.Sprintf("Failed to process gathered_context: %v", err)), nil
-		}
-		prompt = enrichedPrompt
-		log.Printf("[ChatCompletions] Prompt enriched: new_len=%d", len(prompt))
+	// Add assistant message to history, keeping its tool calls so the
+	// tool results that follow can be matched to them
+	t.messages = append(t.messages, message.ToParam())
+	t.complete = len(message.ToolCalls) == 0
+
+	for _, toolCall := range message.ToolCalls {
+		reply.ToolCalls = append(reply.ToolCalls, ToolCall{
+			ID:        toolCall.ID,
+			Name:      toolCall.Function.Name,
+			Arguments: toolCall.Function.Arguments,
+		})
 	}
+	return reply, nil
+}
 
-	// Start fresh if continue is false
-	if !continueConversation {
-		log.Printf("[ChatCompletions] Starting fresh conversation")
-		c.conversationHistory = []openai.ChatCompletionMessageParamUnion{}
-	} else if len(c.conversationHistory) > 0 {
-		log.Printf("[ChatCompletions] Continuing conversation: history_len=%d", len(c.conversationHistory))
+// AddToolResult appends a tool message answering one of the reply's calls.
+// Emulated calls are answered together in one user message on the next Send.
+func (t *chatTurn) AddToolResult(call ToolCall, output string, failed bool) {
+	if t.emulate {
+		t.calls = append(t.calls, call)
+		t.outputs = append(t.outputs, output)
+		return
 	}
+	t.messages = append(t.messages, openai.ToolMessage(output, call.ID))
+}
 
-	// Build messages array
-	messages := []openai.ChatCompletionMessageParamUnion{}
+// Save records the history once the turn has its answer. A history ending
+// in unanswered tool calls would be rejected by the next request, so until
+// then the conversation keeps its previous history.
+func (t *chatTurn) Save(state *conversation.State) {
+	if t.complete {
+		state.Messages = t.messages
+	}
+}
 
-	// Add system message if starting fresh or first message
-	if len(c.conversationHistory) == 0 {
-		messages = append(messages, openai.SystemMessage(buildSystemPrompt()))
+// createCompletion sends the history for model, with the tools offered
+// natively or described in the system prompt
+func (t *chatTurn) createCompletion(ctx context.Context, model string, settings callSettings, progress *progressReporter) (*openai.ChatCompletion, error) {
+	params := openai.ChatCompletionNewParams{
+		Model:           model,
+		Messages:        t.messages,
+		ReasoningEffort: shared.ReasoningEffort(settings.ReasoningEffort),
+	}
+	if t.emulate {
+		params.Messages = withEmulatedTools(t.messages)
 	} else {
-		// Add conversation history
-		messages = append(messages, c.conversationHistory...)
+		params.Tools = t.provider.buildChatTools()
 	}
 
-	// Add current user message
-	messages = append(messages, openai.UserMessage(prompt))
+	log.Printf("[ChatCompletions] Calling %s: model=%s reasoning_effort=%q verbosity=%q messages=%d emulated_tools=%t",
+		t.provider.name, model, settings.ReasoningEffort, settings.Verbosity, len(t.messages), t.emulate)
+	return t.provider.createCompletion(ctx, params, settings.requestOptions("verbosity"), progress)
+}
 
-	// Build tools
-	tools := c.buildChatTools()
+// withEmulatedTools returns messages with the emulated tool calling
+// instructions added to the system prompt
+func withEmulatedTools(messages []openai.ChatCompletionMessageParamUnion) []openai.ChatCompletionMessageParamUnion {
+	if len(messages) == 0 || messages[0].OfSystem == nil {
+		return append([]openai.ChatCompletionMessageParamUnion{openai.SystemMessage(emulatedToolsPrompt())}, messages...)
+	}
+	messages = slices.Clone(messages)
+	messages[0] = openai.SystemMessage(messages[0].OfSystem.Content.OfString.Value + emulatedToolsPrompt())
+	return messages
+}
 
-	// Call Chat Completions API with tool support
-	log.Printf("[ChatCompletions] Calling Chat Completions API: model=%s", defaultModel)
+// createCompletion sends a Chat Completions request. When streaming, answer
+// text is forwarded to the client as it arrives and the chunks, including
+// tool call argument fragments, are accumulated into a complete response.
+// Usage only comes with the last chunk, so a stream that breaks off returns
+// the completion so far with estimated usage and the error.
+func (p *ChatCompletionsProvider) createCompletion(ctx context.Context, params openai.ChatCompletionNewParams, opts []option.RequestOption, progress *progressReporter) (*openai.ChatCompletion, error) {
+	if !p.config.Stream {
+		return p.client.Chat.Completions.New(ctx, params, opts...)
+	}
 
-	for iteration := 0; iteration < maxIterations; iteration++ {
-		params := openai.ChatCompletionNewParams{
-			Model:    defaultModel,
-			Messages: messages,
-		}
+	// Ask for a final chunk carrying token usage
+	params.StreamOptions = openai.ChatCompletionStreamOptionsParam{IncludeUsage: openai.Bool(true)}
+	stream := p.client.Chat.Completions.NewStreaming(ctx, params, opts...)
+	defer stream.Close()
 
-		if len(tools) > 0 {
-			params.Tools = tools
-		}
+	progress.StartAnswer()
+	defer progress.FlushPartial()
 
-		completion, err := c.client.Chat.Completions.New(ctx, params)
-		if err != nil {
-			log.Printf("[ChatCompletions] ERROR: API call failed: %v", err)
-			return mcp.NewToolResultError(fmt.Sprintf("Chat Completions API error: %v", err)), nil
+	var acc openai.ChatCompletionAccumulator
+	var usageChunk *openai.CompletionUsage
+	for stream.Next() {
+		chunk := stream.Current()
+		if !acc.AddChunk(chunk) {
+			return nil, fmt.Errorf("inconsistent stream: chunk %q does not continue completion %q", chunk.ID, acc.ID)
 		}
-
-		if len(completion.Choices) == 0 {
-			log.Printf("[ChatCompletions] ERROR: No choices in response")
-			return mcp.NewToolResultError("No response from API"), nil
+		if chunk.JSON.Usage.Valid() {
+			usageChunk = &chunk.Usage
 		}
-
-		choice := completion.Choices[0]
-		message := choice.Message
-
-		// Add assistant message to history
-		messages = append(messages, openai.AssistantMessage(message.Content))
-
-		// Check if there are tool calls
-		if len(message.ToolCalls) == 0 {
-			// No tool calls, return the response
-			log.Printf("[ChatCompletions] No tool calls, returning response: len=%d", len(message.Content))
-
-			// Save conversation history
-			c.conversationHistory = messages
-
-			return mcp.NewToolResultText(message.Content), nil
+		if len(chunk.Choices) == 0 {
+			continue
 		}
 
-		// Execute tool calls
-		log.Printf("[ChatCompletions] Iteration %d: found %d tool calls", iteration+1, len(message.ToolCalls))
-
-		for _, toolCall := range message.ToolCalls {
-			log.Printf("[ChatCompletions] Executing tool: name=%s id=%s", toolCall.Function.Name, toolCall.ID)
-
-			result, err := c.executeFunction(ctx, toolCall.Function.Name, toolCall.Function.Arguments)
-			if err != nil {
-				log.Printf("[ChatCompletions] Tool execution error: %v", err)
-				result = fmt.Sprintf("Error: %v", err)
-			} else {
-				log.Printf("[ChatCompletions] Tool execution success: result_len=%d", len(result))
+		delta := chunk.Choices[0].Delta
+		if delta.Content != "" {
+			progress.Partial(delta.Content)
+		}
+		for _, toolCall := range delta.ToolCalls {
+			if toolCall.Function.Name != "" {
+				progress.Report("Model is calling %s", toolCall.Function.Name)
 			}
-
-			// Add tool response to messages
-			messages = append(messages, openai.ToolMessage(toolCall.ID, result))
 		}
-
-		// Continue loop to get next response
+	}
+	if err := stream.Err(); err != nil {
+		if acc.ID == "" {
+			return nil, err
+		}
+		if usageChunk != nil {
+			acc.Usage = *usageChunk
+			return &acc.ChatCompletion, err
+		}
+		var output strings.Builder
+		for _, choice := range acc.Choices {
+			output.WriteString(choice.Message.Content)
+			for _, toolCall := range choice.Message.ToolCalls {
+				output.WriteString(toolCall.Function.Arguments)
+			}
+		}
+		estimate := estimatedUsage(params.Messages, output.String())
+		acc.Usage = openai.CompletionUsage{PromptTokens: estimate.InputTokens, CompletionTokens: estimate.OutputTokens}
+		return &acc.ChatCompletion, err
 	}
 
-	log.Printf("[ChatCompletions] ERROR: Max iterations (%d) reached", maxIterations)
-	return mcp.NewToolResultError("Max function call iterations reached"), nil
+	// The accumulator sums the token totals but drops their breakdown
+	if usageChunk != nil {
+		acc.Usage = *usageChunk
+	}
+	return &acc.ChatCompletion, nil
 }
 
-// buildChatTools defines the tools for Chat Completions API
-func (c *ChatCompletionsClient) buildChatTools() []openai.ChatCompletionToolParam {
-	return []openai.ChatCompletionToolParam{
-		{
+// buildChatTools maps the file tools to Chat Completions function tools
+func (p *ChatCompletionsProvider) buildChatTools() []openai.ChatCompletionToolParam {
+	var tools []openai.ChatCompletionToolParam
+	for _, tool := range fileTools() {
+		tools = append(tools, openai.ChatCompletionToolParam{
 			Type: "function",
 			Function: shared.FunctionDefinitionParam{
-				Name:        "read_file",
-				Description: openai.Opt("Read the contents of any file from the filesystem"),
-				Parameters: openai.FunctionParameters{
-					"type": "object",
-					"properties": map[string]interface{}{
-						"path": map[string]interface{}{
-							"type":        "string",
-							"description": "Path to the file to read (supports ~ for home directory)",
-						},
-					},
-					"required": []string{"path"},
-				},
+				Name:        tool.Name,
+				Description: openai.Opt(tool.Description),
+				Parameters:  tool.Parameters,
 			},
-		},
-		{
-			Type: "function",
-			Function: shared.FunctionDefinitionParam{
-				Name:        "grep_files",
-				Description: openai.Opt("Search for patterns in files using regex and glob patterns"),
-				Parameters: openai.FunctionParameters{
-					"type": "object",
-					"properties": map[string]interface{}{
-						"pattern": map[string]interface{}{
-							"type":        "string",
-							"description": "Regular expression pattern to search for",
-						},
-						"path": map[string]interface{}{
-							"type":        "string",
-							"description": "File path or glob pattern (e.g., '*.go', 'src/**/*.js')",
-						},
-						"ignore_case": map[string]interface{}{
-							"type":        "boolean",
-							"description": "Perform case-insensitive search (default: false)",
-						},
-					},
-					"required": []string{"pattern", "path"},
-				},
-			},
-		},
-	}
-}
-
-// executeFunction executes a function call requested by the model
-func (c *ChatCompletionsClient) executeFunction(ctx context.Context, name, argsJSON string) (string, error) {
-	switch name {
-	case "read_file":
-		var args struct {
-			Path string `json:"path"`
-		}
-		if err := json.Unmarshal([]byte(argsJSON), &args); err != nil {
-			return "", fmt.Errorf("invalid arguments: %w", err)
-		}
-		return c.fileOps.ReadFile(ctx, args.Path)
-
-	case "grep_files":
-		var args struct {
-			Pattern    string `json:"pattern"`
-			Path       string `json:"path"`
-			IgnoreCase bool   `json:"ignore_case"`
-		}
-		if err := json.Unmarshal([]byte(argsJSON), &args); err != nil {
-			return "", fmt.Errorf("invalid arguments: %w", err)
-		}
-		return c.fileOps.GrepFiles(ctx, args.Pattern, args.Path, args.IgnoreCase)
-
-	default:
-		return "", fmt.Errorf("unknown function: %s", name)
+		})
 	}
+	return tools
 }
@@ -0,0 +1,73 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// emulatedToolCall matches a tool call written in text: a fenced tool_call
+// block, or the <tool_call> tags many local models are trained on
+var emulatedToolCall = regexp.MustCompile("(?s)```tool_call[ \t]*\n(.*?)\n?```|<tool_call>(.*?)</tool_call>")
+
+// emulatedToolsPrompt describes the file tools and how to call them in
+// text, for models without native tool calling. It is added to the system
+// prompt of every request rather than kept in the history.
+func emulatedToolsPrompt() string {
+	var b strings.Builder
+	b.WriteString("\n\n## Calling tools\n\n" +
+		"This model has no native tool calling, so tools are called in text. To call tools, reply with " +
+		"nothing but one or more fenced tool_call blocks, each holding one JSON object with the tool's " +
+		"name and its arguments:\n\n" +
+		"```tool_call\n{\"name\": \"read_file\", \"arguments\": {\"path\": \"main.go\"}}\n```\n\n" +
+		"The results come back in the next message, each inside <tool_result> tags. When you have what " +
+		"you need, write your answer without any tool_call block.\n\nThe tools and their JSON schema " +
+		"parameters:\n")
+	for _, tool := range fileTools() {
+		parameters, _ := json.Marshal(tool.Parameters)
+		fmt.Fprintf(&b, "\n- %s: %s\n  parameters: %s\n", tool.Name, tool.Description, parameters)
+	}
+	return b.String()
+}
+
+// parseEmulatedToolCalls extracts the tool calls written in text, numbering
+// them from first. It returns the text without them; blocks that aren't
+// valid calls are left in the text.
+func parseEmulatedToolCalls(text string, first int) ([]ToolCall, string) {
+	var calls []ToolCall
+	rest := emulatedToolCall.ReplaceAllStringFunc(text, func(block string) string {
+		match := emulatedToolCall.FindStringSubmatch(block)
+		var call struct {
+			Name      string          `json:"name"`
+			Arguments json.RawMessage `json:"arguments"`
+		}
+		if err := json.Unmarshal([]byte(strings.TrimSpace(match[1]+match[2])), &call); err != nil || call.Name == "" {
+			return block
+		}
+
+		// Some models encode the arguments as a JSON string
+		arguments := string(call.Arguments)
+		var encoded string
+		if json.Unmarshal(call.Arguments, &encoded) == nil {
+			arguments = encoded
+		}
+		calls = append(calls, ToolCall{
+			ID:        fmt.Sprintf("call_%d", first+len(calls)),
+			Name:      call.Name,
+			Arguments: string(toolInput(arguments)),
+		})
+		return ""
+	})
+	return calls, strings.TrimSpace(rest)
+}
+
+// emulatedToolResults formats tool outputs as the message answering a
+// reply's emulated calls
+func emulatedToolResults(calls []ToolCall, outputs []string) string {
+	var b strings.Builder
+	for i, call := range calls {
+		fmt.Fprintf(&b, "<tool_result name=%q id=%q>\n%s\n</tool_result>\n\n", call.Name, call.ID, outputs[i])
+	}
+	return strings.TrimSpace(b.String())
+}
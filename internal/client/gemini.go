@@ -0,0 +1,413 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/lox/gpt-5-pro-mcp/internal/config"
+	"github.com/lox/gpt-5-pro-mcp/internal/conversation"
+	"github.com/lox/gpt-5-pro-mcp/internal/usage"
+)
+
+// geminiThinkingBudgets maps reasoning_effort to a thinking budget in
+// tokens, which comes on top of the output cap. The default leaves the
+// budget to the model.
+var geminiThinkingBudgets = map[string]int64{"minimal": 128, "low": 2048, "medium": 8192, "high": 24576}
+
+// GeminiProvider consults Gemini models through the Gemini API's
+// generateContent method. The API is stateless, so each request carries
+// the conversation's full history, kept in the conversation state as JSON.
+type GeminiProvider struct {
+	config  *config.Config
+	http    *http.Client
+	baseURL string
+}
+
+// NewGeminiProvider creates a provider for the Gemini API
+func NewGeminiProvider(cfg *config.Config) *GeminiProvider {
+	return &GeminiProvider{
+		config:  cfg,
+		http:    &http.Client{},
+		baseURL: strings.TrimSuffix(cfg.GeminiBaseURL, "/"),
+	}
+}
+
+// Name identifies the Gemini API in logs and errors
+func (p *GeminiProvider) Name() string {
+	return "Gemini API"
+}
+
+// geminiContent is one turn of a generateContent conversation
+type geminiContent struct {
+	Role  string       `json:"role,omitempty"`
+	Parts []geminiPart `json:"parts"`
+}
+
+// geminiPart is a part of a content; only the fields of its kind are set
+type geminiPart struct {
+	Text             string `json:"text,omitempty"`
+	Thought          bool   `json:"thought,omitempty"`
+	ThoughtSignature string `json:"thoughtSignature,omitempty"`
+
+	FunctionCall     *geminiFunctionCall     `json:"functionCall,omitempty"`
+	FunctionResponse *geminiFunctionResponse `json:"functionResponse,omitempty"`
+}
+
+// geminiFunctionCall is the model calling a function declaration
+type geminiFunctionCall struct {
+	ID   string          `json:"id,omitempty"`
+	Name string          `json:"name"`
+	Args json.RawMessage `json:"args,omitempty"`
+}
+
+// geminiFunctionResponse answers a function call
+type geminiFunctionResponse struct {
+	ID       string         `json:"id,omitempty"`
+	Name     string         `json:"name"`
+	Response map[string]any `json:"response"`
+}
+
+// geminiTool holds the function declarations in a request
+type geminiTool struct {
+	FunctionDeclarations []geminiFunctionDeclaration `json:"functionDeclarations"`
+}
+
+// geminiFunctionDeclaration is a tool definition in a request
+type geminiFunctionDeclaration struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	Parameters  map[string]any `json:"parameters"`
+}
+
+// geminiGenerationConfig limits the output and sets the thinking budget
+type geminiGenerationConfig struct {
+	MaxOutputTokens int64                 `json:"maxOutputTokens"`
+	ThinkingConfig  *geminiThinkingConfig `json:"thinkingConfig,omitempty"`
+}
+
+// geminiThinkingConfig sets how many tokens the model may think for
+type geminiThinkingConfig struct {
+	ThinkingBudget int64 `json:"thinkingBudget"`
+}
+
+// geminiRequest is the body of a generateContent request
+type geminiRequest struct {
+	SystemInstruction *geminiContent         `json:"systemInstruction,omitempty"`
+	Contents          []geminiContent        `json:"contents"`
+	Tools             []geminiTool           `json:"tools,omitempty"`
+	GenerationConfig  geminiGenerationConfig `json:"generationConfig"`
+}
+
+// geminiResponse is a generateContent response, or one chunk of a stream
+type geminiResponse struct {
+	Candidates []struct {
+		Content      geminiContent `json:"content"`
+		FinishReason string        `json:"finishReason"`
+	} `json:"candidates"`
+	PromptFeedback struct {
+		BlockReason string `json:"blockReason"`
+	} `json:"promptFeedback"`
+	UsageMetadata geminiUsage `json:"usageMetadata"`
+	ResponseID    string      `json:"responseId"`
+}
+
+// geminiUsage are the token counts of a response. Candidate tokens exclude
+// thinking tokens.
+type geminiUsage struct {
+	PromptTokenCount        int64 `json:"promptTokenCount"`
+	CachedContentTokenCount int64 `json:"cachedContentTokenCount"`
+	CandidatesTokenCount    int64 `json:"candidatesTokenCount"`
+	ThoughtsTokenCount      int64 `json:"thoughtsTokenCount"`
+}
+
+// usage converts the token counts to the meter's, where reasoning is part
+// of the output
+func (u geminiUsage) usage() usage.Usage {
+	return usage.Usage{
+		InputTokens:       u.PromptTokenCount,
+		CachedInputTokens: u.CachedContentTokenCount,
+		OutputTokens:      u.CandidatesTokenCount + u.ThoughtsTokenCount,
+		ReasoningTokens:   u.ThoughtsTokenCount,
+	}
+}
+
+// geminiError is the body of a failed request
+type geminiError struct {
+	Error struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Status  string `json:"status"`
+	} `json:"error"`
+}
+
+// geminiTurn is a turn on the Gemini API: the history so far, including
+// this turn's requests and replies
+type geminiTurn struct {
+	provider *GeminiProvider
+	system   string
+	contents []geminiContent
+	apiIDs   map[string]bool // call IDs that came from the API, not made up
+	complete bool            // the last reply was the answer, not tool calls
+}
+
+// NewTurn starts a turn from the conversation's history
+func (p *GeminiProvider) NewTurn(state conversation.State, systemPrompt, prompt string) Turn {
+	var contents []geminiContent
+	if len(state.History) > 0 {
+		if err := json.Unmarshal(state.History, &contents); err != nil {
+			log.Printf("[Gemini] WARNING: Discarding unreadable conversation history: %v", err)
+			contents = nil
+		} else {
+			log.Printf("[Gemini] Continuing conversation: history_len=%d", len(contents))
+		}
+	}
+	contents = append(contents, geminiContent{Role: "user", Parts: []geminiPart{{Text: prompt}}})
+	return &geminiTurn{provider: p, system: systemPrompt, contents: contents, apiIDs: make(map[string]bool)}
+}
+
+// Send sends the whole history and appends the reply to it
+func (t *geminiTurn) Send(ctx context.Context, settings callSettings, progress *progressReporter) (*Reply, error) {
+	request := geminiRequest{
+		SystemInstruction: &geminiContent{Parts: []geminiPart{{Text: t.system}}},
+		Contents:          t.contents,
+		Tools:             []geminiTool{{FunctionDeclarations: t.provider.buildTools()}},
+		GenerationConfig:  geminiGenerationConfig{MaxOutputTokens: t.provider.config.MaxOutputTokens},
+	}
+	if budget, ok := geminiThinkingBudgets[settings.ReasoningEffort]; ok {
+		request.GenerationConfig.ThinkingConfig = &geminiThinkingConfig{ThinkingBudget: budget}
+		request.GenerationConfig.MaxOutputTokens += budget
+	}
+
+	log.Printf("[Gemini] Calling generateContent: model=%s reasoning_effort=%q contents=%d",
+		settings.Model, settings.ReasoningEffort, len(t.contents))
+	response, err := t.provider.generateContent(ctx, settings.Model, request, progress)
+	if err != nil {
+		if response != nil {
+			return &Reply{Usage: response.UsageMetadata.usage()}, err
+		}
+		return nil, err
+	}
+	if reason := response.PromptFeedback.BlockReason; reason != "" {
+		return nil, fmt.Errorf("prompt blocked: %s", reason)
+	}
+	if len(response.Candidates) == 0 {
+		return nil, fmt.Errorf("no response from API")
+	}
+	candidate := response.Candidates[0]
+	log.Printf("[Gemini] Received response: id=%s finish_reason=%s parts=%d", response.ResponseID, candidate.FinishReason, len(candidate.Content.Parts))
+
+	reply := &Reply{Usage: response.UsageMetadata.usage()}
+	var text []string
+	for i, part := range candidate.Content.Parts {
+		switch {
+		case part.FunctionCall != nil:
+			// Older models leave out call IDs; make one up to match the
+			// result to the call, but only send back the API's own
+			call := part.FunctionCall
+			id := call.ID
+			if id == "" {
+				id = fmt.Sprintf("call_%d_%d", len(t.contents), i)
+			} else {
+				t.apiIDs[id] = true
+			}
+			reply.ToolCalls = append(reply.ToolCalls, ToolCall{
+				ID:        id,
+				Name:      call.Name,
+				Arguments: string(toolInput(string(call.Args))),
+			})
+		case part.Text != "" && !part.Thought:
+			text = append(text, part.Text)
+		}
+	}
+	reply.Text = strings.Join(text, "")
+	if len(reply.ToolCalls) == 0 && reply.Text == "" && candidate.FinishReason != "STOP" && candidate.FinishReason != "" {
+		return nil, fmt.Errorf("no answer, finish reason %s", candidate.FinishReason)
+	}
+	if candidate.FinishReason == "MAX_TOKENS" && len(reply.ToolCalls) == 0 && reply.Text != "" {
+		reply.Text += fmt.Sprintf("\n\n[Answer cut off at %d output tokens; raise GPT5_PRO_MCP_MAX_OUTPUT_TOKENS for longer answers]", request.GenerationConfig.MaxOutputTokens)
+	}
+
+	if len(candidate.Content.Parts) > 0 {
+		t.contents = append(t.contents, geminiContent{Role: "model", Parts: candidate.Content.Parts})
+		t.complete = len(reply.ToolCalls) == 0
+	}
+	return reply, nil
+}
+
+// AddToolResult adds a functionResponse part answering one of the reply's
+// function calls, as its "error" rather than its "result" if the tool
+// failed. The results of one reply share a single user content.
+func (t *geminiTurn) AddToolResult(call ToolCall, output string, failed bool) {
+	key := "result"
+	if failed {
+		key = "error"
+	}
+	response := &geminiFunctionResponse{Name: call.Name, Response: map[string]any{key: output}}
+	if t.apiIDs[call.ID] {
+		response.ID = call.ID
+	}
+	part := geminiPart{FunctionResponse: response}
+	if last := &t.contents[len(t.contents)-1]; last.Role == "user" {
+		last.Parts = append(last.Parts, part)
+		return
+	}
+	t.contents = append(t.contents, geminiContent{Role: "user", Parts: []geminiPart{part}})
+}
+
+// Save records the history once the turn has its answer. A history ending
+// in unanswered function calls would be rejected by the next request, so
+// until then the conversation keeps its previous history.
+func (t *geminiTurn) Save(state *conversation.State) {
+	if !t.complete {
+		return
+	}
+	history, err := json.Marshal(t.contents)
+	if err != nil {
+		log.Printf("[Gemini] WARNING: Failed to save conversation history: %v", err)
+		return
+	}
+	state.History = history
+}
+
+// generateContent sends a generateContent request. When streaming, answer
+// text is forwarded to the client as it arrives and the chunks are merged
+// into one response; a stream that breaks off returns the response so far
+// with its error, for its usage.
+func (p *GeminiProvider) generateContent(ctx context.Context, model string, request geminiRequest, progress *progressReporter) (*geminiResponse, error) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint := p.baseURL + "/models/" + url.PathEscape(model) + ":generateContent"
+	if p.config.Stream {
+		endpoint = p.baseURL + "/models/" + url.PathEscape(model) + ":streamGenerateContent?alt=sse"
+	}
+	header := http.Header{}
+	header.Set("X-Goog-Api-Key", p.config.GeminiAPIKey)
+	resp, err := postJSON(ctx, p.http, endpoint, header, body, progress, geminiAPIError)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if !p.config.Stream {
+		var response geminiResponse
+		if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+			return nil, fmt.Errorf("invalid response: %w", err)
+		}
+		return &response, nil
+	}
+
+	progress.StartAnswer()
+	defer progress.FlushPartial()
+	return readGeminiStream(resp.Body, progress)
+}
+
+// readGeminiStream merges the chunks of a streamed response, forwarding
+// answer text to progress as it arrives. Consecutive text parts of the same
+// kind are joined, so the history holds whole parts.
+func readGeminiStream(body io.Reader, progress *progressReporter) (*geminiResponse, error) {
+	var response *geminiResponse
+	err := readSSE(body, func(data []byte) error {
+		var chunk geminiResponse
+		if err := json.Unmarshal(data, &chunk); err != nil {
+			return fmt.Errorf("invalid stream chunk: %w", err)
+		}
+		if response == nil {
+			response = &geminiResponse{ResponseID: chunk.ResponseID}
+		}
+		response.UsageMetadata = chunk.UsageMetadata
+		if chunk.PromptFeedback.BlockReason != "" {
+			response.PromptFeedback = chunk.PromptFeedback
+		}
+		if len(chunk.Candidates) == 0 {
+			return nil
+		}
+		if len(response.Candidates) == 0 {
+			response.Candidates = slices.Clone(chunk.Candidates[:1])
+			response.Candidates[0].Content.Parts = nil
+		}
+
+		candidate := &response.Candidates[0]
+		if reason := chunk.Candidates[0].FinishReason; reason != "" {
+			candidate.FinishReason = reason
+		}
+		for _, part := range chunk.Candidates[0].Content.Parts {
+			if part.FunctionCall != nil {
+				progress.Report("Model is calling %s", part.FunctionCall.Name)
+			} else if part.Text != "" && !part.Thought {
+				progress.Partial(part.Text)
+			}
+
+			parts := candidate.Content.Parts
+			if n := len(parts); n > 0 && part.FunctionCall == nil && part.Text != "" && part.ThoughtSignature == "" &&
+				parts[n-1].FunctionCall == nil && parts[n-1].Text != "" && parts[n-1].Thought == part.Thought {
+				parts[n-1].Text += part.Text
+				continue
+			}
+			candidate.Content.Parts = append(parts, part)
+		}
+		if candidate.Content.Role == "" {
+			candidate.Content.Role = chunk.Candidates[0].Content.Role
+		}
+		return nil
+	})
+	if err != nil {
+		return response, err
+	}
+	if response == nil {
+		return nil, fmt.Errorf("stream ended without a response")
+	}
+	return response, nil
+}
+
+// geminiAPIError turns a failed request's status and body into an error
+func geminiAPIError(status int, body []byte) error {
+	var apiErr geminiError
+	if json.Unmarshal(body, &apiErr) == nil && apiErr.Error.Message != "" {
+		return fmt.Errorf("%s (HTTP %d): %s", apiErr.Error.Status, status, apiErr.Error.Message)
+	}
+	return fmt.Errorf("HTTP %d: %s", status, strings.TrimSpace(string(body)))
+}
+
+// buildTools maps the file tools to function declarations
+func (p *GeminiProvider) buildTools() []geminiFunctionDeclaration {
+	var declarations []geminiFunctionDeclaration
+	for _, tool := range fileTools() {
+		declarations = append(declarations, geminiFunctionDeclaration{
+			Name:        tool.Name,
+			Description: tool.Description,
+			Parameters:  geminiSchema(tool.Parameters),
+		})
+	}
+	return declarations
+}
+
+// geminiSchema converts a JSON schema to the OpenAPI subset Gemini takes,
+// which spells types in upper case
+func geminiSchema(schema map[string]any) map[string]any {
+	converted := make(map[string]any, len(schema))
+	for key, value := range schema {
+		switch value := value.(type) {
+		case string:
+			if key == "type" {
+				converted[key] = strings.ToUpper(value)
+			} else {
+				converted[key] = value
+			}
+		case map[string]any:
+			converted[key] = geminiSchema(value)
+		default:
+			converted[key] = value
+		}
+	}
+	return converted
+}
@@ -0,0 +1,322 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/lox/gpt-5-pro-mcp/internal/config"
+	"github.com/lox/gpt-5-pro-mcp/internal/conversation"
+	"github.com/lox/gpt-5-pro-mcp/internal/usage"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// Recorded streamGenerateContent streams: a reply that thinks, says
+// something and calls read_file, then the answer, partly from the cache
+const (
+	geminiFunctionCallStream = `data: {"candidates": [{"content": {"parts": [{"text": "The user wants main.go.", "thought": true}],"role": "model"}}],"usageMetadata": {"promptTokenCount": 1200},"responseId": "resp_01"}
+
+data: {"candidates": [{"content": {"parts": [{"text": "Let me read "}],"role": "model"}}],"usageMetadata": {"promptTokenCount": 1200},"responseId": "resp_01"}
+
+data: {"candidates": [{"content": {"parts": [{"text": "the file."}],"role": "model"}}],"usageMetadata": {"promptTokenCount": 1200},"responseId": "resp_01"}
+
+data: {"candidates": [{"content": {"parts": [{"functionCall": {"id": "fc_01", "name": "read_file","args": {"path": "main.go"}},"thoughtSignature": "c2ln"}],"role": "model"},"finishReason": "STOP"}],"usageMetadata": {"promptTokenCount": 1200,"candidatesTokenCount": 20,"thoughtsTokenCount": 100},"responseId": "resp_01"}
+
+`
+	geminiAnswerStream = `data: {"candidates": [{"content": {"parts": [{"text": "main.go starts "}],"role": "model"}}],"usageMetadata": {"promptTokenCount": 1300,"cachedContentTokenCount": 1024},"responseId": "resp_02"}
+
+data: {"candidates": [{"content": {"parts": [{"text": "the MCP server."}],"role": "model"},"finishReason": "STOP"}],"usageMetadata": {"promptTokenCount": 1300,"cachedContentTokenCount": 1024,"candidatesTokenCount": 12},"responseId": "resp_02"}
+
+`
+)
+
+// geminiServer replays streams, one per request, and records the requests
+// it was sent
+func geminiServer(t *testing.T, streams ...string) (*httptest.Server, *[]geminiRequest) {
+	t.Helper()
+	var requests []geminiRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/models/gemini-2.5-pro:streamGenerateContent" || r.URL.Query().Get("alt") != "sse" ||
+			r.Header.Get("X-Goog-Api-Key") != "test-key" {
+			http.Error(w, `{"error":{"code":400,"message":"bad request","status":"INVALID_ARGUMENT"}}`, http.StatusBadRequest)
+			return
+		}
+		var request geminiRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		requests = append(requests, request)
+		if len(requests) > len(streams) {
+			http.Error(w, `{"error":{"code":400,"message":"unexpected request","status":"INVALID_ARGUMENT"}}`, http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		io.WriteString(w, streams[len(requests)-1])
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func newTestGeminiProvider(url string) *GeminiProvider {
+	return NewGeminiProvider(&config.Config{
+		GeminiAPIKey:    "test-key",
+		GeminiBaseURL:   url,
+		MaxOutputTokens: 4096,
+		Stream:          true,
+	})
+}
+
+func TestGeminiFunctionCallRoundTrip(t *testing.T) {
+	server, requests := geminiServer(t, geminiFunctionCallStream, geminiAnswerStream)
+	provider := newTestGeminiProvider(server.URL)
+	settings := callSettings{Model: "gemini-2.5-pro", ReasoningEffort: "low"}
+	progress := newProgressReporter(context.Background(), mcp.CallToolRequest{})
+
+	var state conversation.State
+	turn := provider.NewTurn(state, "system prompt", "What does main.go do?")
+
+	reply, err := turn.Send(context.Background(), settings, progress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply.Text != "Let me read the file." {
+		t.Errorf("text = %q", reply.Text)
+	}
+	if len(reply.ToolCalls) != 1 {
+		t.Fatalf("got %d tool calls, want 1", len(reply.ToolCalls))
+	}
+	call := reply.ToolCalls[0]
+	if call.ID != "fc_01" || call.Name != "read_file" || call.Arguments != `{"path": "main.go"}` {
+		t.Errorf("tool call = %+v", call)
+	}
+	// Thinking tokens count as output
+	want := usage.Usage{InputTokens: 1200, OutputTokens: 120, ReasoningTokens: 100}
+	if reply.Usage != want {
+		t.Errorf("usage = %+v, want %+v", reply.Usage, want)
+	}
+
+	// The history isn't saved while the function call is unanswered
+	turn.Save(&state)
+	if state.History != nil {
+		t.Errorf("saved history ending in a function call: %s", state.History)
+	}
+
+	turn.AddToolResult(call, "package main", false)
+	reply, err = turn.Send(context.Background(), settings, progress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply.Text != "main.go starts the MCP server." || len(reply.ToolCalls) != 0 {
+		t.Errorf("answer = %q with %d tool calls", reply.Text, len(reply.ToolCalls))
+	}
+	want = usage.Usage{InputTokens: 1300, CachedInputTokens: 1024, OutputTokens: 12}
+	if reply.Usage != want {
+		t.Errorf("usage = %+v, want %+v", reply.Usage, want)
+	}
+
+	first := (*requests)[0]
+	if first.SystemInstruction == nil || first.SystemInstruction.Parts[0].Text != "system prompt" {
+		t.Errorf("system instruction = %+v", first.SystemInstruction)
+	}
+	if config := first.GenerationConfig; config.ThinkingConfig == nil || config.ThinkingConfig.ThinkingBudget != 2048 ||
+		config.MaxOutputTokens != 4096+2048 {
+		t.Errorf("generation config = %+v, want a low thinking budget on top of the output cap", config)
+	}
+
+	// The second request sends the merged model parts back, with the
+	// function call answered under its ID
+	contents := (*requests)[1].Contents
+	if len(contents) != 3 {
+		t.Fatalf("second request has %d contents, want 3", len(contents))
+	}
+	model, result := contents[1], contents[2]
+	if model.Role != "model" || len(model.Parts) != 3 || !model.Parts[0].Thought ||
+		model.Parts[1].Text != "Let me read the file." || model.Parts[2].FunctionCall == nil ||
+		model.Parts[2].ThoughtSignature != "c2ln" {
+		t.Errorf("model content = %+v", model)
+	}
+	wantResult := &geminiFunctionResponse{ID: "fc_01", Name: "read_file", Response: map[string]any{"result": "package main"}}
+	if result.Role != "user" || len(result.Parts) != 1 || !reflect.DeepEqual(result.Parts[0].FunctionResponse, wantResult) {
+		t.Errorf("function response content = %+v", result)
+	}
+
+	turn.Save(&state)
+	var history []geminiContent
+	if err := json.Unmarshal(state.History, &history); err != nil || len(history) != 4 {
+		t.Fatalf("saved history = %s (%v), want 4 contents", state.History, err)
+	}
+}
+
+func TestGeminiFailedCallWithoutID(t *testing.T) {
+	// Older models leave out the call ID
+	stream := strings.Replace(geminiFunctionCallStream, `"id": "fc_01", `, "", 1)
+	server, requests := geminiServer(t, stream, geminiAnswerStream)
+	provider := newTestGeminiProvider(server.URL)
+	settings := callSettings{Model: "gemini-2.5-pro"}
+	progress := newProgressReporter(context.Background(), mcp.CallToolRequest{})
+
+	turn := provider.NewTurn(conversation.State{}, "system prompt", "What does main.go do?")
+	reply, err := turn.Send(context.Background(), settings, progress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	call := reply.ToolCalls[0]
+	if call.ID == "" {
+		t.Fatal("function call without an ID")
+	}
+	turn.AddToolResult(call, "Error: main.go not found", true)
+	if _, err := turn.Send(context.Background(), settings, progress); err != nil {
+		t.Fatal(err)
+	}
+
+	// The made-up ID stays ours, and the failure is reported as an error
+	got := (*requests)[1].Contents[2].Parts[0].FunctionResponse
+	want := &geminiFunctionResponse{Name: "read_file", Response: map[string]any{"error": "Error: main.go not found"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("function response = %+v, want %+v", got, want)
+	}
+	if (*requests)[0].GenerationConfig.ThinkingConfig != nil {
+		t.Error("thinking budget set without a reasoning effort")
+	}
+}
+
+func TestReadGeminiStream(t *testing.T) {
+	chunk := func(parts, extra string) string {
+		return `data: {"candidates": [{"content": {"parts": [` + parts + `],"role": "model"}` + extra + `}],"responseId": "resp_01"}` + "\n\n"
+	}
+	tests := []struct {
+		name    string
+		stream  string
+		parts   []geminiPart
+		finish  string
+		wantErr string
+	}{
+		{
+			name:   "text joined across chunks",
+			stream: chunk(`{"text": "a"}`, "") + chunk(`{"text": "b"}`, "") + chunk(`{"text": "c"}`, `,"finishReason": "STOP"`),
+			parts:  []geminiPart{{Text: "abc"}},
+			finish: "STOP",
+		},
+		{
+			name:   "thoughts kept apart from text",
+			stream: chunk(`{"text": "hmm", "thought": true}`, "") + chunk(`{"text": " yes", "thought": true}`, "") + chunk(`{"text": "Answer"}`, ""),
+			parts:  []geminiPart{{Text: "hmm yes", Thought: true}, {Text: "Answer"}},
+		},
+		{
+			name:   "signed parts stay whole",
+			stream: chunk(`{"text": "a"}`, "") + chunk(`{"text": "b", "thoughtSignature": "c2ln"}`, ""),
+			parts:  []geminiPart{{Text: "a"}, {Text: "b", ThoughtSignature: "c2ln"}},
+		},
+		{
+			name: "function calls stay whole",
+			stream: chunk(`{"functionCall": {"name": "read_file", "args": {"path": "a"}}}`, "") +
+				chunk(`{"functionCall": {"name": "read_file", "args": {"path": "b"}}}`, `,"finishReason": "STOP"`),
+			parts: []geminiPart{
+				{FunctionCall: &geminiFunctionCall{Name: "read_file", Args: json.RawMessage(`{"path": "a"}`)}},
+				{FunctionCall: &geminiFunctionCall{Name: "read_file", Args: json.RawMessage(`{"path": "b"}`)}},
+			},
+			finish: "STOP",
+		},
+		{
+			name:    "malformed chunk keeps what came before",
+			stream:  chunk(`{"text": "partial"}`, "") + "data: {\"candidates\": [\n\n",
+			parts:   []geminiPart{{Text: "partial"}},
+			wantErr: "invalid stream chunk",
+		},
+		{
+			name:    "empty stream",
+			stream:  ": keep-alive\n\n",
+			wantErr: "stream ended without a response",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			progress := newProgressReporter(context.Background(), mcp.CallToolRequest{})
+			response, err := readGeminiStream(strings.NewReader(tt.stream), progress)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if tt.parts == nil {
+				if response != nil {
+					t.Errorf("response = %+v, want none", response)
+				}
+				return
+			}
+			candidate := response.Candidates[0]
+			if !reflect.DeepEqual(candidate.Content.Parts, tt.parts) {
+				t.Errorf("parts = %+v, want %+v", candidate.Content.Parts, tt.parts)
+			}
+			if candidate.FinishReason != tt.finish || candidate.Content.Role != "model" || response.ResponseID != "resp_01" {
+				t.Errorf("candidate = %+v of %s", candidate, response.ResponseID)
+			}
+		})
+	}
+}
+
+func TestGeminiPromptBlocked(t *testing.T) {
+	server, _ := geminiServer(t, `data: {"promptFeedback": {"blockReason": "SAFETY"},"usageMetadata": {"promptTokenCount": 10}}`+"\n\n")
+	provider := newTestGeminiProvider(server.URL)
+	progress := newProgressReporter(context.Background(), mcp.CallToolRequest{})
+
+	turn := provider.NewTurn(conversation.State{}, "system prompt", "prompt")
+	_, err := turn.Send(context.Background(), callSettings{Model: "gemini-2.5-pro"}, progress)
+	if err == nil || !strings.Contains(err.Error(), "SAFETY") {
+		t.Errorf("err = %v, want the block reason", err)
+	}
+}
+
+func TestGeminiAPIError(t *testing.T) {
+	server, _ := geminiServer(t)
+	provider := newTestGeminiProvider(server.URL)
+	progress := newProgressReporter(context.Background(), mcp.CallToolRequest{})
+
+	turn := provider.NewTurn(conversation.State{}, "system prompt", "prompt")
+	_, err := turn.Send(context.Background(), callSettings{Model: "gemini-2.5-pro"}, progress)
+	if err == nil || err.Error() != "INVALID_ARGUMENT (HTTP 400): unexpected request" {
+		t.Errorf("err = %v", err)
+	}
+}
+
+func TestGeminiSchema(t *testing.T) {
+	schema := map[string]any{
+		"type":     "object",
+		"required": []string{"path"},
+		"properties": map[string]any{
+			"path":  map[string]any{"type": "string", "description": "A path"},
+			"depth": map[string]any{"type": "integer", "minimum": 1},
+			"globs": map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+		},
+	}
+	want := map[string]any{
+		"type":     "OBJECT",
+		"required": []string{"path"},
+		"properties": map[string]any{
+			"path":  map[string]any{"type": "STRING", "description": "A path"},
+			"depth": map[string]any{"type": "INTEGER", "minimum": 1},
+			"globs": map[string]any{"type": "ARRAY", "items": map[string]any{"type": "STRING"}},
+		},
+	}
+	if got := geminiSchema(schema); !reflect.DeepEqual(got, want) {
+		t.Errorf("geminiSchema() = %v, want %v", got, want)
+	}
+	if schema["type"] != "object" {
+		t.Error("geminiSchema changed its input")
+	}
+
+	// Every file tool converts to a declaration with an upper-case type
+	for _, declaration := range newTestGeminiProvider("").buildTools() {
+		if declaration.Parameters["type"] != "OBJECT" {
+			t.Errorf("%s parameters have type %v", declaration.Name, declaration.Parameters["type"])
+		}
+	}
+}
@@ -2,17 +2,19 @@ package client
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"log"
 	"os"
-	"sync"
+	"strings"
 
+	"github.com/lox/gpt-5-pro-mcp/internal/config"
 	contextpkg "github.com/lox/gpt-5-pro-mcp/internal/context"
+	"github.com/lox/gpt-5-pro-mcp/internal/conversation"
+	"github.com/lox/gpt-5-pro-mcp/internal/fileops"
+	"github.com/lox/gpt-5-pro-mcp/internal/usage"
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/openai/openai-go"
 	"github.com/openai/openai-go/option"
-	"github.com/openai/openai-go/responses"
 )
 
 func init() {
@@ -23,190 +25,281 @@ func init() {
 }
 
 const (
-	defaultModel  = "gpt-5-pro"
 	maxIterations = 10 // Limit function call iterations
 )
 
 // FileOps defines the interface for file operations
 type FileOps interface {
-	ReadFile(ctx context.Context, path string) (string, error)
-	GrepFiles(ctx context.Context, pattern, path string, ignoreCase bool) (string, error)
+	ReadFile(ctx context.Context, path string, opts fileops.ReadOptions) (string, error)
+	GrepFiles(ctx context.Context, pattern, path string, opts fileops.GrepOptions) (string, error)
+	ListDirectory(ctx context.Context, path string, depth int) (string, error)
+	FindFiles(ctx context.Context, pattern, dir string, maxResults int) (string, error)
+	FindDefinition(ctx context.Context, symbol, dir string) (string, error)
+	FindReferences(ctx context.Context, symbol, dir string) (string, error)
+	FileOutline(ctx context.Context, path string) (string, error)
+	GitDiff(ctx context.Context, opts fileops.GitDiffOptions) (string, error)
+	GitLog(ctx context.Context, path, ref string, count int) (string, error)
+	GitBlame(ctx context.Context, path string, startLine, endLine int) (string, error)
+	GitShow(ctx context.Context, rev, path string) (string, error)
+	GitChangeContext(ctx context.Context, opts fileops.GitDiffOptions, lines int) (string, error)
+	Roots(ctx context.Context) []string
 }
 
-// GPT5ProClient handles communication with OpenAI's Responses API
+// GPT5ProClient runs consultations on a Provider and serves the MCP tools
 type GPT5ProClient struct {
-	client     *openai.Client
-	fileOps    FileOps
-	responseID string
-	baseURL    string
-	mu         sync.RWMutex
-	chatClient *ChatCompletionsClient
-	useResponsesAPI bool
+	config        *config.Config
+	fileOps       FileOps
+	conversations *conversation.Store
+	meter         *usage.Meter
+	provider      Provider           // Default provider
+	routes        []providerRoute    // Providers for models the default doesn't serve
+	responses     *ResponsesProvider // set when the Responses API is in use, for raw response IDs
+	jobs          *jobRegistry
 }
 
-// New creates a new GPT5ProClient instance
-// If useResponsesAPI is false, it will use Chat Completions API instead
-func New(apiKey string, baseURL string, fileOps FileOps, useResponsesAPI bool) *GPT5ProClient {
-	opts := []option.RequestOption{option.WithAPIKey(apiKey)}
-
-	// Add custom base URL if provided (for OpenRouter or other providers)
-	if baseURL != "" {
-		opts = append(opts, option.WithBaseURL(baseURL))
-		log.Printf("Initializing client with custom base URL: %s", baseURL)
-		if useResponsesAPI {
-			log.Printf("WARNING: Using Responses API which may not be compatible with all providers")
-		}
+// providerRoute sends models whose name starts with prefix to provider
+type providerRoute struct {
+	prefix   string
+	provider Provider
+}
+
+// New creates a new GPT5ProClient instance. Each OpenAI-compatible endpoint
+// uses the API its setting picks; in auto mode OpenAI gets the Responses
+// API, OpenRouter Chat Completions, and Azure and custom endpoints the
+// Responses API only if a probe on first use finds it.
+// When several providers are configured, claude-* models go to Anthropic,
+// gemini-* models to Gemini, ollama/* models to Ollama, local/* models to
+// the local server and gpt-* models to OpenAI, whichever is the default.
+func New(cfg *config.Config, fileOps FileOps, conversations *conversation.Store, meter *usage.Meter) *GPT5ProClient {
+	gpt5ProClient := &GPT5ProClient{
+		config:        cfg,
+		fileOps:       fileOps,
+		conversations: conversations,
+		meter:         meter,
+		jobs:          newJobRegistry(),
 	}
 
-	client := openai.NewClient(opts...)
+	var openAI, anthropic, gemini, ollama, local Provider
+	if cfg.APIKey != "" {
+		opts := []option.RequestOption{option.WithAPIKey(cfg.APIKey)}
+		endpoint := cfg.BaseURL
+		if cfg.AzureEndpoint != "" {
+			opts = azureOptions(cfg)
+			endpoint = cfg.AzureEndpoint
+		} else if cfg.BaseURL != "" {
+			// Add custom base URL if provided (for OpenRouter or other providers)
+			opts = append(opts, option.WithBaseURL(cfg.BaseURL))
+			log.Printf("Initializing client with custom base URL: %s", cfg.BaseURL)
+		}
+		client := openai.NewClient(opts...)
 
-	gpt5ProClient := &GPT5ProClient{
-		client:          &client,
-		fileOps:         fileOps,
-		baseURL:         baseURL,
-		useResponsesAPI: useResponsesAPI,
+		api, setting := cfg.EndpointAPI()
+		if api == config.APIAuto && cfg.OpenRouter {
+			// OpenRouter's Responses API can't continue conversations by response ID
+			api = config.APIChat
+		}
+		if api != config.APIChat {
+			gpt5ProClient.responses = NewResponsesProvider(&client, cfg)
+			if endpoint != "" {
+				gpt5ProClient.responses.setting = setting
+			}
+		}
+
+		switch {
+		case api == config.APIChat:
+			log.Printf("Using Chat Completions API")
+			openAI = NewChatCompletionsProvider(&client, cfg)
+		case api == config.APIAuto && endpoint != "":
+			openAI = newProbedProvider(endpoint, gpt5ProClient.responses, NewChatCompletionsProvider(&client, cfg))
+		default:
+			openAI = gpt5ProClient.responses
+		}
+	}
+	if cfg.AnthropicAPIKey != "" {
+		anthropic = NewAnthropicProvider(cfg)
+	}
+	if cfg.GeminiAPIKey != "" {
+		gemini = NewGeminiProvider(cfg)
+	}
+	if cfg.OllamaHost != "" {
+		ollama = NewOllamaProvider(cfg)
+	}
+	if cfg.LocalBaseURL != "" {
+		local = NewLocalProvider(cfg)
 	}
 
-	// If not using Responses API, create Chat Completions client
-	if !useResponsesAPI {
-		log.Printf("Using Chat Completions API for compatibility")
-		gpt5ProClient.chatClient = NewChatCompletions(&client, baseURL, fileOps)
+	switch cfg.Provider {
+	case config.ProviderAnthropic:
+		gpt5ProClient.provider = anthropic
+	case config.ProviderGemini:
+		gpt5ProClient.provider = gemini
+	case config.ProviderOllama:
+		gpt5ProClient.provider = ollama
+	case config.ProviderLocal:
+		gpt5ProClient.provider = local
+	default:
+		gpt5ProClient.provider = openAI
+	}
+	for _, route := range []providerRoute{
+		{"claude-", anthropic}, {"gemini-", gemini}, {"ollama/", ollama}, {"local/", local}, {"gpt-", openAI},
+	} {
+		if route.provider != nil && route.provider != gpt5ProClient.provider {
+			gpt5ProClient.routes = append(gpt5ProClient.routes, route)
+		}
 	}
 
 	return gpt5ProClient
 }
 
-// Handle processes a consultation request using appropriate API (Responses or Chat Completions)
-func (c *GPT5ProClient) Handle(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-	// Route to Chat Completions if configured
-	if !c.useResponsesAPI && c.chatClient != nil {
-		return c.chatClient.Handle(ctx, request)
+// providerFor picks the provider that serves model. An endpoint that is
+// probed for its API is settled once here, so a call uses one API throughout.
+func (c *GPT5ProClient) providerFor(model string) Provider {
+	provider := c.provider
+	for _, route := range c.routes {
+		if strings.HasPrefix(model, route.prefix) {
+			provider = route.provider
+			break
+		}
 	}
+	if probed, ok := provider.(*probedProvider); ok {
+		return probed.provider()
+	}
+	return provider
+}
 
-	// Otherwise use Responses API
+// Handle processes a consultation request on the configured provider
+func (c *GPT5ProClient) Handle(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	prompt, err := request.RequireString("prompt")
 	if err != nil {
 		log.Printf("ERROR: Failed to get prompt: %v", err)
 		return mcp.NewToolResultError(err.Error()), nil
 	}
 
+	settings, err := resolveSettings(c.config, request)
+	if err != nil {
+		log.Printf("ERROR: Invalid model settings: %v", err)
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	provider := c.providerFor(settings.Model)
 	continueConversation := request.GetBool("continue", true)
+	conversationKey := c.conversations.KeyFor(ctx, request.GetString("conversation_id", ""))
 	gatheredContext := request.GetString("gathered_context", "")
 	autoGatherContext := request.GetBool("auto_gather_context", true)
 
-	log.Printf("[ResponsesAPI] Received request: prompt_len=%d continue=%v auto_gather=%v has_context=%v",
-		len(prompt), continueConversation, autoGatherContext, gatheredContext != "")
+	log.Printf("Received request: api=%s prompt_len=%d continue=%v conversation=%s auto_gather=%v has_context=%v",
+		provider.Name(), len(prompt), continueConversation, conversationKey, autoGatherContext, gatheredContext != "")
 
 	// Phase 1: Context gathering logic
 	if autoGatherContext && gatheredContext == "" {
-		log.Printf("[ResponsesAPI] Analyzing prompt for code references...")
+		log.Printf("Analyzing prompt for code references...")
 		requirements := contextpkg.AnalyzePromptForReferences(prompt)
 
 		if requirements.HasCodeRefs {
-			log.Printf("[ResponsesAPI] Found code references: files=%d functions=%d",
+			log.Printf("Found code references: files=%d functions=%d",
 				len(requirements.Files), len(requirements.Functions))
 
 			contextRequest := contextpkg.BuildContextRequest(requirements)
 			responseText := contextpkg.FormatContextRequestAsText(contextRequest)
 
-			log.Printf("[ResponsesAPI] Returning context request to Claude Code")
+			log.Printf("Returning context request to Claude Code")
 			return mcp.NewToolResultText(responseText), nil
 		}
 
-		log.Printf("[ResponsesAPI] No code references found, proceeding without context")
+		log.Printf("No code references found, proceeding without context")
 	}
 
 	// Phase 2: Enrich prompt with gathered context if provided
+	question := prompt
 	if gatheredContext != "" {
-		log.Printf("[ResponsesAPI] Enriching prompt with gathered context: len=%d", len(gatheredContext))
+		log.Printf("Enriching prompt with gathered context: len=%d", len(gatheredContext))
 		enrichedPrompt, err := contextpkg.EnrichPromptWithContext(prompt, gatheredContext)
 		if err != nil {
-			log.Printf("[ResponsesAPI] ERROR: Failed to enrich prompt: %v", err)
+			log.Printf("ERROR: Failed to enrich prompt: %v", err)
 			return mcp.NewToolResultError(fmt.Sprintf("Failed to process gathered_context: %v", err)), nil
 		}
 		prompt = enrichedPrompt
-		log.Printf("[ResponsesAPI] Prompt enriched: new_len=%d", len(prompt))
+		log.Printf("Prompt enriched: new_len=%d", len(prompt))
 	}
 
-	c.mu.Lock()
-	defer c.mu.Unlock()
+	unlock := c.conversations.Lock(conversationKey)
 
 	// Start fresh if continue is false
+	state, _ := c.conversations.Get(conversationKey)
 	if !continueConversation {
 		log.Printf("Starting fresh conversation")
-		c.responseID = ""
-	} else if c.responseID != "" {
-		log.Printf("Continuing conversation: response_id=%s", c.responseID)
+		state.Reset()
+	} else if state.Provider != "" && state.Provider != provider.Name() {
+		// Each API keeps history in its own form; the new one starts afresh
+		log.Printf("Conversation was held by %s, starting a new history on %s", state.Provider, provider.Name())
+		state.ResetHistory()
 	}
+	state.Record(question)
 
-	// Build the request parameters
-	params := responses.ResponseNewParams{
-		Model:        defaultModel,
-		Instructions: openai.Opt(buildSystemPrompt()),
-		Tools:        c.buildTools(),
+	// Refuse up front if the prompt alone would break a budget
+	systemPrompt := buildSystemPrompt(c.fileOps.Roots(ctx))
+	if result := checkBudget(c.meter, settings, len(systemPrompt)+len(prompt), usage.Usage{}, state); result != nil {
+		unlock()
+		return result, nil
 	}
 
-	// Add input message
-	inputItems := responses.ResponseInputParam{
-		responses.ResponseInputItemParamOfMessage(prompt, responses.EasyInputMessageRoleUser),
-	}
-	params.Input = responses.ResponseNewParamsInputUnion{
-		OfInputItemList: inputItems,
-	}
+	turn := provider.NewTurn(state, systemPrompt, prompt)
 
-	// Add previous response ID if continuing
-	if continueConversation && c.responseID != "" {
-		params.PreviousResponseID = openai.Opt(c.responseID)
+	// Return a job handle right away if the caller doesn't want to wait
+	if !request.GetBool("wait", true) {
+		return c.startJob(ctx, conversationKey, state, settings, provider, turn, unlock), nil
 	}
+	defer unlock()
 
-	// Call OpenAI Responses API
-	log.Printf("Calling OpenAI Responses API: model=%s", defaultModel)
-	response, err := c.client.Responses.New(ctx, params)
-	if err != nil {
-		log.Printf("ERROR: OpenAI API call failed: %v", err)
-
-		// Provide helpful error message for OpenRouter users
-		if c.baseURL != "" {
-			return mcp.NewToolResultError(fmt.Sprintf(
-				"API error: %v\n\n"+
-					"COMPATIBILITY NOTE: This MCP server uses OpenAI's Responses API (/v1/responses) which is NOT supported by OpenRouter.\n"+
-					"OpenRouter only supports the Chat Completions API (/v1/chat/completions).\n\n"+
-					"Solutions:\n"+
-					"1. Use OpenAI API directly (set OPENAI_API_KEY instead of OPENROUTER_API_KEY)\n"+
-					"2. Wait for a future version with Chat Completions support\n"+
-					"3. Use a provider that supports the Responses API",
-				err,
-			)), nil
-		}
+	return c.consult(ctx, conversationKey, state, settings, provider, turn, newProgressReporter(ctx, request)), nil
+}
 
-		return mcp.NewToolResultError(fmt.Sprintf("OpenAI API error: %v", err)), nil
-	}
+// consult runs a turn through the tool loop: it sends the prompt, executes
+// the model's tool calls until it produces a final answer, and saves the
+// conversation after every round-trip so interrupted calls still count
+func (c *GPT5ProClient) consult(ctx context.Context, conversationKey string, state conversation.State, settings callSettings, provider Provider, turn Turn, progress *progressReporter) *mcp.CallToolResult {
+	ctx, cancel := context.WithTimeout(ctx, settings.Timeout)
+	defer cancel()
 
-	// Save the response ID for conversation continuity
-	c.responseID = response.ID
-	log.Printf("Received response: id=%s status=%s", response.ID, response.Status)
+	api := provider.Name()
+	var spent usage.Usage
 
-	// Handle tool calls in a loop
 	for i := 0; i < maxIterations; i++ {
-		// Check if there are tool calls to execute
-		toolCalls := extractToolCalls(response)
-		log.Printf("Iteration %d: found %d tool calls", i+1, len(toolCalls))
-
-		if len(toolCalls) == 0 {
-			// No more tool calls, extract and return final text response
-			text := extractTextContent(response)
-			log.Printf("No tool calls, returning text response: len=%d", len(text))
-			if text == "" {
+		progress.Report("Iteration %d/%d: consulting %s", i+1, maxIterations, settings.Model)
+		reply, err := turn.Send(ctx, settings, progress)
+		if err != nil {
+			if reply != nil {
+				chargePartial(c.meter, settings.Model, reply.Usage, &spent, &state)
+				c.conversations.Put(conversationKey, state)
+			}
+			if ctx.Err() != nil {
+				return progress.Interrupted(ctx, settings.Timeout, i+1)
+			}
+			log.Printf("ERROR: %s call failed: %v", api, err)
+			return mcp.NewToolResultError(fmt.Sprintf("%s error: %v", api, err))
+		}
+
+		charge(c.meter, settings.Model, reply.Usage, &spent, &state)
+		turn.Save(&state)
+		state.Provider = api
+		c.conversations.Put(conversationKey, state)
+
+		if len(reply.ToolCalls) == 0 {
+			log.Printf("No tool calls, returning text response: len=%d", len(reply.Text))
+			if reply.Text == "" {
 				log.Printf("ERROR: No text content in response")
-				return mcp.NewToolResultError("No text content in response"), nil
+				return mcp.NewToolResultError("No text content in response")
 			}
-			return mcp.NewToolResultText(text), nil
+			return withUsage(mcp.NewToolResultText(reply.Text), c.meter, c.config.UsageFooter, settings.Model, spent, state.Usage, state.Turns)
 		}
 
 		// Execute tool calls
-		toolOutputs := make(responses.ResponseInputParam, 0, len(toolCalls))
-		for _, toolCall := range toolCalls {
+		log.Printf("Iteration %d: found %d tool calls", i+1, len(reply.ToolCalls))
+		progress.Report("Iteration %d/%d: model requested %d tool calls", i+1, maxIterations, len(reply.ToolCalls))
+		outputChars := 0
+		for _, toolCall := range reply.ToolCalls {
 			log.Printf("Executing tool: name=%s id=%s args_len=%d", toolCall.Name, toolCall.ID, len(toolCall.Arguments))
+			progress.Report("%s", describeToolCall(toolCall.Name, toolCall.Arguments))
 			result, err := c.executeFunction(ctx, toolCall.Name, toolCall.Arguments)
 			if err != nil {
 				log.Printf("Tool execution error: %v", err)
@@ -215,166 +308,55 @@ func (c *GPT5ProClient) Handle(ctx context.Context, request mcp.CallToolRequest)
 				log.Printf("Tool execution success: result_len=%d", len(result))
 			}
 
-			toolOutputs = append(toolOutputs, responses.ResponseInputItemParamOfFunctionCallOutput(toolCall.ID, result))
+			turn.AddToolResult(toolCall, result, err != nil)
+			outputChars += len(result)
 		}
-
-		// Continue the response with tool outputs
-		log.Printf("Continuing with %d tool outputs", len(toolOutputs))
-		params = responses.ResponseNewParams{
-			Model:              defaultModel,
-			PreviousResponseID: openai.Opt(response.ID),
-			Input: responses.ResponseNewParamsInputUnion{
-				OfInputItemList: toolOutputs,
-			},
-			Tools: c.buildTools(),
+		if ctx.Err() != nil {
+			return progress.Interrupted(ctx, settings.Timeout, i+1)
 		}
 
-		response, err = c.client.Responses.New(ctx, params)
-		if err != nil {
-			log.Printf("ERROR: Follow-up API call failed: %v", err)
-			return mcp.NewToolResultError(fmt.Sprintf("OpenAI API error: %v", err)), nil
+		if result := checkBudget(c.meter, settings, outputChars, spent, state); result != nil {
+			return result
 		}
-
-		// Update response ID
-		c.responseID = response.ID
-		log.Printf("Updated response: id=%s status=%s", response.ID, response.Status)
+		progress.Report("Sending %d tool results to %s", len(reply.ToolCalls), settings.Model)
 	}
 
 	log.Printf("ERROR: Max iterations (%d) reached", maxIterations)
-	return mcp.NewToolResultError("Max function call iterations reached"), nil
-}
-
-// buildTools defines the tools available to the model
-func (c *GPT5ProClient) buildTools() []responses.ToolUnionParam {
-	return []responses.ToolUnionParam{
-		responses.ToolParamOfFunction(
-			"read_file",
-			map[string]any{
-				"type": "object",
-				"properties": map[string]any{
-					"path": map[string]any{
-						"type":        "string",
-						"description": "Path to the file to read (supports ~ for home directory)",
-					},
-				},
-				"required": []string{"path"},
-			},
-			false, // strict
-		),
-		responses.ToolParamOfFunction(
-			"grep_files",
-			map[string]any{
-				"type": "object",
-				"properties": map[string]any{
-					"pattern": map[string]any{
-						"type":        "string",
-						"description": "Regular expression pattern to search for",
-					},
-					"path": map[string]any{
-						"type":        "string",
-						"description": "File path or glob pattern (e.g., '*.go', 'src/**/*.js')",
-					},
-					"ignore_case": map[string]any{
-						"type":        "boolean",
-						"description": "Perform case-insensitive search (default: false)",
-					},
-				},
-				"required": []string{"pattern", "path"},
-			},
-			false, // strict
-		),
-	}
+	return mcp.NewToolResultError("Max function call iterations reached")
 }
 
 // executeFunction executes a function call requested by the model
 func (c *GPT5ProClient) executeFunction(ctx context.Context, name, argsJSON string) (string, error) {
-	switch name {
-	case "read_file":
-		var args struct {
-			Path string `json:"path"`
-		}
-		if err := json.Unmarshal([]byte(argsJSON), &args); err != nil {
-			return "", fmt.Errorf("invalid arguments: %w", err)
-		}
-		return c.fileOps.ReadFile(ctx, args.Path)
-
-	case "grep_files":
-		var args struct {
-			Pattern    string `json:"pattern"`
-			Path       string `json:"path"`
-			IgnoreCase bool   `json:"ignore_case"`
-		}
-		if err := json.Unmarshal([]byte(argsJSON), &args); err != nil {
-			return "", fmt.Errorf("invalid arguments: %w", err)
-		}
-		return c.fileOps.GrepFiles(ctx, args.Pattern, args.Path, args.IgnoreCase)
-
-	default:
-		return "", fmt.Errorf("unknown function: %s", name)
-	}
+	return runFileTool(ctx, c.fileOps, name, argsJSON)
 }
 
-// ToolCall represents a function tool call
-type ToolCall struct {
-	ID        string
-	Name      string
-	Arguments string
+// buildSystemPrompt creates the system prompt, telling the model which
+// workspace roots it can read
+func buildSystemPrompt(roots []string) string {
+	return systemPrompt + workspacePrompt(roots)
 }
 
-// extractToolCalls extracts tool calls from a response
-func extractToolCalls(response *responses.Response) []ToolCall {
-	var toolCalls []ToolCall
-
-	log.Printf("Extracting tool calls from %d output items", len(response.Output))
-	for i, item := range response.Output {
-		log.Printf("Output item %d: type=%s", i, item.Type)
-		if item.Type == "function_call" {
-			toolCalls = append(toolCalls, ToolCall{
-				ID:        item.CallID,
-				Name:      item.Name,
-				Arguments: item.Arguments,
-			})
-			log.Printf("Found function call: name=%s id=%s", item.Name, item.CallID)
-		}
+// workspacePrompt describes the workspace roots
+func workspacePrompt(roots []string) string {
+	if len(roots) == 0 {
+		return ""
 	}
 
-	return toolCalls
-}
-
-// extractTextContent extracts text content from a response
-func extractTextContent(response *responses.Response) string {
-	var textParts []string
-
-	log.Printf("Extracting text content from %d output items", len(response.Output))
-	for i, item := range response.Output {
-		log.Printf("Output item %d: type=%s content_items=%d", i, item.Type, len(item.Content))
-		if item.Type == "message" {
-			for j, contentItem := range item.Content {
-				log.Printf("  Content item %d: type=%s", j, contentItem.Type)
-				// The Responses API uses "output_text" not "text"
-				if contentItem.Type == "text" || contentItem.Type == "output_text" {
-					textParts = append(textParts, contentItem.Text)
-					log.Printf("  Found text: len=%d", len(contentItem.Text))
-				}
-			}
+	var b strings.Builder
+	b.WriteString("\n\n**Workspace**:\nThe project you are helping with lives in these directories:\n")
+	for i, root := range roots {
+		if i == 0 {
+			fmt.Fprintf(&b, "- %s (primary)\n", root)
+		} else {
+			fmt.Fprintf(&b, "- %s\n", root)
 		}
 	}
-
-	result := ""
-	for _, part := range textParts {
-		if result != "" {
-			result += "\n"
-		}
-		result += part
-	}
-
-	log.Printf("Extracted %d text parts, total length=%d", len(textParts), len(result))
-	return result
+	b.WriteString("Relative paths given to the file tools are resolved against the primary directory. Files outside these directories cannot be read.")
+	return b.String()
 }
 
-// buildSystemPrompt creates the system prompt
-func buildSystemPrompt() string {
-	return `You are a GPT-5-Pro powered assistant - an expert problem-solving AI consulted for the most challenging and complex problems.
+// systemPrompt is the base system prompt
+const systemPrompt = `You are a GPT-5-Pro powered assistant - an expert problem-solving AI consulted for the most challenging and complex problems.
 
 Your role is to provide deep, systematic analysis through multi-step reasoning:
 
@@ -403,10 +385,18 @@ Your responses should be:
 
 **Available Tools**:
 You have access to the following tools to gather information:
-- read_file: Read the contents of any file from the filesystem
+- read_file: Read numbered lines of a file inside the workspace; page through long files with start_line and end_line
 - grep_files: Search for patterns in files using regex and glob patterns
+- list_directory: Show the tree below a directory with file sizes, to learn the project layout
+- find_files: Find files by name or glob pattern
+- find_definition: Show the source and doc comment of a Go declaration, by Name or Type.Method
+- find_references: List every use of a Go symbol with its position, resolved by type where the module builds
+- file_outline: List the declarations in a Go file with their line ranges and signatures
+- git_diff: Show uncommitted, staged, or between-ref changes
+- git_log: List the commits that touched a file or directory
+- git_blame: Show who last changed each line in a range, and in which commit
+- git_show: Show a commit's message and patch
 
 Use these tools proactively to gather evidence and verify your hypotheses. Don't hesitate to read files or search codebases when it helps your analysis.
 
 You are being consulted because standard approaches have proven insufficient. Bring your full analytical capabilities to bear on each problem.`
-}
@@ -0,0 +1,84 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/lox/gpt-5-pro-mcp/internal/config"
+	"github.com/lox/gpt-5-pro-mcp/internal/conversation"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestEndpointAPISelection(t *testing.T) {
+	tests := []struct {
+		name     string
+		api      string
+		status   int // answer to the probe
+		want     string
+		requests int32
+	}{
+		{"auto probes on first use", config.APIAuto, http.StatusNotFound, "Chat Completions API", 1},
+		{"auto finds the Responses API", config.APIAuto, http.StatusBadRequest, "Responses API", 1},
+		{"responses skips the probe", config.APIResponses, http.StatusNotFound, "Responses API", 0},
+		{"chat skips the probe", config.APIChat, http.StatusBadRequest, "Chat Completions API", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests.Add(1)
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(tt.status)
+				_, _ = w.Write([]byte(`{"error": {"message": "probe"}}`))
+			}))
+			defer server.Close()
+
+			c := New(&config.Config{APIKey: "test", BaseURL: server.URL, OpenAIAPI: tt.api}, nil, nil, nil)
+			if n := requests.Load(); n != 0 {
+				t.Fatalf("New sent %d requests, want none before first use", n)
+			}
+			for range 2 {
+				if got := c.provider.Name(); got != tt.want {
+					t.Errorf("Name() = %q, want %q", got, tt.want)
+				}
+			}
+			if n := requests.Load(); n != tt.requests {
+				t.Errorf("sent %d probes, want %d", n, tt.requests)
+			}
+		})
+	}
+}
+
+func TestAzureDeploymentRouting(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/openai/deployments/my-gpt-5/chat/completions" ||
+			r.URL.Query().Get("api-version") != config.DefaultAzureAPIVersion || r.Header.Get("Api-Key") != "secret" {
+			t.Errorf("request to %s with Api-Key %q", r.URL, r.Header.Get("Api-Key"))
+			http.Error(w, `{"error": {"message": "not found"}}`, http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id": "chatcmpl_1", "object": "chat.completion", "model": "my-gpt-5",
+			"choices": [{"index": 0, "finish_reason": "stop", "message": {"role": "assistant", "content": "All good"}}],
+			"usage": {"prompt_tokens": 10, "completion_tokens": 2, "total_tokens": 12}}`))
+	}))
+	defer server.Close()
+
+	c := New(&config.Config{
+		APIKey:          "secret",
+		AzureEndpoint:   server.URL,
+		AzureAPIVersion: config.DefaultAzureAPIVersion,
+		AzureAPI:        config.APIChat,
+	}, nil, nil, nil)
+	turn := c.provider.NewTurn(conversation.State{}, "system", "Hello")
+	reply, err := turn.Send(context.Background(), callSettings{Model: "my-gpt-5"}, newProgressReporter(context.Background(), mcp.CallToolRequest{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply.Text != "All good" {
+		t.Errorf("Text = %q, want %q", reply.Text, "All good")
+	}
+}
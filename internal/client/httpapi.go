@@ -0,0 +1,96 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// apiRetries is how often a rate limited or overloaded request is retried
+const apiRetries = 2
+
+// postJSON sends body as a JSON POST request to url and returns the
+// response once it succeeds. Rate limited, overloaded and transient server
+// failures are retried, and reported to progress if set; apiError turns a failure's status and body into
+// the error returned.
+func postJSON(ctx context.Context, client *http.Client, url string, header http.Header, body []byte, progress *progressReporter, apiError func(status int, body []byte) error) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header = header.Clone()
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode == http.StatusOK {
+			return resp, nil
+		}
+
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+		resp.Body.Close()
+		err = apiError(resp.StatusCode, data)
+		if attempt == apiRetries || !retryableStatus(resp.StatusCode) {
+			return nil, err
+		}
+
+		delay := retryDelay(resp, attempt)
+		log.Printf("%v; retrying in %s", err, delay)
+		if progress != nil {
+			progress.Report("%v; retrying in %s", err, delay)
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// retryableStatus reports whether a request failing with status may
+// succeed if sent again: rate limits, overload and transient server errors
+func retryableStatus(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout, 529:
+		return true
+	}
+	return false
+}
+
+// retryDelay is how long to wait before retrying, from the Retry-After
+// header when the API sends one
+func retryDelay(resp *http.Response, attempt int) time.Duration {
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds > 0 {
+		return min(time.Duration(seconds)*time.Second, time.Minute)
+	}
+	return time.Second << attempt
+}
+
+// readSSE calls fn with the data of each server-sent event in body, until
+// the body ends or fn returns io.EOF
+func readSSE(body io.Reader, fn func(data []byte) error) error {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 8<<20)
+	for scanner.Scan() {
+		data, ok := bytes.CutPrefix(scanner.Bytes(), []byte("data:"))
+		if !ok {
+			continue
+		}
+		if err := fn(bytes.TrimSpace(data)); errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,215 @@
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/lox/gpt-5-pro-mcp/internal/conversation"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/openai/openai-go/responses"
+)
+
+// jobRetention is how long finished jobs stay available to get_job_result
+const jobRetention = 24 * time.Hour
+
+// job is a consultation running in the background after its tool call
+// returned. Only the MCP session that started it can see or cancel it.
+type job struct {
+	id              string
+	session         string
+	conversationKey string
+	startedAt       time.Time
+	cancel          context.CancelFunc
+	progress        *progressReporter
+	done            chan struct{}
+	result          *mcp.CallToolResult // set once done is closed
+	finishedAt      time.Time
+}
+
+// jobRegistry tracks background consultations by job ID
+type jobRegistry struct {
+	mu   sync.Mutex
+	jobs map[string]*job
+}
+
+func newJobRegistry() *jobRegistry {
+	return &jobRegistry{jobs: make(map[string]*job)}
+}
+
+func (r *jobRegistry) add(j *job) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	// Drop finished jobs nobody collected
+	for id, old := range r.jobs {
+		if !old.finishedAt.IsZero() && time.Since(old.finishedAt) > jobRetention {
+			delete(r.jobs, id)
+		}
+	}
+	r.jobs[j.id] = j
+}
+
+// get returns the job with id if session started it
+func (r *jobRegistry) get(id, session string) (*job, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	j, ok := r.jobs[id]
+	if !ok || j.session != session {
+		return nil, false
+	}
+	return j, true
+}
+
+func (r *jobRegistry) finish(j *job, result *mcp.CallToolResult) {
+	r.mu.Lock()
+	j.result = result
+	j.finishedAt = time.Now()
+	r.mu.Unlock()
+	close(j.done)
+}
+
+// startJob runs a consultation detached from the tool call and returns a job
+// handle immediately. The job holds the conversation lock until it finishes.
+func (c *GPT5ProClient) startJob(ctx context.Context, conversationKey string, state conversation.State, settings callSettings, provider Provider, turn Turn, unlock func()) *mcp.CallToolResult {
+	// Keep the session in the context but outlive the tool call
+	jobCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+
+	j := &job{
+		id:              newJobID(),
+		session:         sessionID(ctx),
+		conversationKey: conversationKey,
+		startedAt:       time.Now(),
+		cancel:          cancel,
+		// No progress token: the tool call that started the job has already returned
+		progress: newProgressReporter(jobCtx, mcp.CallToolRequest{}),
+		done:     make(chan struct{}),
+	}
+	c.jobs.add(j)
+
+	go func() {
+		defer unlock()
+		defer cancel()
+
+		result := c.consult(jobCtx, conversationKey, state, settings, provider, turn, j.progress)
+		c.jobs.finish(j, result)
+		log.Printf("Job finished: id=%s error=%v elapsed=%s", j.id, result.IsError, time.Since(j.startedAt).Round(time.Second))
+	}()
+
+	log.Printf("Started job: id=%s conversation=%s", j.id, conversationKey)
+	return mcp.NewToolResultText(fmt.Sprintf(
+		"Consultation started in the background.\n\njob_id: %s\n\nCall get_job_result with this job_id to retrieve the answer, or cancel_job to stop it.", j.id))
+}
+
+// HandleGetJobResult returns a background job's answer, or its status if still running
+func (c *GPT5ProClient) HandleGetJobResult(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	id, err := request.RequireString("job_id")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	j, ok := c.jobs.get(id, sessionID(ctx))
+	if !ok {
+		return c.responseResult(ctx, id), nil
+	}
+
+	// Optionally wait a little for the job so callers can poll less often
+	wait := time.Duration(request.GetInt("wait_seconds", 0)) * time.Second
+	select {
+	case <-j.done:
+	case <-time.After(wait):
+	case <-ctx.Done():
+	}
+
+	select {
+	case <-j.done:
+		return j.result, nil
+	default:
+		status := fmt.Sprintf("Job %s is still running (%s elapsed). Call get_job_result again later.",
+			id, time.Since(j.startedAt).Round(time.Second))
+		if partial := j.progress.PartialAnswer(); partial != "" {
+			status += "\n\nAnswer so far:\n\n" + partial
+		}
+		return mcp.NewToolResultText(status), nil
+	}
+}
+
+// HandleCancelJob stops a background job and cancels its in-flight response
+func (c *GPT5ProClient) HandleCancelJob(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	id, err := request.RequireString("job_id")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	j, ok := c.jobs.get(id, sessionID(ctx))
+	if !ok {
+		// Not a job of this session; try it as a response ID the session created
+		if c.responses == nil || !c.responses.createdFor(ctx, id) {
+			return mcp.NewToolResultError(fmt.Sprintf("Job %s not found", id)), nil
+		}
+		if _, err := c.responses.client.Responses.Cancel(ctx, id); err != nil {
+			return mcp.NewToolResultError(fmt.Sprintf("Failed to cancel %s: %v", id, err)), nil
+		}
+		return mcp.NewToolResultText(fmt.Sprintf("Cancelled response %s", id)), nil
+	}
+
+	select {
+	case <-j.done:
+		return mcp.NewToolResultText(fmt.Sprintf("Job %s already finished", id)), nil
+	default:
+	}
+
+	j.cancel()
+	<-j.done
+	log.Printf("Cancelled job: id=%s", id)
+	return mcp.NewToolResultText(fmt.Sprintf("Cancelled job %s", id)), nil
+}
+
+// responseResult looks up a response the calling session created directly
+// by ID, for responses whose job is gone
+func (c *GPT5ProClient) responseResult(ctx context.Context, id string) *mcp.CallToolResult {
+	if c.responses == nil || !c.responses.createdFor(ctx, id) {
+		return mcp.NewToolResultError(fmt.Sprintf("Job %s not found", id))
+	}
+
+	response, err := c.responses.client.Responses.Get(ctx, id, responses.ResponseGetParams{})
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Job %s not found: %v", id, err))
+	}
+
+	switch response.Status {
+	case responses.ResponseStatusQueued, responses.ResponseStatusInProgress:
+		return mcp.NewToolResultText(fmt.Sprintf("Response %s is still %s. Call get_job_result again later.", id, response.Status))
+	case responses.ResponseStatusFailed:
+		return mcp.NewToolResultError(fmt.Sprintf("Response %s failed: %s", id, response.Error.Message))
+	case responses.ResponseStatusCancelled:
+		return mcp.NewToolResultError(fmt.Sprintf("Response %s was cancelled", id))
+	}
+
+	if len(extractToolCalls(response)) > 0 {
+		return mcp.NewToolResultError(fmt.Sprintf(
+			"Response %s stopped waiting on tool calls; the job that was running it is gone. Ask again to continue the conversation.", id))
+	}
+	text := extractTextContent(response)
+	if text == "" {
+		return mcp.NewToolResultError("No text content in response")
+	}
+	return mcp.NewToolResultText(text)
+}
+
+// sessionID identifies the MCP session of a tool call
+func sessionID(ctx context.Context) string {
+	if session := server.ClientSessionFromContext(ctx); session != nil {
+		return session.SessionID()
+	}
+	return ""
+}
+
+// newJobID returns a random job identifier
+func newJobID() string {
+	return "job_" + rand.Text()
+}
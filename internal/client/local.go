@@ -0,0 +1,186 @@
+package client
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lox/gpt-5-pro-mcp/internal/config"
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+)
+
+// probeTimeout bounds a capability probe of a local server
+const probeTimeout = 10 * time.Second
+
+// toolSupport tracks which models of a local server call tools natively.
+// In auto mode it asks probe once per model; when the server can't tell,
+// native tool calling is tried until a request is rejected for its tools.
+type toolSupport struct {
+	server string // the server, for logs
+	mode   string // config.ToolsAuto, config.ToolsNative or config.ToolsEmulated
+	probe  func(ctx context.Context, model string) (native, known bool)
+
+	mu     sync.Mutex
+	models map[string]*modelTools
+}
+
+// modelTools is what is known about one model's tool calling. Only the
+// first call for a model probes it; calls for other models don't wait.
+type modelTools struct {
+	once   sync.Once
+	native bool // guarded by toolSupport.mu
+}
+
+// newToolSupport tracks tool calling on a server, detecting it with probe
+// when mode is config.ToolsAuto
+func newToolSupport(server, mode string, probe func(ctx context.Context, model string) (native, known bool)) *toolSupport {
+	return &toolSupport{server: server, mode: mode, probe: probe, models: make(map[string]*modelTools)}
+}
+
+// native reports whether model should be offered the tools natively
+func (s *toolSupport) native(ctx context.Context, model string) bool {
+	switch s.mode {
+	case config.ToolsNative:
+		return true
+	case config.ToolsEmulated:
+		return false
+	}
+
+	m := s.model(model)
+	m.once.Do(func() {
+		probeCtx, cancel := context.WithTimeout(ctx, probeTimeout)
+		defer cancel()
+		native, known := s.probe(probeCtx, model)
+		if known {
+			log.Printf("[%s] Model %s native tool calling: %t", s.server, model, native)
+		} else {
+			native = true
+			log.Printf("[%s] Could not detect tool calling for %s, trying native tools", s.server, model)
+		}
+		s.mu.Lock()
+		m.native = native
+		s.mu.Unlock()
+	})
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return m.native
+}
+
+// rejected reports whether err is the server refusing the tools of a
+// request for model. If so, and tool calling is auto-detected, model switches
+// to emulated tool calling.
+func (s *toolSupport) rejected(model string, err error) bool {
+	if s.mode != config.ToolsAuto || !toolsRejected(err) {
+		return false
+	}
+	m := s.model(model)
+	m.once.Do(func() {}) // the rejection settles it; no need to probe
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m.native = false
+	log.Printf("[%s] Model %s rejected native tools (%v), emulating tool calling", s.server, model, err)
+	return true
+}
+
+// model returns what is known about model's tool calling
+func (s *toolSupport) model(model string) *modelTools {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	m, ok := s.models[model]
+	if !ok {
+		m = &modelTools{}
+		s.models[model] = m
+	}
+	return m
+}
+
+// localAPIError is an error response from a local server
+type localAPIError struct {
+	Status  int
+	Message string
+}
+
+// Error formats the status and the server's message
+func (e *localAPIError) Error() string {
+	return fmt.Sprintf("HTTP %d: %s", e.Status, e.Message)
+}
+
+// toolsRejected reports whether err looks like a server refusing tools:
+// Ollama for models without tool support, llama.cpp without --jinja, or
+// vLLM without --enable-auto-tool-choice
+func toolsRejected(err error) bool {
+	var status int
+	var message string
+	var apiErr *openai.Error
+	var localErr *localAPIError
+	switch {
+	case errors.As(err, &apiErr):
+		status, message = apiErr.StatusCode, apiErr.Error()
+	case errors.As(err, &localErr):
+		status, message = localErr.Status, localErr.Message
+	default:
+		return false
+	}
+	switch status {
+	case http.StatusBadRequest, http.StatusUnprocessableEntity, http.StatusInternalServerError, http.StatusNotImplemented:
+		return strings.Contains(strings.ToLower(message), "tool")
+	}
+	return false
+}
+
+// NewLocalProvider creates a provider for an OpenAI-compatible local server
+// such as llama.cpp or vLLM, serving local/* models. It uses Chat
+// Completions unless cfg.LocalAPI picks the Responses API. On Chat
+// Completions, tool calling is detected per model and emulated in text where
+// the server or model lacks it.
+func NewLocalProvider(cfg *config.Config) Provider {
+	// Local servers usually take any key, but the SDK insists on one
+	client := openai.NewClient(option.WithBaseURL(cfg.LocalBaseURL), option.WithAPIKey(cmp.Or(cfg.LocalAPIKey, "local")))
+	if cfg.LocalAPI == config.APIResponses {
+		p := NewResponsesProvider(&client, cfg)
+		p.name = "local Responses API"
+		p.prefix = "local/"
+		p.setting = "GPT5_PRO_MCP_LOCAL_API"
+		return p
+	}
+
+	p := NewChatCompletionsProvider(&client, cfg)
+	p.name = "local Chat Completions API"
+	p.prefix = "local/"
+	p.tools = newToolSupport("Local", cfg.LocalTools, func(ctx context.Context, model string) (bool, bool) {
+		return probeLlamaCppTools(ctx, &client, cfg.LocalBaseURL)
+	})
+	return p
+}
+
+// probeLlamaCppTools asks a llama.cpp server whether its chat template
+// handles tool calls, through client so the request carries the server's
+// API key. Other servers, and llama.cpp builds that don't report template
+// capabilities, leave it unknown.
+func probeLlamaCppTools(ctx context.Context, client *openai.Client, baseURL string) (native, known bool) {
+	root := strings.TrimSuffix(strings.TrimSuffix(baseURL, "/"), "/v1")
+	var body []byte
+	if err := client.Get(ctx, root+"/props", nil, &body, option.WithMaxRetries(0)); err != nil {
+		return false, false
+	}
+
+	var props struct {
+		ChatTemplateCaps struct {
+			SupportsToolCalls *bool `json:"supports_tool_calls"`
+		} `json:"chat_template_caps"`
+	}
+	if err := json.Unmarshal(body, &props); err != nil || props.ChatTemplateCaps.SupportsToolCalls == nil {
+		return false, false
+	}
+	return *props.ChatTemplateCaps.SupportsToolCalls, true
+}
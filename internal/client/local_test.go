@@ -0,0 +1,78 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lox/gpt-5-pro-mcp/internal/config"
+)
+
+func TestLocalProbeUsesAPIKey(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/props" || r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		// llama.cpp serves its props without a JSON content type
+		w.Header().Set("Content-Type", "text/plain")
+		_, _ = w.Write([]byte(`{"chat_template_caps": {"supports_tool_calls": false}}`))
+	}))
+	defer server.Close()
+
+	p := NewLocalProvider(&config.Config{LocalBaseURL: server.URL + "/v1", LocalAPIKey: "secret", LocalTools: config.ToolsAuto}).(*ChatCompletionsProvider)
+	if p.tools.native(context.Background(), "qwen") {
+		t.Error("native() = true, want false from the server's props")
+	}
+}
+
+func TestToolSupportProbesModelsIndependently(t *testing.T) {
+	release := make(chan struct{})
+	var mu sync.Mutex
+	probes := make(map[string]int)
+	tools := newToolSupport("Test", config.ToolsAuto, func(ctx context.Context, model string) (bool, bool) {
+		mu.Lock()
+		probes[model]++
+		mu.Unlock()
+		if model == "slow" {
+			<-release
+		}
+		return true, true
+	})
+
+	var wg sync.WaitGroup
+	for range 3 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			tools.native(context.Background(), "slow")
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		tools.native(context.Background(), "fast")
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("probing one model waited for another model's probe")
+	}
+
+	close(release)
+	wg.Wait()
+	if probes["slow"] != 1 || probes["fast"] != 1 {
+		t.Errorf("probes = %v, want one per model", probes)
+	}
+
+	if !tools.rejected("slow", &localAPIError{Status: http.StatusBadRequest, Message: "model does not support tools"}) {
+		t.Fatal("rejected() = false, want true")
+	}
+	if tools.native(context.Background(), "slow") {
+		t.Error("native() = true after the model rejected tools")
+	}
+}
@@ -0,0 +1,353 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/lox/gpt-5-pro-mcp/internal/config"
+	"github.com/lox/gpt-5-pro-mcp/internal/conversation"
+	"github.com/lox/gpt-5-pro-mcp/internal/usage"
+)
+
+// OllamaProvider consults local models through Ollama's /api/chat, serving
+// ollama/* models. The API is stateless, so each request carries the
+// conversation's full history, kept in the conversation state as JSON. Models
+// without native tool calling get it emulated in text.
+type OllamaProvider struct {
+	config  *config.Config
+	http    *http.Client
+	baseURL string
+	tools   *toolSupport
+}
+
+// NewOllamaProvider creates a provider for the Ollama server at cfg.OllamaHost
+func NewOllamaProvider(cfg *config.Config) *OllamaProvider {
+	p := &OllamaProvider{
+		config:  cfg,
+		http:    &http.Client{},
+		baseURL: strings.TrimSuffix(cfg.OllamaHost, "/"),
+	}
+	p.tools = newToolSupport("Ollama", cfg.LocalTools, p.probeTools)
+	return p
+}
+
+// Name identifies Ollama in logs and errors
+func (p *OllamaProvider) Name() string {
+	return "Ollama API"
+}
+
+// ollamaMessage is one message of an /api/chat conversation
+type ollamaMessage struct {
+	Role      string           `json:"role"`
+	Content   string           `json:"content"`
+	ToolCalls []ollamaToolCall `json:"tool_calls,omitempty"`
+	ToolName  string           `json:"tool_name,omitempty"`
+}
+
+// ollamaToolCall is the model calling a tool
+type ollamaToolCall struct {
+	Function struct {
+		Name      string          `json:"name"`
+		Arguments json.RawMessage `json:"arguments"`
+	} `json:"function"`
+}
+
+// ollamaTool is a tool definition in a request
+type ollamaTool struct {
+	Type     string `json:"type"`
+	Function struct {
+		Name        string         `json:"name"`
+		Description string         `json:"description"`
+		Parameters  map[string]any `json:"parameters"`
+	} `json:"function"`
+}
+
+// ollamaRequest is the body of an /api/chat request
+type ollamaRequest struct {
+	Model    string          `json:"model"`
+	Messages []ollamaMessage `json:"messages"`
+	Tools    []ollamaTool    `json:"tools,omitempty"`
+	Stream   bool            `json:"stream"`
+	Options  map[string]any  `json:"options,omitempty"`
+}
+
+// ollamaResponse is an /api/chat response, or one line of a stream
+type ollamaResponse struct {
+	Message         ollamaMessage `json:"message"`
+	Done            bool          `json:"done"`
+	DoneReason      string        `json:"done_reason"`
+	PromptEvalCount int64         `json:"prompt_eval_count"`
+	EvalCount       int64         `json:"eval_count"`
+	Error           string        `json:"error"`
+}
+
+// ollamaTurn is a turn on Ollama: the history so far, including this
+// turn's requests and replies
+type ollamaTurn struct {
+	provider *OllamaProvider
+	system   string
+	messages []ollamaMessage
+	complete bool // the last reply was the answer, not tool calls
+	sent     int  // requests sent so far
+	emulate  bool // tools are described in the system prompt and calls parsed from text
+	calls    []ToolCall
+	outputs  []string // results of emulated calls, sent together on the next Send
+	called   int
+}
+
+// NewTurn starts a turn from the conversation's history
+func (p *OllamaProvider) NewTurn(state conversation.State, systemPrompt, prompt string) Turn {
+	var messages []ollamaMessage
+	if len(state.History) > 0 {
+		if err := json.Unmarshal(state.History, &messages); err != nil {
+			log.Printf("[Ollama] WARNING: Discarding unreadable conversation history: %v", err)
+			messages = nil
+		} else {
+			log.Printf("[Ollama] Continuing conversation: history_len=%d", len(messages))
+		}
+	}
+	messages = append(messages, ollamaMessage{Role: "user", Content: prompt})
+	return &ollamaTurn{provider: p, system: systemPrompt, messages: messages}
+}
+
+// Send sends the whole history and appends the reply to it
+func (t *ollamaTurn) Send(ctx context.Context, settings callSettings, progress *progressReporter) (*Reply, error) {
+	model := strings.TrimPrefix(settings.Model, "ollama/")
+	tools := t.provider.tools
+	if t.sent == 0 {
+		t.emulate = !tools.native(ctx, model)
+	}
+	if len(t.calls) > 0 {
+		t.messages = append(t.messages, ollamaMessage{Role: "user", Content: emulatedToolResults(t.calls, t.outputs)})
+		t.calls, t.outputs = nil, nil
+	}
+
+	response, err := t.chat(ctx, model, progress)
+	if err != nil && t.sent == 0 && !t.emulate && tools.rejected(model, err) {
+		t.emulate = true
+		response, err = t.chat(ctx, model, progress)
+	}
+	t.sent++
+	if err != nil {
+		if response != nil {
+			return &Reply{Usage: usage.Usage{InputTokens: response.PromptEvalCount, OutputTokens: response.EvalCount}}, err
+		}
+		return nil, err
+	}
+	log.Printf("[Ollama] Received response: done_reason=%s tool_calls=%d", response.DoneReason, len(response.Message.ToolCalls))
+
+	message := ollamaMessage{Role: "assistant", Content: response.Message.Content, ToolCalls: response.Message.ToolCalls}
+	reply := &Reply{
+		Text:  message.Content,
+		Usage: usage.Usage{InputTokens: response.PromptEvalCount, OutputTokens: response.EvalCount},
+	}
+	if t.emulate {
+		reply.ToolCalls, reply.Text = parseEmulatedToolCalls(message.Content, t.called)
+		t.called += len(reply.ToolCalls)
+	} else {
+		for i, call := range message.ToolCalls {
+			reply.ToolCalls = append(reply.ToolCalls, ToolCall{
+				ID:        fmt.Sprintf("call_%d_%d", len(t.messages), i),
+				Name:      call.Function.Name,
+				Arguments: string(toolInput(string(call.Function.Arguments))),
+			})
+		}
+	}
+	if response.DoneReason == "length" && len(reply.ToolCalls) == 0 && reply.Text != "" {
+		reply.Text += fmt.Sprintf("\n\n[Answer cut off at %d output tokens; raise GPT5_PRO_MCP_MAX_OUTPUT_TOKENS for longer answers]", t.provider.config.MaxOutputTokens)
+	}
+
+	t.messages = append(t.messages, message)
+	t.complete = len(reply.ToolCalls) == 0
+	return reply, nil
+}
+
+// AddToolResult adds a tool message answering one of the reply's calls.
+// Emulated calls are answered together in one user message on the next Send.
+func (t *ollamaTurn) AddToolResult(call ToolCall, output string, failed bool) {
+	if t.emulate {
+		t.calls = append(t.calls, call)
+		t.outputs = append(t.outputs, output)
+		return
+	}
+	t.messages = append(t.messages, ollamaMessage{Role: "tool", Content: output, ToolName: call.Name})
+}
+
+// Save records the history once the turn has its answer. A history ending
+// in unanswered tool calls would confuse the next request, so until then
+// the conversation keeps its previous history.
+func (t *ollamaTurn) Save(state *conversation.State) {
+	if !t.complete {
+		return
+	}
+	history, err := json.Marshal(t.messages)
+	if err != nil {
+		log.Printf("[Ollama] WARNING: Failed to save conversation history: %v", err)
+		return
+	}
+	state.History = history
+}
+
+// chat sends the history for model, with the tools offered natively or
+// described in the system prompt
+func (t *ollamaTurn) chat(ctx context.Context, model string, progress *progressReporter) (*ollamaResponse, error) {
+	system := t.system
+	request := ollamaRequest{
+		Model:   model,
+		Stream:  t.provider.config.Stream,
+		Options: map[string]any{"num_predict": t.provider.config.MaxOutputTokens},
+	}
+	if t.emulate {
+		system += emulatedToolsPrompt()
+	} else {
+		request.Tools = t.provider.buildTools()
+	}
+	request.Messages = append([]ollamaMessage{{Role: "system", Content: system}}, t.messages...)
+
+	log.Printf("[Ollama] Calling /api/chat: model=%s messages=%d emulated_tools=%t", model, len(t.messages), t.emulate)
+	return t.provider.chat(ctx, request, progress)
+}
+
+// chat sends an /api/chat request. When streaming, answer text is
+// forwarded to the client as it arrives and the lines of the stream are
+// merged into one response. Ollama only counts tokens at the end, so a
+// stream that breaks off returns a response with estimated counts and the
+// error.
+func (p *OllamaProvider) chat(ctx context.Context, request ollamaRequest, progress *progressReporter) (*ollamaResponse, error) {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := postJSON(ctx, p.http, p.baseURL+"/api/chat", http.Header{}, body, progress, ollamaAPIError)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if !request.Stream {
+		var response ollamaResponse
+		if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+			return nil, fmt.Errorf("invalid response: %w", err)
+		}
+		return &response, nil
+	}
+
+	progress.StartAnswer()
+	defer progress.FlushPartial()
+	response, err := readOllamaStream(resp.Body, progress)
+	if err != nil && response != nil {
+		estimate := estimatedUsage(request.Messages, response.Message.Content)
+		response.PromptEvalCount, response.EvalCount = estimate.InputTokens, estimate.OutputTokens
+	}
+	return response, err
+}
+
+// readOllamaStream merges the newline-delimited JSON of a streamed
+// response, forwarding answer text to progress as it arrives. If the stream
+// fails after it started, the partial response is returned with the error.
+func readOllamaStream(body io.Reader, progress *progressReporter) (*ollamaResponse, error) {
+	var response ollamaResponse
+	var content strings.Builder
+	started := false
+	partial := func(err error) (*ollamaResponse, error) {
+		if !started {
+			return nil, err
+		}
+		response.Message.Content = content.String()
+		return &response, err
+	}
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 8<<20)
+	for scanner.Scan() {
+		if len(strings.TrimSpace(scanner.Text())) == 0 {
+			continue
+		}
+		var chunk ollamaResponse
+		if err := json.Unmarshal(scanner.Bytes(), &chunk); err != nil {
+			return partial(fmt.Errorf("invalid stream line: %w", err))
+		}
+		if chunk.Error != "" {
+			return partial(fmt.Errorf("stream error: %s", chunk.Error))
+		}
+		started = true
+
+		if chunk.Message.Content != "" {
+			content.WriteString(chunk.Message.Content)
+			progress.Partial(chunk.Message.Content)
+		}
+		for _, call := range chunk.Message.ToolCalls {
+			progress.Report("Model is calling %s", call.Function.Name)
+		}
+		response.Message.ToolCalls = append(response.Message.ToolCalls, chunk.Message.ToolCalls...)
+
+		if chunk.Done {
+			response.Done = true
+			response.DoneReason = chunk.DoneReason
+			response.PromptEvalCount = chunk.PromptEvalCount
+			response.EvalCount = chunk.EvalCount
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return partial(err)
+	}
+	if !response.Done {
+		return partial(fmt.Errorf("stream ended before the response was complete"))
+	}
+	response.Message.Role = "assistant"
+	response.Message.Content = content.String()
+	return &response, nil
+}
+
+// ollamaAPIError turns a failed request's status and body into an error
+func ollamaAPIError(status int, body []byte) error {
+	var apiErr struct {
+		Error string `json:"error"`
+	}
+	message := strings.TrimSpace(string(body))
+	if json.Unmarshal(body, &apiErr) == nil && apiErr.Error != "" {
+		message = apiErr.Error
+	}
+	return &localAPIError{Status: status, Message: message}
+}
+
+// probeTools asks Ollama whether model supports tool calling. Servers too
+// old to list model capabilities leave it unknown.
+func (p *OllamaProvider) probeTools(ctx context.Context, model string) (native, known bool) {
+	body, _ := json.Marshal(map[string]string{"model": model})
+	resp, err := postJSON(ctx, p.http, p.baseURL+"/api/show", http.Header{}, body, nil, ollamaAPIError)
+	if err != nil {
+		log.Printf("[Ollama] Failed to look up model %s: %v", model, err)
+		return false, false
+	}
+	defer resp.Body.Close()
+
+	var show struct {
+		Capabilities []string `json:"capabilities"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&show); err != nil || show.Capabilities == nil {
+		return false, false
+	}
+	return slices.Contains(show.Capabilities, "tools"), true
+}
+
+// buildTools maps the file tools to Ollama tool definitions
+func (p *OllamaProvider) buildTools() []ollamaTool {
+	var tools []ollamaTool
+	for _, tool := range fileTools() {
+		var t ollamaTool
+		t.Type = "function"
+		t.Function.Name = tool.Name
+		t.Function.Description = tool.Description
+		t.Function.Parameters = tool.Parameters
+		tools = append(tools, t)
+	}
+	return tools
+}
@@ -0,0 +1,277 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/lox/gpt-5-pro-mcp/internal/config"
+	"github.com/lox/gpt-5-pro-mcp/internal/conversation"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestReadOllamaStream(t *testing.T) {
+	tests := []struct {
+		name    string
+		stream  string
+		want    *ollamaResponse
+		wantErr string
+	}{
+		{
+			name: "content across lines",
+			stream: `{"message":{"role":"assistant","content":"main.go "},"done":false}
+{"message":{"role":"assistant","content":"starts the server."},"done":false}
+
+{"message":{"role":"assistant","content":""},"done":true,"done_reason":"stop","prompt_eval_count":120,"eval_count":9}
+`,
+			want: &ollamaResponse{
+				Message:         ollamaMessage{Role: "assistant", Content: "main.go starts the server."},
+				Done:            true,
+				DoneReason:      "stop",
+				PromptEvalCount: 120,
+				EvalCount:       9,
+			},
+		},
+		{
+			name: "tool calls across lines",
+			stream: `{"message":{"role":"assistant","content":"","tool_calls":[{"function":{"name":"read_file","arguments":{"path":"a.go"}}}]},"done":false}
+{"message":{"role":"assistant","content":"","tool_calls":[{"function":{"name":"grep_files","arguments":{"pattern":"x"}}}]},"done":false}
+{"message":{"role":"assistant","content":""},"done":true,"done_reason":"stop"}`,
+			want: &ollamaResponse{
+				Message: ollamaMessage{Role: "assistant", ToolCalls: []ollamaToolCall{
+					ollamaCall("read_file", `{"path":"a.go"}`),
+					ollamaCall("grep_files", `{"pattern":"x"}`),
+				}},
+				Done:       true,
+				DoneReason: "stop",
+			},
+		},
+		{
+			name: "lines after done are ignored",
+			stream: `{"message":{"content":"ok"},"done":true,"done_reason":"stop"}
+not json`,
+			want: &ollamaResponse{Message: ollamaMessage{Role: "assistant", Content: "ok"}, Done: true, DoneReason: "stop"},
+		},
+		{
+			name: "malformed line keeps the partial answer",
+			stream: `{"message":{"content":"partial "},"done":false}
+{"message":{"content":`,
+			want:    &ollamaResponse{Message: ollamaMessage{Content: "partial "}},
+			wantErr: "invalid stream line",
+		},
+		{
+			name:    "malformed first line",
+			stream:  "<html>Bad Gateway</html>\n",
+			wantErr: "invalid stream line",
+		},
+		{
+			name: "error in the stream",
+			stream: `{"message":{"content":"some"},"done":false}
+{"error":"model runner has unexpectedly stopped"}`,
+			want:    &ollamaResponse{Message: ollamaMessage{Content: "some"}},
+			wantErr: "stream error: model runner has unexpectedly stopped",
+		},
+		{
+			name:    "ends before done",
+			stream:  `{"message":{"content":"cut"},"done":false}`,
+			want:    &ollamaResponse{Message: ollamaMessage{Content: "cut"}},
+			wantErr: "stream ended before the response was complete",
+		},
+		{
+			name:    "empty",
+			stream:  "\n\n",
+			wantErr: "stream ended before the response was complete",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			progress := newProgressReporter(context.Background(), mcp.CallToolRequest{})
+			got, err := readOllamaStream(strings.NewReader(tt.stream), progress)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("response = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// ollamaCall builds a native tool call
+func ollamaCall(name, arguments string) ollamaToolCall {
+	var call ollamaToolCall
+	call.Function.Name = name
+	call.Function.Arguments = json.RawMessage(arguments)
+	return call
+}
+
+func TestParseEmulatedToolCalls(t *testing.T) {
+	tests := []struct {
+		name  string
+		text  string
+		first int
+		calls []ToolCall
+		rest  string
+	}{
+		{
+			name:  "fenced block",
+			text:  "Let me look.\n\n```tool_call\n{\"name\": \"read_file\", \"arguments\": {\"path\": \"main.go\"}}\n```",
+			calls: []ToolCall{{ID: "call_0", Name: "read_file", Arguments: `{"path": "main.go"}`}},
+			rest:  "Let me look.",
+		},
+		{
+			name:  "tags",
+			text:  "<tool_call>\n{\"name\": \"list_directory\", \"arguments\": {}}\n</tool_call>",
+			calls: []ToolCall{{ID: "call_0", Name: "list_directory", Arguments: `{}`}},
+		},
+		{
+			name: "several, numbered on",
+			text: "```tool_call\n{\"name\": \"read_file\", \"arguments\": {\"path\": \"a\"}}```\n" +
+				"<tool_call>{\"name\": \"read_file\", \"arguments\": {\"path\": \"b\"}}</tool_call>",
+			first: 3,
+			calls: []ToolCall{
+				{ID: "call_3", Name: "read_file", Arguments: `{"path": "a"}`},
+				{ID: "call_4", Name: "read_file", Arguments: `{"path": "b"}`},
+			},
+		},
+		{
+			name:  "arguments as a string",
+			text:  "<tool_call>{\"name\": \"read_file\", \"arguments\": \"{\\\"path\\\": \\\"a\\\"}\"}</tool_call>",
+			calls: []ToolCall{{ID: "call_0", Name: "read_file", Arguments: `{"path": "a"}`}},
+		},
+		{
+			name:  "no arguments",
+			text:  "<tool_call>{\"name\": \"git_diff\"}</tool_call>",
+			calls: []ToolCall{{ID: "call_0", Name: "git_diff", Arguments: `{}`}},
+		},
+		{
+			name: "invalid json is left as text",
+			text: "<tool_call>{\"name\": \"read_file\", \"arguments\": {</tool_call>",
+			rest: "<tool_call>{\"name\": \"read_file\", \"arguments\": {</tool_call>",
+		},
+		{
+			name: "no name is left as text",
+			text: "```tool_call\n{\"arguments\": {\"path\": \"a\"}}\n```",
+			rest: "```tool_call\n{\"arguments\": {\"path\": \"a\"}}\n```",
+		},
+		{
+			name: "unclosed block is left as text",
+			text: "Reading.\n```tool_call\n{\"name\": \"read_file\", \"arguments\": {\"path\": \"a\"}}",
+			rest: "Reading.\n```tool_call\n{\"name\": \"read_file\", \"arguments\": {\"path\": \"a\"}}",
+		},
+		{
+			name: "other code blocks are text",
+			text: "The answer:\n```json\n{\"name\": \"read_file\"}\n```",
+			rest: "The answer:\n```json\n{\"name\": \"read_file\"}\n```",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls, rest := parseEmulatedToolCalls(tt.text, tt.first)
+			if !reflect.DeepEqual(calls, tt.calls) {
+				t.Errorf("calls = %+v, want %+v", calls, tt.calls)
+			}
+			if rest != tt.rest {
+				t.Errorf("rest = %q, want %q", rest, tt.rest)
+			}
+		})
+	}
+}
+
+func TestOllamaEmulatedToolCalls(t *testing.T) {
+	streams := []string{
+		`{"message":{"role":"assistant","content":"` + "```tool_call\\n" + `{\"name\": \"read_file\", \"arguments\": {\"path\": \"main.go\"}}` + "\\n```" + `"},"done":false}
+{"message":{"role":"assistant","content":""},"done":true,"done_reason":"stop","prompt_eval_count":900,"eval_count":30}
+`,
+		`{"message":{"role":"assistant","content":"It starts the server."},"done":false}
+{"message":{"role":"assistant","content":""},"done":true,"done_reason":"stop","prompt_eval_count":1000,"eval_count":6}
+`,
+	}
+	var requests []ollamaRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/show":
+			io.WriteString(w, `{"capabilities": ["completion"]}`)
+		case "/api/chat":
+			var request ollamaRequest
+			if err := json.NewDecoder(r.Body).Decode(&request); err != nil || len(requests) == len(streams) {
+				http.Error(w, `{"error":"unexpected request"}`, http.StatusBadRequest)
+				return
+			}
+			requests = append(requests, request)
+			io.WriteString(w, streams[len(requests)-1])
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	provider := NewOllamaProvider(&config.Config{OllamaHost: server.URL, LocalTools: config.ToolsAuto, MaxOutputTokens: 1024, Stream: true})
+	settings := callSettings{Model: "ollama/llama3"}
+	progress := newProgressReporter(context.Background(), mcp.CallToolRequest{})
+
+	var state conversation.State
+	turn := provider.NewTurn(state, "system prompt", "What does main.go do?")
+	reply, err := turn.Send(context.Background(), settings, progress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []ToolCall{{ID: "call_0", Name: "read_file", Arguments: `{"path": "main.go"}`}}
+	if !reflect.DeepEqual(reply.ToolCalls, want) || reply.Text != "" {
+		t.Fatalf("reply = %+v, want the emulated call", reply)
+	}
+
+	turn.AddToolResult(reply.ToolCalls[0], "package main", false)
+	reply, err = turn.Send(context.Background(), settings, progress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reply.Text != "It starts the server." || reply.Usage.InputTokens != 1000 || reply.Usage.OutputTokens != 6 {
+		t.Errorf("answer = %+v", reply)
+	}
+
+	// Tools are described in the system prompt, not sent natively, and the
+	// result comes back as a user message
+	second := requests[1]
+	if len(second.Tools) != 0 || !strings.Contains(second.Messages[0].Content, "```tool_call") {
+		t.Error("emulated request sent native tools or left the tools out of the system prompt")
+	}
+	result := second.Messages[len(second.Messages)-1]
+	if result.Role != "user" || result.Content != "<tool_result name=\"read_file\" id=\"call_0\">\npackage main\n</tool_result>" {
+		t.Errorf("tool result message = %+v", result)
+	}
+
+	turn.Save(&state)
+	var history []ollamaMessage
+	if err := json.Unmarshal(state.History, &history); err != nil || len(history) != 4 {
+		t.Fatalf("saved history = %s (%v), want 4 messages", state.History, err)
+	}
+}
+
+func TestOllamaBrokenStreamEstimatesUsage(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"message":{"role":"assistant","content":"The answer is cut"},"done":false}`+"\n")
+	}))
+	defer server.Close()
+
+	provider := NewOllamaProvider(&config.Config{OllamaHost: server.URL, LocalTools: config.ToolsNative, MaxOutputTokens: 1024, Stream: true})
+	progress := newProgressReporter(context.Background(), mcp.CallToolRequest{})
+	turn := provider.NewTurn(conversation.State{}, "system prompt", "What does main.go do?")
+	reply, err := turn.Send(context.Background(), callSettings{Model: "ollama/llama3"}, progress)
+	if err == nil {
+		t.Fatal("Send succeeded on a stream that broke off")
+	}
+	// Ollama only counts tokens at the end, so the spend is estimated
+	if reply == nil || reply.Usage.InputTokens == 0 || reply.Usage.OutputTokens == 0 {
+		t.Errorf("reply = %+v, want estimated usage", reply)
+	}
+}
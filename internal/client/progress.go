@@ -0,0 +1,213 @@
+package client
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+const (
+	// partialFlushInterval throttles notifications carrying streamed answer text
+	partialFlushInterval = time.Second
+	// partialPreviewLength is how much of the answer so far a progress message shows
+	partialPreviewLength = 200
+)
+
+// progressReporter tracks how far a tool call has got. It sends each step as
+// an MCP progress notification when the caller supplied a progress token, and
+// remembers the last step so interruptions can say where they happened.
+// While an answer streams in, it also forwards the text as MCP log messages.
+type progressReporter struct {
+	ctx       context.Context
+	server    *server.MCPServer
+	token     mcp.ProgressToken
+	started   time.Time
+	mu        sync.Mutex
+	step      float64
+	last      string
+	partial   strings.Builder // answer text streamed so far by the current model call
+	sent      int             // bytes of partial already forwarded to the client
+	lastFlush time.Time
+}
+
+// newProgressReporter creates a reporter for the request's progress token
+func newProgressReporter(ctx context.Context, request mcp.CallToolRequest) *progressReporter {
+	p := &progressReporter{
+		ctx:     ctx,
+		server:  server.ServerFromContext(ctx),
+		started: time.Now(),
+	}
+	if request.Params.Meta != nil {
+		p.token = request.Params.Meta.ProgressToken
+	}
+	return p
+}
+
+// Report records a step and sends it as a progress notification,
+// prefixed with the time elapsed since the tool call started
+func (p *progressReporter) Report(format string, args ...any) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.last = fmt.Sprintf(format, args...)
+	p.notifyLocked(p.last)
+}
+
+// notifyLocked sends message as the next progress notification. Callers must hold p.mu.
+func (p *progressReporter) notifyLocked(message string) {
+	p.step++
+	if p.token == nil || p.server == nil {
+		return
+	}
+
+	elapsed := time.Since(p.started).Round(time.Second)
+	err := p.server.SendNotificationToClient(p.ctx, "notifications/progress", map[string]any{
+		"progressToken": p.token,
+		"progress":      p.step,
+		"message":       fmt.Sprintf("[%s] %s", elapsed, message),
+	})
+	if err != nil {
+		log.Printf("WARNING: Failed to send progress notification: %v", err)
+	}
+}
+
+// StartAnswer discards streamed text from the previous model call
+func (p *progressReporter) StartAnswer() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.partial.Reset()
+	p.sent = 0
+}
+
+// Partial appends streamed answer text. New text is forwarded to the client
+// at most once per partialFlushInterval.
+func (p *progressReporter) Partial(delta string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.partial.WriteString(delta)
+	if time.Since(p.lastFlush) >= partialFlushInterval {
+		p.flushLocked()
+	}
+}
+
+// FlushPartial forwards any streamed text not yet sent to the client
+func (p *progressReporter) FlushPartial() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.flushLocked()
+}
+
+// PartialAnswer returns the text streamed so far by the current model call
+func (p *progressReporter) PartialAnswer() string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.partial.String()
+}
+
+// flushLocked sends unsent streamed text as an MCP log message, and a
+// progress notification showing the tail of the answer. Callers must hold p.mu.
+func (p *progressReporter) flushLocked() {
+	text := p.partial.String()
+	if len(text) == p.sent {
+		return
+	}
+	chunk := text[p.sent:]
+	p.sent = len(text)
+	p.lastFlush = time.Now()
+
+	if p.server != nil {
+		err := p.server.SendLogMessageToClient(p.ctx, mcp.NewLoggingMessageNotification(mcp.LoggingLevelInfo, "gpt-5-pro", chunk))
+		if err != nil && !errors.Is(err, server.ErrSessionDoesNotSupportLogging) && !errors.Is(err, server.ErrNotificationNotInitialized) {
+			log.Printf("WARNING: Failed to send log notification: %v", err)
+		}
+	}
+
+	tail := text
+	if len(tail) > partialPreviewLength {
+		start := len(tail) - partialPreviewLength
+		for start < len(tail) && !utf8.RuneStart(tail[start]) {
+			start++
+		}
+		tail = "..." + tail[start:]
+	}
+	p.last = fmt.Sprintf("Streaming answer (%d chars)", len(text))
+	p.notifyLocked(fmt.Sprintf("%s: %s", p.last, tail))
+}
+
+// Interrupted builds the tool error for a consultation stopped by a
+// cancellation or deadline, describing how far it got
+func (p *progressReporter) Interrupted(ctx context.Context, timeout time.Duration, iteration int) *mcp.CallToolResult {
+	p.mu.Lock()
+	last := p.last
+	answer := p.partial.String()
+	p.mu.Unlock()
+
+	elapsed := time.Since(p.started).Round(time.Second)
+	partial := fmt.Sprintf("Got as far as iteration %d/%d; last step: %s.", iteration, maxIterations, last)
+	if answer != "" {
+		answer = "\n\nPartial answer before the interruption:\n\n" + answer
+	}
+
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		log.Printf("ERROR: Consultation timed out after %s: %s", elapsed, last)
+		return mcp.NewToolResultError(fmt.Sprintf(
+			"Consultation timed out after %s (timeout_seconds=%d). %s\n\n"+
+				"The conversation keeps its earlier turns but not this one, so a follow-up call has to ask again; the tokens spent so far still count. "+
+				"For long consultations raise timeout_seconds or call with wait=false.%s",
+			elapsed, int(timeout.Seconds()), partial, answer))
+	}
+
+	log.Printf("Consultation cancelled after %s: %s", elapsed, last)
+	return mcp.NewToolResultError(fmt.Sprintf("Consultation cancelled after %s. %s%s", elapsed, partial, answer))
+}
+
+// describeToolCall summarizes a model tool call for progress messages,
+// naming the file or pattern it touches
+func describeToolCall(name, argsJSON string) string {
+	var args struct {
+		Path    string `json:"path"`
+		Pattern string `json:"pattern"`
+		Symbol  string `json:"symbol"`
+		Rev     string `json:"rev"`
+		Base    string `json:"base"`
+	}
+	_ = json.Unmarshal([]byte(argsJSON), &args)
+
+	switch name {
+	case "read_file":
+		return fmt.Sprintf("Reading %s", args.Path)
+	case "grep_files":
+		return fmt.Sprintf("Searching %s for %q", args.Path, args.Pattern)
+	case "list_directory":
+		return fmt.Sprintf("Listing %s", cmp.Or(args.Path, "."))
+	case "find_files":
+		return fmt.Sprintf("Finding %q in %s", args.Pattern, cmp.Or(args.Path, "."))
+	case "find_definition":
+		return fmt.Sprintf("Finding the definition of %s", args.Symbol)
+	case "find_references":
+		return fmt.Sprintf("Finding references to %s", args.Symbol)
+	case "file_outline":
+		return fmt.Sprintf("Outlining %s", args.Path)
+	case "git_diff":
+		return fmt.Sprintf("Diffing %s against %s", cmp.Or(args.Path, "."), cmp.Or(args.Base, "the index"))
+	case "git_log":
+		return fmt.Sprintf("Reading the history of %s", cmp.Or(args.Path, "."))
+	case "git_blame":
+		return fmt.Sprintf("Blaming %s", args.Path)
+	case "git_show":
+		return fmt.Sprintf("Showing commit %s", cmp.Or(args.Rev, "HEAD"))
+	default:
+		return fmt.Sprintf("Running %s", name)
+	}
+}
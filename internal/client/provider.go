@@ -0,0 +1,50 @@
+package client
+
+import (
+	"context"
+
+	"github.com/lox/gpt-5-pro-mcp/internal/conversation"
+	"github.com/lox/gpt-5-pro-mcp/internal/usage"
+)
+
+// Provider is a model API consultations run on. The tool loop in consult
+// is shared by all providers; a provider only turns prompts and tool
+// results into requests, and responses into a Reply.
+type Provider interface {
+	// Name identifies the API in logs and error messages
+	Name() string
+	// NewTurn starts a turn of the conversation in state that asks prompt.
+	// systemPrompt is sent if the API needs it for this turn.
+	NewTurn(state conversation.State, systemPrompt, prompt string) Turn
+}
+
+// Turn is one prompt's exchange with a provider, across the round-trips of
+// the tool loop
+type Turn interface {
+	// Send sends the pending input, the prompt or the latest tool results,
+	// and returns the model's reply. A request that fails after the API
+	// started on it, such as a cancelled stream, may return a Reply
+	// alongside the error that carries only the usage spent so far.
+	Send(ctx context.Context, settings callSettings, progress *progressReporter) (*Reply, error)
+	// AddToolResult queues the output of a tool call for the next Send.
+	// failed reports that the tool returned an error, described by output.
+	AddToolResult(call ToolCall, output string, failed bool)
+	// Save records in state what a later turn needs to continue the
+	// conversation
+	Save(state *conversation.State)
+}
+
+// Reply is the model's answer to one request: tool calls to run, or the
+// final text
+type Reply struct {
+	ToolCalls []ToolCall
+	Text      string
+	Usage     usage.Usage
+}
+
+// ToolCall represents a function tool call
+type ToolCall struct {
+	ID        string
+	Name      string
+	Arguments string
+}
@@ -0,0 +1,470 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lox/gpt-5-pro-mcp/internal/config"
+	"github.com/lox/gpt-5-pro-mcp/internal/conversation"
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+	"github.com/openai/openai-go/responses"
+)
+
+// ResponsesProvider consults models through OpenAI's Responses API, which
+// keeps the conversation server-side: each turn continues from the
+// previous response ID
+type ResponsesProvider struct {
+	client  *openai.Client
+	config  *config.Config
+	name    string
+	prefix  string // Routing prefix to strip from model names
+	setting string // Variable that switches the endpoint to Chat Completions, for error hints
+
+	mu      sync.Mutex
+	created map[string]createdResponse // response ID -> who created it
+}
+
+// createdResponse records which MCP session a response was created for
+type createdResponse struct {
+	session string
+	at      time.Time
+}
+
+// NewResponsesProvider creates a provider for the Responses API
+func NewResponsesProvider(client *openai.Client, cfg *config.Config) *ResponsesProvider {
+	if cfg.BaseURL != "" {
+		log.Printf("WARNING: Using Responses API which may not be compatible with all providers")
+	}
+	return &ResponsesProvider{client: client, config: cfg, name: "Responses API", created: make(map[string]createdResponse)}
+}
+
+// probeResponsesAPI reports whether the endpoint serves the Responses API.
+// It sends an empty request, which a server with the API rejects as
+// invalid and one without it as an unknown route; other failures, such as
+// a bad key, leave it unknown.
+func probeResponsesAPI(client *openai.Client) (supported, known bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), probeTimeout)
+	defer cancel()
+
+	err := client.Post(ctx, "responses", map[string]any{}, nil, option.WithMaxRetries(0))
+	var apiErr *openai.Error
+	switch {
+	case err == nil:
+		supported, known = true, true
+	case !errors.As(err, &apiErr):
+		log.Printf("WARNING: Could not probe for the Responses API: %v", err)
+		return false, false
+	case apiErr.StatusCode == http.StatusBadRequest || apiErr.StatusCode == http.StatusUnprocessableEntity:
+		supported, known = true, true
+	case apiErr.StatusCode == http.StatusNotFound || apiErr.StatusCode == http.StatusMethodNotAllowed || apiErr.StatusCode == http.StatusNotImplemented:
+		supported, known = false, true
+	default:
+		log.Printf("WARNING: Could not probe for the Responses API: HTTP %d", apiErr.StatusCode)
+		return false, false
+	}
+	log.Printf("Responses API probe: supported=%t", supported)
+	return supported, known
+}
+
+// probeRetryInterval is how long an endpoint the probe couldn't classify
+// is used through Chat Completions before it is probed again
+const probeRetryInterval = time.Minute
+
+// probedProvider serves an endpoint that may lack the Responses API: it
+// probes the endpoint when first used, rather than delaying startup, and
+// falls back to Chat Completions unless the probe finds the Responses API.
+// A probe that fails, such as on a timeout or a bad key, settles nothing
+// and is retried.
+type probedProvider struct {
+	endpoint  string
+	responses *ResponsesProvider
+	chat      *ChatCompletionsProvider
+	probe     func() (supported, known bool)
+
+	mu      sync.Mutex
+	chosen  Provider  // nil until a probe gives an answer
+	retryAt time.Time // when to probe again after a failed probe
+}
+
+// newProbedProvider serves an endpoint through whichever of responses and
+// chat it supports
+func newProbedProvider(endpoint string, responses *ResponsesProvider, chat *ChatCompletionsProvider) *probedProvider {
+	return &probedProvider{
+		endpoint:  endpoint,
+		responses: responses,
+		chat:      chat,
+		probe:     func() (bool, bool) { return probeResponsesAPI(responses.client) },
+	}
+}
+
+// provider returns the API the endpoint is used through, probing it until
+// the probe gives an answer
+func (p *probedProvider) provider() Provider {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.chosen != nil {
+		return p.chosen
+	}
+	if time.Now().Before(p.retryAt) {
+		return p.chat
+	}
+
+	supported, known := p.probe()
+	switch {
+	case !known:
+		log.Printf("Could not tell whether %s serves the Responses API, using Chat Completions API until it is probed again", p.endpoint)
+		p.retryAt = time.Now().Add(probeRetryInterval)
+		return p.chat
+	case supported:
+		p.chosen = p.responses
+	default:
+		log.Printf("%s does not serve the Responses API, using Chat Completions API", p.endpoint)
+		p.chosen = p.chat
+	}
+	return p.chosen
+}
+
+// Name identifies the API the endpoint is used through
+func (p *probedProvider) Name() string {
+	return p.provider().Name()
+}
+
+// NewTurn starts a turn on the API the endpoint is used through
+func (p *probedProvider) NewTurn(state conversation.State, systemPrompt, prompt string) Turn {
+	return p.provider().NewTurn(state, systemPrompt, prompt)
+}
+
+// Name identifies the Responses API in logs and errors
+func (p *ResponsesProvider) Name() string {
+	return p.name
+}
+
+// responsesTurn is a turn on the Responses API: the input not yet sent
+// and the response it continues from
+type responsesTurn struct {
+	provider     *ResponsesProvider
+	instructions string
+	responseID   string
+	input        responses.ResponseInputParam
+	sent         int
+	complete     bool // the last response was the answer, not function calls
+}
+
+// NewTurn starts a turn that continues from the conversation's last response
+func (p *ResponsesProvider) NewTurn(state conversation.State, systemPrompt, prompt string) Turn {
+	if state.ResponseID != "" {
+		log.Printf("Continuing conversation: response_id=%s", state.ResponseID)
+	}
+	return &responsesTurn{
+		provider:     p,
+		instructions: systemPrompt,
+		responseID:   state.ResponseID,
+		input: responses.ResponseInputParam{
+			responses.ResponseInputItemParamOfMessage(prompt, responses.EasyInputMessageRoleUser),
+		},
+	}
+}
+
+// Send sends the pending input as a new response following the last one
+func (t *responsesTurn) Send(ctx context.Context, settings callSettings, progress *progressReporter) (*Reply, error) {
+	params := responses.ResponseNewParams{
+		Model:     strings.TrimPrefix(settings.Model, t.provider.prefix),
+		Reasoning: settings.reasoning(),
+		Tools:     t.provider.buildTools(),
+		Input: responses.ResponseNewParamsInputUnion{
+			OfInputItemList: t.input,
+		},
+	}
+	if t.sent == 0 {
+		params.Instructions = openai.Opt(t.instructions)
+	}
+	if t.responseID != "" {
+		params.PreviousResponseID = openai.Opt(t.responseID)
+	}
+
+	log.Printf("Calling OpenAI Responses API: model=%s reasoning_effort=%q verbosity=%q background=%v input_items=%d",
+		settings.Model, settings.ReasoningEffort, settings.Verbosity, t.provider.config.Background, len(t.input))
+	response, err := t.provider.createResponse(ctx, params, settings.requestOptions("text.verbosity"), progress)
+	if err != nil && response != nil {
+		return &Reply{Usage: responseUsage(response)}, err
+	}
+	if err != nil {
+		// Provide helpful error message for OpenRouter users
+		if t.sent == 0 && t.provider.setting != "" && ctx.Err() == nil {
+			err = fmt.Errorf("%w\n\n"+
+				"COMPATIBILITY NOTE: This endpoint is used through OpenAI's Responses API (/v1/responses), which not every\n"+
+				"OpenAI-compatible provider supports, or supports fully.\n\n"+
+				"Solutions:\n"+
+				"1. Set %s=chat to use the Chat Completions API (/v1/chat/completions) for this endpoint\n"+
+				"2. Use OpenAI API directly (set OPENAI_API_KEY without OPENAI_BASE_URL)\n"+
+				"3. Use a provider that supports the Responses API",
+				err, t.provider.setting)
+		}
+		return nil, err
+	}
+	log.Printf("Received response: id=%s status=%s", response.ID, response.Status)
+
+	t.sent++
+	t.responseID = response.ID
+	t.input = nil
+	reply := &Reply{
+		ToolCalls: extractToolCalls(response),
+		Text:      extractTextContent(response),
+		Usage:     responseUsage(response),
+	}
+	t.complete = len(reply.ToolCalls) == 0
+	return reply, nil
+}
+
+// AddToolResult queues a function call output for the next response
+func (t *responsesTurn) AddToolResult(call ToolCall, output string, failed bool) {
+	t.input = append(t.input, responses.ResponseInputItemParamOfFunctionCallOutput(call.ID, output))
+}
+
+// Save records the latest response ID, which carries the whole
+// conversation, once the turn has its answer. Continuing from a response
+// with unanswered function calls is rejected, so until then the
+// conversation keeps its previous response.
+func (t *responsesTurn) Save(state *conversation.State) {
+	if t.complete {
+		state.ResponseID = t.responseID
+	}
+}
+
+// createResponse sends a request to the Responses API. When streaming, answer
+// text is forwarded to the client as it arrives. In background mode the
+// response runs server-side independently of the HTTP request: if the stream
+// drops, or streaming is off, it is polled until it finishes, so a long
+// GPT-5-Pro run isn't tied to a single connection; if ctx ends first the
+// response is cancelled server-side. A response that was cancelled or failed
+// is returned with the error, for its usage.
+func (p *ResponsesProvider) createResponse(ctx context.Context, params responses.ResponseNewParams, opts []option.RequestOption, progress *progressReporter) (*responses.Response, error) {
+	if p.config.Background {
+		params.Background = openai.Opt(true)
+	}
+
+	var response *responses.Response
+	var err error
+	if p.config.Stream {
+		response, err = p.streamResponse(ctx, params, opts, progress)
+		if err != nil && response != nil && p.config.Background {
+			if ctx.Err() != nil {
+				return p.cancelResponse(response.ID), ctx.Err()
+			}
+			log.Printf("WARNING: Stream for response %s broke off, polling instead: %v", response.ID, err)
+			err = nil
+		}
+	} else {
+		response, err = p.client.Responses.New(ctx, params, opts...)
+	}
+	if response != nil {
+		p.recordCreated(ctx, response.ID)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if p.config.Background {
+		log.Printf("Background response: id=%s status=%s", response.ID, response.Status)
+		if response, err = p.pollResponse(ctx, response, progress); err != nil {
+			return response, err
+		}
+	}
+
+	switch response.Status {
+	case responses.ResponseStatusFailed:
+		return response, fmt.Errorf("response %s failed: %s", response.ID, response.Error.Message)
+	case responses.ResponseStatusCancelled:
+		return response, fmt.Errorf("response %s was cancelled", response.ID)
+	}
+	return response, nil
+}
+
+// streamResponse sends a streaming request and forwards answer text deltas to
+// progress. It returns the latest response snapshot the stream carried, which
+// is non-nil once the response was created even if the stream then failed.
+func (p *ResponsesProvider) streamResponse(ctx context.Context, params responses.ResponseNewParams, opts []option.RequestOption, progress *progressReporter) (*responses.Response, error) {
+	stream := p.client.Responses.NewStreaming(ctx, params, opts...)
+	defer stream.Close()
+
+	progress.StartAnswer()
+	defer progress.FlushPartial()
+
+	var response *responses.Response
+	var items []responses.ResponseOutputItemUnion // completed output items, in case the final snapshot omits them
+	for stream.Next() {
+		event := stream.Current()
+		switch event.Type {
+		case "response.created", "response.queued", "response.in_progress",
+			"response.completed", "response.failed", "response.incomplete":
+			snapshot := event.Response
+			response = &snapshot
+		case "response.output_text.delta":
+			progress.Partial(event.Delta.OfString)
+		case "response.output_item.added":
+			if event.Item.Type == "function_call" {
+				progress.Report("Model is calling %s", event.Item.Name)
+			}
+		case "response.output_item.done":
+			items = append(items, event.Item)
+		case "error":
+			return response, fmt.Errorf("stream error: %s", event.Message)
+		}
+	}
+	if err := stream.Err(); err != nil {
+		return response, err
+	}
+	if response == nil {
+		return nil, fmt.Errorf("stream ended without a response")
+	}
+	if response.Status == responses.ResponseStatusQueued || response.Status == responses.ResponseStatusInProgress {
+		return response, fmt.Errorf("stream ended before response %s finished", response.ID)
+	}
+
+	if len(response.Output) == 0 {
+		response.Output = items
+	}
+	return response, nil
+}
+
+// pollResponse polls a background response until it leaves the queued and
+// in-progress states. If ctx ends first, the response is cancelled and
+// returned as it stood, with the error.
+func (p *ResponsesProvider) pollResponse(ctx context.Context, response *responses.Response, progress *progressReporter) (*responses.Response, error) {
+	ticker := time.NewTicker(p.config.PollInterval)
+	defer ticker.Stop()
+
+	for response.Status == responses.ResponseStatusQueued || response.Status == responses.ResponseStatusInProgress {
+		select {
+		case <-ctx.Done():
+			return p.cancelResponse(response.ID), ctx.Err()
+		case <-ticker.C:
+		}
+
+		id := response.ID
+		var err error
+		response, err = p.client.Responses.Get(ctx, id, responses.ResponseGetParams{})
+		if err != nil {
+			if ctx.Err() != nil {
+				return p.cancelResponse(id), fmt.Errorf("failed to poll response %s: %w", id, err)
+			}
+			return nil, fmt.Errorf("failed to poll response %s: %w", id, err)
+		}
+		progress.Report("Waiting for %s: response %s", response.Model, response.Status)
+	}
+
+	log.Printf("Background response finished: id=%s status=%s", response.ID, response.Status)
+	return response, nil
+}
+
+// recordCreated notes that id was created for the calling MCP session, so
+// the session can look it up by ID later, and forgets responses older than
+// the job retention
+func (p *ResponsesProvider) recordCreated(ctx context.Context, id string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for old, created := range p.created {
+		if time.Since(created.at) > jobRetention {
+			delete(p.created, old)
+		}
+	}
+	if _, ok := p.created[id]; !ok {
+		p.created[id] = createdResponse{session: sessionID(ctx), at: time.Now()}
+	}
+}
+
+// createdFor reports whether this server created response id for the
+// calling MCP session. Other response IDs are refused: they could belong to
+// anyone sharing the API key.
+func (p *ResponsesProvider) createdFor(ctx context.Context, id string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	created, ok := p.created[id]
+	return ok && created.session == sessionID(ctx)
+}
+
+// cancelResponse cancels a background response server-side so it stops
+// consuming tokens after the caller has gone away. It returns the cancelled
+// response, whose usage is what it cost, or nil if cancelling failed.
+func (p *ResponsesProvider) cancelResponse(id string) *responses.Response {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	response, err := p.client.Responses.Cancel(ctx, id)
+	if err != nil {
+		log.Printf("WARNING: Failed to cancel response %s: %v", id, err)
+		return nil
+	}
+	log.Printf("Cancelled background response: id=%s", id)
+	return response
+}
+
+// buildTools maps the file tools to Responses API function tools
+func (p *ResponsesProvider) buildTools() []responses.ToolUnionParam {
+	var tools []responses.ToolUnionParam
+	for _, tool := range fileTools() {
+		param := responses.ToolParamOfFunction(tool.Name, tool.Parameters, false)
+		param.OfFunction.Description = openai.Opt(tool.Description)
+		tools = append(tools, param)
+	}
+	return tools
+}
+
+// extractToolCalls extracts tool calls from a response
+func extractToolCalls(response *responses.Response) []ToolCall {
+	var toolCalls []ToolCall
+
+	log.Printf("Extracting tool calls from %d output items", len(response.Output))
+	for i, item := range response.Output {
+		log.Printf("Output item %d: type=%s", i, item.Type)
+		if item.Type == "function_call" {
+			toolCalls = append(toolCalls, ToolCall{
+				ID:        item.CallID,
+				Name:      item.Name,
+				Arguments: item.Arguments,
+			})
+			log.Printf("Found function call: name=%s id=%s", item.Name, item.CallID)
+		}
+	}
+
+	return toolCalls
+}
+
+// extractTextContent extracts text content from a response
+func extractTextContent(response *responses.Response) string {
+	var textParts []string
+
+	log.Printf("Extracting text content from %d output items", len(response.Output))
+	for i, item := range response.Output {
+		log.Printf("Output item %d: type=%s content_items=%d", i, item.Type, len(item.Content))
+		if item.Type == "message" {
+			for j, contentItem := range item.Content {
+				log.Printf("  Content item %d: type=%s", j, contentItem.Type)
+				// The Responses API uses "output_text" not "text"
+				if contentItem.Type == "text" || contentItem.Type == "output_text" {
+					textParts = append(textParts, contentItem.Text)
+					log.Printf("  Found text: len=%d", len(contentItem.Text))
+				}
+			}
+		}
+	}
+
+	result := ""
+	for _, part := range textParts {
+		if result != "" {
+			result += "\n"
+		}
+		result += part
+	}
+
+	log.Printf("Extracted %d text parts, total length=%d", len(textParts), len(result))
+	return result
+}
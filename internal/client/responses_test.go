@@ -0,0 +1,138 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/lox/gpt-5-pro-mcp/internal/config"
+	"github.com/lox/gpt-5-pro-mcp/internal/conversation"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/option"
+)
+
+// responsesServer answers each Responses API request with the next of
+// outputs, and records the previous_response_id each request continued from
+func responsesServer(t *testing.T, outputs ...string) (*httptest.Server, *[]string) {
+	t.Helper()
+	var previous []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			PreviousResponseID string `json:"previous_response_id"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&request)
+		n := len(previous)
+		previous = append(previous, request.PreviousResponseID)
+		if n >= len(outputs) {
+			http.Error(w, `{"error": {"message": "unexpected request"}}`, http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"id": "resp_%d", "object": "response", "status": "completed", "model": "gpt-5-pro", "output": [%s],
+			"usage": {"input_tokens": 100, "output_tokens": 10, "total_tokens": 110}}`, n+1, outputs[n])
+	}))
+	t.Cleanup(server.Close)
+	return server, &previous
+}
+
+const (
+	functionCallOutput = `{"type": "function_call", "id": "fc_1", "call_id": "call_1", "name": "read_file", "arguments": "{\"path\": \"main.go\"}", "status": "completed"}`
+	messageOutput      = `{"type": "message", "id": "msg_1", "role": "assistant", "status": "completed", "content": [{"type": "output_text", "text": "All good", "annotations": []}]}`
+)
+
+func newTestResponsesProvider(url string) *ResponsesProvider {
+	client := openai.NewClient(option.WithBaseURL(url), option.WithAPIKey("test"), option.WithMaxRetries(0))
+	return NewResponsesProvider(&client, &config.Config{})
+}
+
+func TestResponsesTurnSavesOnlyAnsweredResponses(t *testing.T) {
+	server, previous := responsesServer(t, functionCallOutput, messageOutput)
+	provider := newTestResponsesProvider(server.URL)
+	settings := callSettings{Model: "gpt-5-pro"}
+	progress := newProgressReporter(context.Background(), mcp.CallToolRequest{})
+
+	state := conversation.State{ResponseID: "resp_earlier"}
+	turn := provider.NewTurn(state, "system", "What does main.go do?")
+
+	reply, err := turn.Send(context.Background(), settings, progress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reply.ToolCalls) != 1 {
+		t.Fatalf("got %d tool calls, want 1", len(reply.ToolCalls))
+	}
+
+	// A call stopped here must not leave the conversation on a response
+	// waiting for function output
+	turn.Save(&state)
+	if state.ResponseID != "resp_earlier" {
+		t.Fatalf("ResponseID = %q after a function call, want the previous response", state.ResponseID)
+	}
+
+	turn.AddToolResult(reply.ToolCalls[0], "package main", false)
+	reply, err = turn.Send(context.Background(), settings, progress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	turn.Save(&state)
+	if reply.Text != "All good" || state.ResponseID != "resp_2" {
+		t.Fatalf("got text %q and ResponseID %q, want the answer saved", reply.Text, state.ResponseID)
+	}
+	if want := []string{"resp_earlier", "resp_1"}; fmt.Sprint(*previous) != fmt.Sprint(want) {
+		t.Fatalf("requests continued from %v, want %v", *previous, want)
+	}
+}
+
+func TestProbedProviderRetriesFailedProbes(t *testing.T) {
+	type result struct{ supported, known bool }
+	tests := []struct {
+		name    string
+		results []result // what each probe finds
+		want    []string // the API each call uses
+	}{
+		{
+			name:    "failed probe retried",
+			results: []result{{false, false}, {true, true}},
+			want:    []string{"chat", "chat", "responses", "responses"},
+		},
+		{
+			name:    "supported",
+			results: []result{{true, true}},
+			want:    []string{"responses", "responses"},
+		},
+		{
+			name:    "unsupported",
+			results: []result{{false, true}},
+			want:    []string{"chat", "chat"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			responses, chat := &ResponsesProvider{}, &ChatCompletionsProvider{}
+			probes := 0
+			p := &probedProvider{endpoint: "test", responses: responses, chat: chat, probe: func() (bool, bool) {
+				r := tt.results[probes]
+				probes++
+				return r.supported, r.known
+			}}
+
+			for i, want := range tt.want {
+				if i == 2 {
+					p.retryAt = time.Time{} // the retry interval has passed
+				}
+				got := map[Provider]string{responses: "responses", chat: "chat"}[p.provider()]
+				if got != want {
+					t.Errorf("call %d used %s, want %s", i+1, got, want)
+				}
+			}
+			if probes != len(tt.results) {
+				t.Errorf("probed %d times, want %d", probes, len(tt.results))
+			}
+		})
+	}
+}
@@ -0,0 +1,182 @@
+package client
+
+import (
+	"cmp"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/lox/gpt-5-pro-mcp/internal/conversation"
+	"github.com/lox/gpt-5-pro-mcp/internal/fileops"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// reviewContextLines is how many lines around each change code_review
+// attaches, on top of the diff's own context
+const reviewContextLines = 20
+
+// reviewPassthrough are the gpt-5-pro arguments code_review forwards as is
+var reviewPassthrough = []string{"conversation_id", "model", "reasoning_effort", "verbosity", "timeout_seconds", "override_budget"}
+
+// reviewSeverities are the severities a finding may have, most serious first
+var reviewSeverities = []string{"critical", "high", "medium", "low", "info"}
+
+// jsonBlock matches a fenced json code block in an answer
+var jsonBlock = regexp.MustCompile("(?s)```json[ \t]*\n(.*?)\n```")
+
+// Review is the structured result of code_review
+type Review struct {
+	Summary        string          `json:"summary"`
+	Findings       []ReviewFinding `json:"findings"`
+	ConversationID string          `json:"conversation_id,omitempty"` // the conversation holding the review
+}
+
+// ReviewFinding is one problem code_review found
+type ReviewFinding struct {
+	File         string `json:"file"`
+	Line         int    `json:"line"`
+	Severity     string `json:"severity"`
+	Message      string `json:"message"`
+	SuggestedFix string `json:"suggested_fix,omitempty"`
+}
+
+// HandleCodeReview reviews the changes between a base ref and a head ref,
+// or the working tree. It computes the diff and the code around each change
+// itself, consults the model as gpt-5-pro would in a fresh conversation, and
+// returns the review as markdown with the findings as structured content.
+// The conversation is a new review conversation unless the caller named
+// one, so a review never resets the session's conversation.
+func (c *GPT5ProClient) HandleCodeReview(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	base, err := request.RequireString("base")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	opts := fileops.GitDiffOptions{
+		Path: request.GetString("path", ""),
+		Base: base,
+		Head: request.GetString("head", ""),
+	}
+
+	diff, err := c.fileOps.GitDiff(ctx, opts)
+	if err != nil {
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to compute the diff: %v", err)), nil
+	}
+	if diff == "" {
+		return mcp.NewToolResultText(fmt.Sprintf("No changes between %s and %s to review.", base, cmp.Or(opts.Head, "the working tree"))), nil
+	}
+	changeContext, err := c.fileOps.GitChangeContext(ctx, opts, reviewContextLines)
+	if err != nil {
+		log.Printf("Reviewing without change context: %v", err)
+	}
+	log.Printf("[CodeReview] base=%s head=%s path=%q diff_len=%d context_len=%d",
+		base, opts.Head, opts.Path, len(diff), len(changeContext))
+
+	args := map[string]any{
+		"prompt":              reviewPrompt(opts, request.GetString("instructions", ""), diff, changeContext),
+		"continue":            false,
+		"wait":                true,
+		"auto_gather_context": false,
+	}
+	for _, name := range reviewPassthrough {
+		if value, ok := request.GetArguments()[name]; ok {
+			args[name] = value
+		}
+	}
+	conversationID := request.GetString("conversation_id", "")
+	if conversationID == "" {
+		conversationID = newReviewID()
+		args["conversation_id"] = conversationID
+	}
+	consultation := request
+	consultation.Params.Arguments = args
+	consultation.Params.RawArguments = nil
+
+	result, err := c.Handle(ctx, consultation)
+	if err != nil || result.IsError || len(result.Content) == 0 {
+		return result, err
+	}
+	answer, ok := result.Content[0].(mcp.TextContent)
+	if !ok {
+		return result, nil
+	}
+	followUp := mcp.NewTextContent(fmt.Sprintf("Ask follow-up questions about this review with gpt-5-pro and conversation_id %q.", conversationID))
+
+	markdown, review, ok := parseReview(answer.Text)
+	if !ok {
+		log.Printf("[CodeReview] Answer has no parsable findings block, returning it as text")
+		result.Content = append(result.Content, followUp)
+		return result, nil
+	}
+	review.ConversationID = conversationID
+	encoded, _ := json.MarshalIndent(review, "", "  ")
+	result.StructuredContent = review
+	result.Content = slices.Concat([]mcp.Content{mcp.NewTextContent(markdown), mcp.NewTextContent(string(encoded))}, result.Content[1:], []mcp.Content{followUp})
+	return result, nil
+}
+
+// newReviewID returns a name for a review's conversation, unique across
+// sessions since named conversations are shared
+func newReviewID() string {
+	return conversation.ReviewPrefix + strings.ToLower(rand.Text()[:8])
+}
+
+// reviewPrompt asks for a review of diff, with the code around each change
+func reviewPrompt(opts fileops.GitDiffOptions, instructions, diff, changeContext string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Review the changes between %s and %s", opts.Base, cmp.Or(opts.Head, "the working tree"))
+	if opts.Path != "" {
+		fmt.Fprintf(&b, " in %s", opts.Path)
+	}
+	b.WriteString(" as a careful senior reviewer. Look for bugs, security problems, race conditions, " +
+		"error handling gaps, missing tests and unclear code. Only report real problems in the changed code, " +
+		"not style preferences or issues that were there before. Use the file tools to read more of the " +
+		"repository when the context below is not enough.\n")
+	if instructions != "" {
+		fmt.Fprintf(&b, "\nAdditional instructions:\n%s\n", instructions)
+	}
+
+	fmt.Fprintf(&b, "\n<diff>\n%s\n</diff>\n", diff)
+	if changeContext != "" {
+		fmt.Fprintf(&b, "\n<changed_code>\nThe code around each change after it is applied, with line numbers:\n%s\n</changed_code>\n", changeContext)
+	}
+
+	fmt.Fprintf(&b, "\nWrite the review in markdown, then end your answer with one fenced ```json block holding the findings:\n"+
+		"{\"summary\": \"one paragraph\", \"findings\": [{\"file\": \"path as in the diff\", \"line\": 42, "+
+		"\"severity\": \"one of %s\", \"message\": \"what is wrong and why\", \"suggested_fix\": \"how to fix it\"}]}\n"+
+		"Line numbers refer to the new version of the file. Use an empty findings list if there are no problems.",
+		strings.Join(reviewSeverities, ", "))
+	return b.String()
+}
+
+// parseReview splits an answer into its markdown and the findings in its
+// last json block
+func parseReview(answer string) (string, Review, bool) {
+	blocks := jsonBlock.FindAllStringSubmatchIndex(answer, -1)
+	if len(blocks) == 0 {
+		return "", Review{}, false
+	}
+	last := blocks[len(blocks)-1]
+
+	var review Review
+	if err := json.Unmarshal([]byte(answer[last[2]:last[3]]), &review); err != nil {
+		return "", Review{}, false
+	}
+	if review.Findings == nil {
+		review.Findings = []ReviewFinding{}
+	}
+	for i, finding := range review.Findings {
+		severity := strings.ToLower(strings.TrimSpace(finding.Severity))
+		if !slices.Contains(reviewSeverities, severity) {
+			severity = "info"
+		}
+		review.Findings[i].Severity = severity
+	}
+
+	markdown := strings.TrimSpace(answer[:last[0]] + answer[last[1]:])
+	return markdown, review, true
+}
@@ -0,0 +1,86 @@
+package client
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseReview(t *testing.T) {
+	tests := []struct {
+		name     string
+		answer   string
+		markdown string
+		review   Review
+		ok       bool
+	}{
+		{
+			name: "findings",
+			answer: "## Review\n\nOne problem.\n\n```json\n" +
+				`{"summary": "Mostly fine", "findings": [{"file": "a.go", "line": 3, "severity": "High", "message": "nil map", "suggested_fix": "make it"}]}` +
+				"\n```\n",
+			markdown: "## Review\n\nOne problem.",
+			review: Review{Summary: "Mostly fine", Findings: []ReviewFinding{
+				{File: "a.go", Line: 3, Severity: "high", Message: "nil map", SuggestedFix: "make it"},
+			}},
+			ok: true,
+		},
+		{
+			name:     "no findings",
+			answer:   "Looks good.\n```json\n{\"summary\": \"Fine\"}\n```",
+			markdown: "Looks good.",
+			review:   Review{Summary: "Fine", Findings: []ReviewFinding{}},
+			ok:       true,
+		},
+		{
+			name:   "unknown severity",
+			answer: "```json\n" + `{"summary": "", "findings": [{"file": "b.go", "severity": "nit", "message": "naming"}]}` + "\n```",
+			review: Review{Findings: []ReviewFinding{{File: "b.go", Severity: "info", Message: "naming"}}},
+			ok:     true,
+		},
+		{
+			name: "last block wins",
+			answer: "An example:\n```json\n{\"summary\": \"example\"}\n```\nThe review.\n" +
+				"```json\n{\"summary\": \"real\", \"findings\": []}\n```\nThanks.",
+			markdown: "An example:\n```json\n{\"summary\": \"example\"}\n```\nThe review.\n\nThanks.",
+			review:   Review{Summary: "real", Findings: []ReviewFinding{}},
+			ok:       true,
+		},
+		{
+			name:   "no block",
+			answer: "Looks good to me.",
+		},
+		{
+			name:   "invalid json",
+			answer: "```json\n{\"summary\": \"cut off\n```",
+		},
+		{
+			name:   "unclosed block",
+			answer: "```json\n{\"summary\": \"cut off\"}",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			markdown, review, ok := parseReview(tt.answer)
+			if ok != tt.ok {
+				t.Fatalf("ok = %t, want %t", ok, tt.ok)
+			}
+			if markdown != tt.markdown {
+				t.Errorf("markdown = %q, want %q", markdown, tt.markdown)
+			}
+			if !reflect.DeepEqual(review, tt.review) {
+				t.Errorf("review = %+v, want %+v", review, tt.review)
+			}
+		})
+	}
+}
+
+func TestNewReviewID(t *testing.T) {
+	id := newReviewID()
+	if !strings.HasPrefix(id, "review-") || len(id) != len("review-")+8 {
+		t.Errorf("newReviewID() = %q", id)
+	}
+	if id == newReviewID() {
+		t.Error("newReviewID returned the same ID twice")
+	}
+}
@@ -0,0 +1,62 @@
+package client
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/lox/gpt-5-pro-mcp/internal/config"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/openai/openai-go/option"
+	"github.com/openai/openai-go/shared"
+)
+
+// callSettings are the model parameters for a single consultation
+type callSettings struct {
+	Model           string
+	ReasoningEffort string
+	Verbosity       string
+	Timeout         time.Duration
+	OverrideBudget  bool
+}
+
+// resolveSettings applies the per-call model arguments over the server defaults
+func resolveSettings(cfg *config.Config, request mcp.CallToolRequest) (callSettings, error) {
+	settings := callSettings{
+		Model:           request.GetString("model", cfg.Model),
+		ReasoningEffort: request.GetString("reasoning_effort", cfg.ReasoningEffort),
+		Verbosity:       request.GetString("verbosity", cfg.Verbosity),
+		Timeout:         cfg.Timeout,
+		OverrideBudget:  request.GetBool("override_budget", false),
+	}
+
+	if seconds := request.GetFloat("timeout_seconds", 0); seconds > 0 {
+		settings.Timeout = time.Duration(seconds * float64(time.Second))
+	}
+
+	if !cfg.ModelAllowed(settings.Model) {
+		return callSettings{}, fmt.Errorf("model %q is not allowed (allowed: %v)", settings.Model, cfg.AllowedModels)
+	}
+	if err := config.ValidateReasoningEffort(settings.ReasoningEffort); err != nil {
+		return callSettings{}, err
+	}
+	if err := config.ValidateVerbosity(settings.Verbosity); err != nil {
+		return callSettings{}, err
+	}
+
+	return settings, nil
+}
+
+// reasoning returns the Responses API reasoning parameter
+func (s callSettings) reasoning() shared.ReasoningParam {
+	return shared.ReasoningParam{Effort: shared.ReasoningEffort(s.ReasoningEffort)}
+}
+
+// requestOptions returns extra request options for parameters the SDK
+// doesn't model yet. verbosityField is where the API expects verbosity:
+// "text.verbosity" for Responses, "verbosity" for Chat Completions.
+func (s callSettings) requestOptions(verbosityField string) []option.RequestOption {
+	if s.Verbosity == "" {
+		return nil
+	}
+	return []option.RequestOption{option.WithJSONSet(verbosityField, s.Verbosity)}
+}
@@ -0,0 +1,415 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/lox/gpt-5-pro-mcp/internal/fileops"
+)
+
+// fileTool describes a tool the model can call, in a form each provider
+// maps to its own API
+type fileTool struct {
+	Name        string
+	Description string
+	Parameters  map[string]any
+}
+
+// fileTools lists the tools offered to the model; runFileTool runs them
+func fileTools() []fileTool {
+	return []fileTool{
+		{"read_file", "Read numbered lines of a file inside the workspace, optionally a start_line/end_line range; long files are cut off with a notice saying where to continue", readFileParameters()},
+		{"grep_files", "Search for patterns in files using regex and glob patterns", grepFilesParameters()},
+		{"list_directory", "Show the tree below a directory with file sizes, skipping ignored files", listDirectoryParameters()},
+		{"find_files", "Find files by name or glob pattern, skipping ignored files", findFilesParameters()},
+		{"find_definition", "Show the source and doc comment of each declaration of a Go symbol", goSymbolParameters()},
+		{"find_references", "List every use of a Go symbol with its file, line and column", goSymbolParameters()},
+		{"file_outline", "List the declarations in a Go file with their line ranges and signatures", fileOutlineParameters()},
+		{"git_diff", "Show uncommitted changes, staged changes, or the changes between two refs", gitDiffParameters()},
+		{"git_log", "List the commits that touched a file or directory, newest first", gitLogParameters()},
+		{"git_blame", "Show the commit, author and date that last changed each line of a file", gitBlameParameters()},
+		{"git_show", "Show a commit's message, stats and patch", gitShowParameters()},
+	}
+}
+
+// readFileParameters is the JSON schema of the read_file tool
+func readFileParameters() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"path": map[string]any{
+				"type":        "string",
+				"description": "Path to the file to read, inside the workspace roots; relative paths start at the primary root",
+			},
+			"start_line": map[string]any{
+				"type":        "integer",
+				"description": "First line to read, counting from 1 (default: 1)",
+			},
+			"end_line": map[string]any{
+				"type":        "integer",
+				"description": "Last line to read (default: end of file)",
+			},
+			"max_bytes": map[string]any{
+				"type":        "integer",
+				"description": fmt.Sprintf("Most bytes of output to return, up to %d (default: %d)", fileops.MaxReadBytes, fileops.MaxReadBytes),
+			},
+		},
+		"required": []string{"path"},
+	}
+}
+
+// grepFilesParameters is the JSON schema of the grep_files tool
+func grepFilesParameters() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"pattern": map[string]any{
+				"type":        "string",
+				"description": "Regular expression pattern to search for, or literal text with fixed_string",
+			},
+			"path": map[string]any{
+				"type":        "string",
+				"description": "File, directory or glob pattern; ** matches any number of directories (e.g., '*.go', 'src/**/*.js'). Files ignored by .gitignore or .ignore, binary files and vendor, node_modules and .git directories are skipped",
+			},
+			"ignore_case": map[string]any{
+				"type":        "boolean",
+				"description": "Perform case-insensitive search (default: false)",
+			},
+			"fixed_string": map[string]any{
+				"type":        "boolean",
+				"description": "Treat pattern as literal text rather than a regex (default: false)",
+			},
+			"multiline": map[string]any{
+				"type":        "boolean",
+				"description": "Match against whole files so a match can span lines, e.g. 'func Foo\\(\\)\\s*\\{\\n\\s*return'; ^ and $ match at line breaks and (?s) lets . match newlines (default: false)",
+			},
+			"context": map[string]any{
+				"type":        "integer",
+				"description": fmt.Sprintf("Lines of context to show before and after each match, up to %d (default: 0)", fileops.MaxGrepContext),
+			},
+			"before": map[string]any{
+				"type":        "integer",
+				"description": "Lines of context before each match; overrides context",
+			},
+			"after": map[string]any{
+				"type":        "integer",
+				"description": "Lines of context after each match; overrides context",
+			},
+			"max_results": map[string]any{
+				"type":        "integer",
+				"description": "Most matches to return (files in files_only and count modes); the server caps this",
+			},
+			"output_mode": map[string]any{
+				"type":        "string",
+				"enum":        fileops.GrepOutputs,
+				"description": "content lists matching lines (default), files_only lists the matching files, count gives the matching lines per file",
+			},
+		},
+		"required": []string{"pattern", "path"},
+	}
+}
+
+// listDirectoryParameters is the JSON schema of the list_directory tool
+func listDirectoryParameters() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"path": map[string]any{
+				"type":        "string",
+				"description": "Directory to list (default: the primary workspace root)",
+			},
+			"depth": map[string]any{
+				"type":        "integer",
+				"description": fmt.Sprintf("Levels of the tree to show, up to %d; deeper directories show their entry count (default: %d)", fileops.MaxListDepth, fileops.DefaultListDepth),
+			},
+		},
+	}
+}
+
+// findFilesParameters is the JSON schema of the find_files tool
+func findFilesParameters() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"pattern": map[string]any{
+				"type":        "string",
+				"description": "File name or glob to find at any depth (e.g., 'config.go', '*_test.go'); a pattern with a slash matches the path below the directory instead (e.g., 'cmd/**/main.go')",
+			},
+			"path": map[string]any{
+				"type":        "string",
+				"description": "Directory to search (default: the primary workspace root)",
+			},
+			"max_results": map[string]any{
+				"type":        "integer",
+				"description": fmt.Sprintf("Most files to return, up to %d (default: %d)", fileops.MaxFindResults, fileops.MaxFindResults),
+			},
+		},
+		"required": []string{"pattern"},
+	}
+}
+
+// goSymbolParameters is the JSON schema of find_definition and find_references
+func goSymbolParameters() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"symbol": map[string]any{
+				"type":        "string",
+				"description": "Go identifier: a package-level Name, a Type.Method or Type.Field, or package.Name (e.g., 'ReadFile', 'Handler.ReadFile', 'fileops.New')",
+			},
+			"path": map[string]any{
+				"type":        "string",
+				"description": "Directory whose Go packages are searched (default: the primary workspace root)",
+			},
+		},
+		"required": []string{"symbol"},
+	}
+}
+
+// fileOutlineParameters is the JSON schema of the file_outline tool
+func fileOutlineParameters() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"path": map[string]any{
+				"type":        "string",
+				"description": "Go file to outline",
+			},
+		},
+		"required": []string{"path"},
+	}
+}
+
+// gitDiffParameters is the JSON schema of the git_diff tool
+func gitDiffParameters() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"path": map[string]any{
+				"type":        "string",
+				"description": "File or directory to limit the diff to (default: the primary workspace root)",
+			},
+			"base": map[string]any{
+				"type":        "string",
+				"description": "Ref to compare from, e.g. 'main' or 'HEAD~3'; alone it is compared to the working tree",
+			},
+			"head": map[string]any{
+				"type":        "string",
+				"description": "Ref to compare to; requires base",
+			},
+			"staged": map[string]any{
+				"type":        "boolean",
+				"description": "Show staged changes instead of unstaged ones (default: false)",
+			},
+		},
+	}
+}
+
+// gitLogParameters is the JSON schema of the git_log tool
+func gitLogParameters() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"path": map[string]any{
+				"type":        "string",
+				"description": "File or directory whose history to show (default: the primary workspace root)",
+			},
+			"ref": map[string]any{
+				"type":        "string",
+				"description": "Branch, tag, commit or range such as 'main..feature' (default: HEAD)",
+			},
+			"max_count": map[string]any{
+				"type":        "integer",
+				"description": fmt.Sprintf("Most commits to show, up to %d (default: %d)", fileops.MaxGitLogCount, fileops.DefaultGitLogCount),
+			},
+		},
+	}
+}
+
+// gitBlameParameters is the JSON schema of the git_blame tool
+func gitBlameParameters() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"path": map[string]any{
+				"type":        "string",
+				"description": "File to blame",
+			},
+			"start_line": map[string]any{
+				"type":        "integer",
+				"description": "First line to blame (default: 1)",
+			},
+			"end_line": map[string]any{
+				"type":        "integer",
+				"description": "Last line to blame (default: end of file)",
+			},
+		},
+		"required": []string{"path"},
+	}
+}
+
+// gitShowParameters is the JSON schema of the git_show tool
+func gitShowParameters() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"rev": map[string]any{
+				"type":        "string",
+				"description": "Commit to show (default: HEAD)",
+			},
+			"path": map[string]any{
+				"type":        "string",
+				"description": "File or directory to limit the patch to (default: the primary workspace root)",
+			},
+		},
+	}
+}
+
+// runFileTool runs one of the file tools on behalf of the model
+func runFileTool(ctx context.Context, files FileOps, name, argsJSON string) (string, error) {
+	switch name {
+	case "read_file":
+		var args struct {
+			Path      string `json:"path"`
+			StartLine int    `json:"start_line"`
+			EndLine   int    `json:"end_line"`
+			MaxBytes  int    `json:"max_bytes"`
+		}
+		if err := json.Unmarshal([]byte(argsJSON), &args); err != nil {
+			return "", fmt.Errorf("invalid arguments: %w", err)
+		}
+		return files.ReadFile(ctx, args.Path, fileops.ReadOptions{
+			StartLine: args.StartLine,
+			EndLine:   args.EndLine,
+			MaxBytes:  args.MaxBytes,
+		})
+
+	case "grep_files":
+		var args struct {
+			Pattern     string             `json:"pattern"`
+			Path        string             `json:"path"`
+			IgnoreCase  bool               `json:"ignore_case"`
+			FixedString bool               `json:"fixed_string"`
+			Multiline   bool               `json:"multiline"`
+			Context     int                `json:"context"`
+			Before      *int               `json:"before"`
+			After       *int               `json:"after"`
+			MaxResults  int                `json:"max_results"`
+			OutputMode  fileops.GrepOutput `json:"output_mode"`
+		}
+		if err := json.Unmarshal([]byte(argsJSON), &args); err != nil {
+			return "", fmt.Errorf("invalid arguments: %w", err)
+		}
+		opts := fileops.GrepOptions{
+			IgnoreCase:  args.IgnoreCase,
+			FixedString: args.FixedString,
+			Multiline:   args.Multiline,
+			Before:      args.Context,
+			After:       args.Context,
+			MaxResults:  args.MaxResults,
+			Output:      args.OutputMode,
+		}
+		if args.Before != nil {
+			opts.Before = *args.Before
+		}
+		if args.After != nil {
+			opts.After = *args.After
+		}
+		return files.GrepFiles(ctx, args.Pattern, args.Path, opts)
+
+	case "list_directory":
+		var args struct {
+			Path  string `json:"path"`
+			Depth int    `json:"depth"`
+		}
+		if err := json.Unmarshal([]byte(argsJSON), &args); err != nil {
+			return "", fmt.Errorf("invalid arguments: %w", err)
+		}
+		return files.ListDirectory(ctx, args.Path, args.Depth)
+
+	case "find_files":
+		var args struct {
+			Pattern    string `json:"pattern"`
+			Path       string `json:"path"`
+			MaxResults int    `json:"max_results"`
+		}
+		if err := json.Unmarshal([]byte(argsJSON), &args); err != nil {
+			return "", fmt.Errorf("invalid arguments: %w", err)
+		}
+		return files.FindFiles(ctx, args.Pattern, args.Path, args.MaxResults)
+
+	case "find_definition", "find_references":
+		var args struct {
+			Symbol string `json:"symbol"`
+			Path   string `json:"path"`
+		}
+		if err := json.Unmarshal([]byte(argsJSON), &args); err != nil {
+			return "", fmt.Errorf("invalid arguments: %w", err)
+		}
+		if name == "find_definition" {
+			return files.FindDefinition(ctx, args.Symbol, args.Path)
+		}
+		return files.FindReferences(ctx, args.Symbol, args.Path)
+
+	case "file_outline":
+		var args struct {
+			Path string `json:"path"`
+		}
+		if err := json.Unmarshal([]byte(argsJSON), &args); err != nil {
+			return "", fmt.Errorf("invalid arguments: %w", err)
+		}
+		return files.FileOutline(ctx, args.Path)
+
+	case "git_diff":
+		var args struct {
+			Path   string `json:"path"`
+			Base   string `json:"base"`
+			Head   string `json:"head"`
+			Staged bool   `json:"staged"`
+		}
+		if err := json.Unmarshal([]byte(argsJSON), &args); err != nil {
+			return "", fmt.Errorf("invalid arguments: %w", err)
+		}
+		diff, err := files.GitDiff(ctx, fileops.GitDiffOptions(args))
+		if err == nil && diff == "" {
+			return "No changes", nil
+		}
+		return diff, err
+
+	case "git_log":
+		var args struct {
+			Path     string `json:"path"`
+			Ref      string `json:"ref"`
+			MaxCount int    `json:"max_count"`
+		}
+		if err := json.Unmarshal([]byte(argsJSON), &args); err != nil {
+			return "", fmt.Errorf("invalid arguments: %w", err)
+		}
+		return files.GitLog(ctx, args.Path, args.Ref, args.MaxCount)
+
+	case "git_blame":
+		var args struct {
+			Path      string `json:"path"`
+			StartLine int    `json:"start_line"`
+			EndLine   int    `json:"end_line"`
+		}
+		if err := json.Unmarshal([]byte(argsJSON), &args); err != nil {
+			return "", fmt.Errorf("invalid arguments: %w", err)
+		}
+		return files.GitBlame(ctx, args.Path, args.StartLine, args.EndLine)
+
+	case "git_show":
+		var args struct {
+			Rev  string `json:"rev"`
+			Path string `json:"path"`
+		}
+		if err := json.Unmarshal([]byte(argsJSON), &args); err != nil {
+			return "", fmt.Errorf("invalid arguments: %w", err)
+		}
+		return files.GitShow(ctx, args.Rev, args.Path)
+
+	default:
+		return "", fmt.Errorf("unknown function: %s", name)
+	}
+}
@@ -0,0 +1,105 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/lox/gpt-5-pro-mcp/internal/conversation"
+	"github.com/lox/gpt-5-pro-mcp/internal/usage"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/openai/openai-go"
+	"github.com/openai/openai-go/responses"
+)
+
+// responseUsage extracts the token counts of a Responses API round-trip
+func responseUsage(response *responses.Response) usage.Usage {
+	return usage.Usage{
+		InputTokens:       response.Usage.InputTokens,
+		CachedInputTokens: response.Usage.InputTokensDetails.CachedTokens,
+		OutputTokens:      response.Usage.OutputTokens,
+		ReasoningTokens:   response.Usage.OutputTokensDetails.ReasoningTokens,
+	}
+}
+
+// completionUsage extracts the token counts of a Chat Completions round-trip
+func completionUsage(completion *openai.ChatCompletion) usage.Usage {
+	return usage.Usage{
+		InputTokens:       completion.Usage.PromptTokens,
+		CachedInputTokens: completion.Usage.PromptTokensDetails.CachedTokens,
+		OutputTokens:      completion.Usage.CompletionTokens,
+		ReasoningTokens:   completion.Usage.CompletionTokensDetails.ReasoningTokens,
+	}
+}
+
+// estimatedUsage guesses the usage of a request cut short before the API
+// reported it, from the size of what was sent and what came back. Reasoning
+// the model did out of sight isn't counted.
+func estimatedUsage(request any, output string) usage.Usage {
+	body, _ := json.Marshal(request)
+	return usage.Usage{
+		InputTokens:  usage.EstimateTokens(len(body)),
+		OutputTokens: usage.EstimateTokens(len(output)),
+	}
+}
+
+// charge prices one round-trip and adds it to the tool call's and the
+// conversation's running totals
+func charge(meter *usage.Meter, model string, u usage.Usage, call *usage.Usage, state *conversation.State) {
+	u = meter.Charge(model, u)
+	call.Add(u)
+	state.Usage.Add(u)
+	state.ContextTokens = u.InputTokens + u.OutputTokens
+}
+
+// chargePartial charges what a request that broke off used before it
+// stopped. Its reply isn't part of the conversation, so the context carried
+// into the next request stays as it was.
+func chargePartial(meter *usage.Meter, model string, u usage.Usage, call *usage.Usage, state *conversation.State) {
+	contextTokens := state.ContextTokens
+	charge(meter, model, u, call, state)
+	state.ContextTokens = contextTokens
+}
+
+// checkBudget estimates the next request from the conversation's context
+// plus newChars of new input, and refuses it with a tool error if it would
+// exceed a spending budget, unless the caller set override_budget
+func checkBudget(meter *usage.Meter, settings callSettings, newChars int, call usage.Usage, state conversation.State) *mcp.CallToolResult {
+	if settings.OverrideBudget {
+		return nil
+	}
+
+	estimate := usage.Usage{InputTokens: state.ContextTokens + usage.EstimateTokens(newChars)}
+	if err := meter.Check(settings.Model, estimate, call, state.Usage); err != nil {
+		log.Printf("Refusing request over budget: %v", err)
+		return mcp.NewToolResultError(fmt.Sprintf(
+			"Budget exceeded: %v. The request was not sent. Call again with override_budget=true to spend past the budget.", err))
+	}
+	return nil
+}
+
+// withUsage attaches the tool call's usage, the conversation's and today's
+// totals to an answer: always as result metadata, and as a text footer
+// unless disabled
+func withUsage(result *mcp.CallToolResult, meter *usage.Meter, footer bool, model string, call, conversation usage.Usage, turns int) *mcp.CallToolResult {
+	today := meter.Today()
+	result.Meta = mcp.NewMetaFromMap(map[string]any{
+		"usage": map[string]any{
+			"model":        model,
+			"call":         call,
+			"conversation": conversation,
+			"today":        today,
+		},
+	})
+	if !footer {
+		return result
+	}
+
+	text := fmt.Sprintf("\n\n---\nUsage: %s over %d requests\nConversation: $%.4f over %d turns; today: $%.4f",
+		call, call.Requests, conversation.Cost, turns, today.Cost)
+	if !meter.Priced(model) {
+		text += fmt.Sprintf("\nNo price configured for %s; costs exclude it (see GPT5_PRO_MCP_PRICES)", model)
+	}
+	result.Content = append(result.Content, mcp.NewTextContent(text))
+	return result
+}
@@ -0,0 +1,510 @@
+package config
+
+import (
+	"cmp"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultModel is used when neither the server config nor the caller picks a model
+	DefaultModel = "gpt-5-pro"
+	// DefaultAnthropicModel replaces DefaultModel when Anthropic is the default provider
+	DefaultAnthropicModel = "claude-opus-4-1"
+	// DefaultAnthropicBaseURL is the Anthropic API endpoint
+	DefaultAnthropicBaseURL = "https://api.anthropic.com"
+	// DefaultGeminiModel replaces DefaultModel when Gemini is the default provider
+	DefaultGeminiModel = "gemini-2.5-pro"
+	// DefaultGeminiBaseURL is the Gemini API endpoint
+	DefaultGeminiBaseURL = "https://generativelanguage.googleapis.com/v1beta"
+	// DefaultAzureAPIVersion is the Azure OpenAI API version requests use
+	DefaultAzureAPIVersion = "2025-04-01-preview"
+	// DefaultOllamaModel replaces DefaultModel when Ollama is the default provider
+	DefaultOllamaModel = "qwen3-coder"
+	// DefaultOllamaHost is where a local Ollama server listens
+	DefaultOllamaHost = "http://localhost:11434"
+	// DefaultMaxOutputTokens caps each answer on APIs that require a cap
+	DefaultMaxOutputTokens = 16384
+	// DefaultPollInterval is how often background responses are polled
+	DefaultPollInterval = 5 * time.Second
+	// DefaultTimeout bounds a whole consultation unless the caller picks a deadline
+	DefaultTimeout = 30 * time.Minute
+)
+
+// Providers that can be the default for consultations
+const (
+	ProviderOpenAI    = "openai"
+	ProviderAnthropic = "anthropic"
+	ProviderGemini    = "gemini"
+	ProviderOllama    = "ollama"
+	ProviderLocal     = "local"
+)
+
+// APIs on OpenAI-compatible endpoints
+const (
+	APIAuto      = "auto"      // Pick from the endpoint, probing it when that doesn't tell
+	APIResponses = "responses" // Responses API (/v1/responses)
+	APIChat      = "chat"      // Chat Completions API (/v1/chat/completions)
+)
+
+// How local models call tools
+const (
+	ToolsAuto     = "auto"     // Detect native tool calling per model, emulating it where missing
+	ToolsNative   = "native"   // Always use the server's native tool calling
+	ToolsEmulated = "emulated" // Always describe tools in the prompt and parse calls from text
+)
+
+var (
+	// ReasoningEfforts are the accepted reasoning_effort values
+	ReasoningEfforts = []string{"minimal", "low", "medium", "high"}
+	// Verbosities are the accepted verbosity values
+	Verbosities = []string{"low", "medium", "high"}
+)
+
+// Config holds the server configuration, read from the environment
+type Config struct {
+	Provider   string // Default provider: one of the Provider constants
+	APIKey     string // OpenAI, Azure OpenAI or OpenRouter key, empty when none is configured
+	BaseURL    string
+	OpenRouter bool // APIKey and BaseURL are OpenRouter's
+
+	// API used on each OpenAI-compatible endpoint: APIAuto, APIResponses or APIChat
+	OpenAIAPI     string // OpenAI itself or the OPENAI_BASE_URL endpoint
+	AzureAPI      string
+	OpenRouterAPI string
+	LocalAPI      string
+
+	AzureEndpoint   string // Azure OpenAI resource endpoint, set when Azure takes the place of OpenAI
+	AzureAPIVersion string // api-version query parameter, or "v1" for the v1 API
+	AzureDeployment string // Deployment serving the default model
+
+	AnthropicAPIKey  string // Enables the Anthropic Messages API for claude-* models
+	AnthropicBaseURL string
+	GeminiAPIKey     string // Enables the Gemini API for gemini-* models
+	GeminiBaseURL    string
+	OllamaHost       string // Enables Ollama's /api/chat for ollama/* models
+	LocalBaseURL     string // Enables an OpenAI-compatible local server (llama.cpp, vLLM) for local/* models
+	LocalAPIKey      string
+	LocalTools       string // Tool calling on Ollama and the local server: ToolsAuto, ToolsNative or ToolsEmulated
+	MaxOutputTokens  int64  // Output cap, including thinking, for APIs that require one
+
+	Model           string   // Default model for consultations
+	ReasoningEffort string   // Default reasoning effort, empty for the model's default
+	Verbosity       string   // Default verbosity, empty for the model's default
+	AllowedModels   []string // Models callers may select, empty to allow any
+
+	Stream       bool          // Stream answers and forward partial text to the client
+	Background   bool          // Submit Responses API requests in background mode and poll
+	PollInterval time.Duration // How often to poll background responses
+	Timeout      time.Duration // Default overall deadline for a consultation
+
+	PriceFile   string // JSON price table overriding the built-in model prices
+	UsageFooter bool   // Append token usage and cost to each answer
+
+	// Spending caps in USD and tokens; zero means unlimited
+	MaxCallCost           float64
+	MaxConversationCost   float64
+	MaxDailyCost          float64
+	MaxCallTokens         int64
+	MaxConversationTokens int64
+	MaxDailyTokens        int64
+
+	Roots []string // Directories the model may read, empty for the client's roots or the working directory
+	Deny  []string // Extra file name patterns the model may never read
+
+	// grep_files limits; zero picks the default
+	GrepWorkers        int64 // Files searched in parallel
+	GrepMaxMatches     int64 // Matches returned per search
+	GrepMaxFileMatches int64 // Matches returned per file
+
+	StateDir string // Where persistent state such as saved conversations is kept
+}
+
+// Load reads the configuration from environment variables
+func Load() (*Config, error) {
+	cfg := &Config{
+		Model:           EnvOr("GPT5_PRO_MCP_MODEL", DefaultModel),
+		ReasoningEffort: os.Getenv("GPT5_PRO_MCP_REASONING_EFFORT"),
+		Verbosity:       os.Getenv("GPT5_PRO_MCP_VERBOSITY"),
+		AllowedModels:   splitList(os.Getenv("GPT5_PRO_MCP_ALLOWED_MODELS")),
+		PriceFile:       os.Getenv("GPT5_PRO_MCP_PRICES"),
+		Roots:           filepath.SplitList(os.Getenv("GPT5_PRO_MCP_ROOTS")),
+		Deny:            splitList(os.Getenv("GPT5_PRO_MCP_DENY")),
+		StateDir:        stateDir(),
+	}
+
+	var err error
+	if cfg.Stream, err = envBool("GPT5_PRO_MCP_STREAM", true); err != nil {
+		return nil, err
+	}
+	if cfg.Background, err = envBool("GPT5_PRO_MCP_BACKGROUND", true); err != nil {
+		return nil, err
+	}
+	if cfg.PollInterval, err = envDuration("GPT5_PRO_MCP_POLL_INTERVAL", DefaultPollInterval); err != nil {
+		return nil, err
+	}
+	if cfg.Timeout, err = envDuration("GPT5_PRO_MCP_TIMEOUT", DefaultTimeout); err != nil {
+		return nil, err
+	}
+	if cfg.UsageFooter, err = envBool("GPT5_PRO_MCP_USAGE_FOOTER", true); err != nil {
+		return nil, err
+	}
+	if err := cfg.loadBudgets(); err != nil {
+		return nil, err
+	}
+	if err := cfg.loadGrep(); err != nil {
+		return nil, err
+	}
+
+	if err := cfg.loadProvider(); err != nil {
+		return nil, err
+	}
+	if os.Getenv("GPT5_PRO_MCP_MODEL") == "" {
+		switch cfg.Provider {
+		case ProviderOpenAI:
+			if cfg.AzureDeployment != "" {
+				cfg.Model = cfg.AzureDeployment
+			}
+		case ProviderAnthropic:
+			cfg.Model = DefaultAnthropicModel
+		case ProviderGemini:
+			cfg.Model = DefaultGeminiModel
+		case ProviderOllama:
+			cfg.Model = DefaultOllamaModel
+		case ProviderLocal:
+			return nil, fmt.Errorf("GPT5_PRO_MCP_MODEL must name the served model when the local server is the default provider")
+		}
+	}
+
+	if err := ValidateReasoningEffort(cfg.ReasoningEffort); err != nil {
+		return nil, fmt.Errorf("GPT5_PRO_MCP_REASONING_EFFORT: %w", err)
+	}
+	if err := ValidateVerbosity(cfg.Verbosity); err != nil {
+		return nil, fmt.Errorf("GPT5_PRO_MCP_VERBOSITY: %w", err)
+	}
+	if len(cfg.AllowedModels) > 0 && !cfg.ModelAllowed(cfg.Model) {
+		cfg.AllowedModels = append(cfg.AllowedModels, cfg.Model)
+	}
+
+	log.Printf("Default model: %s (reasoning_effort=%q verbosity=%q allowed=%v)",
+		cfg.Model, cfg.ReasoningEffort, cfg.Verbosity, cfg.AllowedModels)
+
+	return cfg, nil
+}
+
+// loadProvider picks the API endpoints and flavor from the available keys.
+// The default provider is the first of OpenAI, Anthropic, Gemini, Ollama
+// and the local server that is configured, unless GPT5_PRO_MCP_PROVIDER
+// says otherwise; the others, when configured, also serve claude-*,
+// gemini-*, ollama/* and local/* models.
+func (c *Config) loadProvider() error {
+	c.AnthropicAPIKey = os.Getenv("ANTHROPIC_API_KEY")
+	c.AnthropicBaseURL = EnvOr("ANTHROPIC_BASE_URL", DefaultAnthropicBaseURL)
+	c.GeminiAPIKey = cmp.Or(os.Getenv("GEMINI_API_KEY"), os.Getenv("GOOGLE_API_KEY"))
+	c.GeminiBaseURL = EnvOr("GEMINI_BASE_URL", DefaultGeminiBaseURL)
+	c.Provider = os.Getenv("GPT5_PRO_MCP_PROVIDER")
+	if err := c.loadLocal(); err != nil {
+		return err
+	}
+	maxTokens, err := envInt("GPT5_PRO_MCP_MAX_OUTPUT_TOKENS")
+	if err != nil {
+		return err
+	}
+	c.MaxOutputTokens = cmp.Or(maxTokens, DefaultMaxOutputTokens)
+	if c.AnthropicAPIKey != "" {
+		log.Printf("Anthropic Messages API enabled at: %s", c.AnthropicBaseURL)
+	}
+	if c.GeminiAPIKey != "" {
+		log.Printf("Gemini API enabled at: %s", c.GeminiBaseURL)
+	}
+
+	if err := c.loadOpenAI(); err != nil {
+		return err
+	}
+
+	keys := map[string]bool{
+		ProviderOpenAI:    c.APIKey != "",
+		ProviderAnthropic: c.AnthropicAPIKey != "",
+		ProviderGemini:    c.GeminiAPIKey != "",
+		ProviderOllama:    c.OllamaHost != "",
+		ProviderLocal:     c.LocalBaseURL != "",
+	}
+	if c.Provider == "" {
+		for _, provider := range []string{ProviderOpenAI, ProviderAnthropic, ProviderGemini, ProviderOllama, ProviderLocal} {
+			if keys[provider] {
+				c.Provider = provider
+				break
+			}
+		}
+	}
+
+	configured, known := keys[c.Provider]
+	switch {
+	case c.Provider == "":
+		return fmt.Errorf("one of OPENAI_API_KEY, AZURE_OPENAI_API_KEY, OPENROUTER_API_KEY, ANTHROPIC_API_KEY, GEMINI_API_KEY, OLLAMA_HOST or GPT5_PRO_MCP_LOCAL_BASE_URL environment variables is required")
+	case !known:
+		return fmt.Errorf("GPT5_PRO_MCP_PROVIDER: unknown provider %q (expected %s, %s, %s, %s or %s)", c.Provider,
+			ProviderOpenAI, ProviderAnthropic, ProviderGemini, ProviderOllama, ProviderLocal)
+	case !configured:
+		return fmt.Errorf("GPT5_PRO_MCP_PROVIDER is %s but no API key or URL for it is set", c.Provider)
+	}
+	log.Printf("Default provider: %s", c.Provider)
+	return nil
+}
+
+// loadLocal reads the local model servers. Ollama is enabled by OLLAMA_HOST,
+// or at its default address when it is the chosen provider.
+func (c *Config) loadLocal() error {
+	c.OllamaHost = os.Getenv("OLLAMA_HOST")
+	if c.OllamaHost == "" && c.Provider == ProviderOllama {
+		c.OllamaHost = DefaultOllamaHost
+	}
+	if c.OllamaHost != "" && !strings.Contains(c.OllamaHost, "://") {
+		c.OllamaHost = "http://" + c.OllamaHost // OLLAMA_HOST is often just host:port
+	}
+	c.LocalBaseURL = os.Getenv("GPT5_PRO_MCP_LOCAL_BASE_URL")
+	c.LocalAPIKey = os.Getenv("GPT5_PRO_MCP_LOCAL_API_KEY")
+
+	var err error
+	if c.LocalAPI, err = envAPI("GPT5_PRO_MCP_LOCAL_API"); err != nil {
+		return err
+	}
+	c.LocalTools = EnvOr("GPT5_PRO_MCP_LOCAL_TOOLS", ToolsAuto)
+	if !slices.Contains([]string{ToolsAuto, ToolsNative, ToolsEmulated}, c.LocalTools) {
+		return fmt.Errorf("GPT5_PRO_MCP_LOCAL_TOOLS: invalid value %q (expected %s, %s or %s)", c.LocalTools, ToolsAuto, ToolsNative, ToolsEmulated)
+	}
+
+	if c.OllamaHost != "" {
+		log.Printf("Ollama enabled at: %s", c.OllamaHost)
+	}
+	if c.LocalBaseURL != "" {
+		log.Printf("Local OpenAI-compatible server enabled at: %s", c.LocalBaseURL)
+	}
+	return nil
+}
+
+// EndpointAPI returns the API setting of the OpenAI-compatible endpoint
+// APIKey is for, and the environment variable it comes from
+func (c *Config) EndpointAPI() (api, variable string) {
+	switch {
+	case c.AzureEndpoint != "":
+		return c.AzureAPI, "GPT5_PRO_MCP_AZURE_API"
+	case c.OpenRouter:
+		return c.OpenRouterAPI, "GPT5_PRO_MCP_OPENROUTER_API"
+	}
+	return c.OpenAIAPI, "GPT5_PRO_MCP_OPENAI_API"
+}
+
+// loadOpenAI picks the OpenAI-compatible endpoint, if any key for one is
+// set, and reads the API setting of each endpoint. In auto mode OpenAI
+// itself uses the Responses API, OpenRouter uses Chat Completions, and Azure
+// and custom endpoints are probed when first used.
+func (c *Config) loadOpenAI() error {
+	var err error
+	if c.OpenAIAPI, err = envAPI("GPT5_PRO_MCP_OPENAI_API"); err != nil {
+		return err
+	}
+	if c.AzureAPI, err = envAPI("GPT5_PRO_MCP_AZURE_API"); err != nil {
+		return err
+	}
+	if c.OpenRouterAPI, err = envAPI("GPT5_PRO_MCP_OPENROUTER_API"); err != nil {
+		return err
+	}
+
+	// Check for OPENAI_API_KEY first, then Azure, then OPENROUTER_API_KEY
+	c.APIKey = os.Getenv("OPENAI_API_KEY")
+	switch {
+	case c.APIKey != "":
+		// Check for custom OpenAI base URL (for aihubmix, etc.)
+		c.BaseURL = os.Getenv("OPENAI_BASE_URL")
+		if c.BaseURL != "" {
+			log.Printf("Using custom OpenAI-compatible API with base URL: %s", c.BaseURL)
+		} else {
+			log.Printf("Using official OpenAI API")
+		}
+
+	case os.Getenv("AZURE_OPENAI_ENDPOINT") != "":
+		c.AzureEndpoint = strings.TrimSuffix(os.Getenv("AZURE_OPENAI_ENDPOINT"), "/")
+		c.AzureAPIVersion = EnvOr("AZURE_OPENAI_API_VERSION", DefaultAzureAPIVersion)
+		c.AzureDeployment = os.Getenv("AZURE_OPENAI_DEPLOYMENT")
+		c.APIKey = os.Getenv("AZURE_OPENAI_API_KEY")
+		if c.APIKey == "" {
+			return fmt.Errorf("AZURE_OPENAI_ENDPOINT is set but AZURE_OPENAI_API_KEY is not")
+		}
+		log.Printf("Using Azure OpenAI at %s with API version %s", c.AzureEndpoint, c.AzureAPIVersion)
+
+	default:
+		// Fall back to OpenRouter configuration
+		c.APIKey = os.Getenv("OPENROUTER_API_KEY")
+		if c.APIKey == "" {
+			return nil
+		}
+		c.BaseURL = EnvOr("OPENROUTER_BASE_URL", "https://openrouter.ai/api/v1")
+		c.OpenRouter = true
+		log.Printf("Using OpenRouter at: %s", c.BaseURL)
+	}
+	return nil
+}
+
+// loadBudgets reads the spending caps
+func (c *Config) loadBudgets() error {
+	var err error
+	if c.MaxCallCost, err = envFloat("GPT5_PRO_MCP_MAX_CALL_COST"); err != nil {
+		return err
+	}
+	if c.MaxConversationCost, err = envFloat("GPT5_PRO_MCP_MAX_CONVERSATION_COST"); err != nil {
+		return err
+	}
+	if c.MaxDailyCost, err = envFloat("GPT5_PRO_MCP_MAX_DAILY_COST"); err != nil {
+		return err
+	}
+	if c.MaxCallTokens, err = envInt("GPT5_PRO_MCP_MAX_CALL_TOKENS"); err != nil {
+		return err
+	}
+	if c.MaxConversationTokens, err = envInt("GPT5_PRO_MCP_MAX_CONVERSATION_TOKENS"); err != nil {
+		return err
+	}
+	if c.MaxDailyTokens, err = envInt("GPT5_PRO_MCP_MAX_DAILY_TOKENS"); err != nil {
+		return err
+	}
+	return nil
+}
+
+// loadGrep reads the grep_files limits
+func (c *Config) loadGrep() error {
+	var err error
+	if c.GrepWorkers, err = envInt("GPT5_PRO_MCP_GREP_WORKERS"); err != nil {
+		return err
+	}
+	if c.GrepMaxMatches, err = envInt("GPT5_PRO_MCP_GREP_MAX_MATCHES"); err != nil {
+		return err
+	}
+	if c.GrepMaxFileMatches, err = envInt("GPT5_PRO_MCP_GREP_MAX_FILE_MATCHES"); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ModelAllowed reports whether callers may select model
+func (c *Config) ModelAllowed(model string) bool {
+	return len(c.AllowedModels) == 0 || slices.Contains(c.AllowedModels, model)
+}
+
+// ValidateReasoningEffort checks a reasoning effort value; empty is allowed
+func ValidateReasoningEffort(effort string) error {
+	if effort != "" && !slices.Contains(ReasoningEfforts, effort) {
+		return fmt.Errorf("invalid reasoning_effort %q (expected one of %s)", effort, strings.Join(ReasoningEfforts, ", "))
+	}
+	return nil
+}
+
+// ValidateVerbosity checks a verbosity value; empty is allowed
+func ValidateVerbosity(verbosity string) error {
+	if verbosity != "" && !slices.Contains(Verbosities, verbosity) {
+		return fmt.Errorf("invalid verbosity %q (expected one of %s)", verbosity, strings.Join(Verbosities, ", "))
+	}
+	return nil
+}
+
+// EnvOr returns the environment variable value or fallback when unset
+func EnvOr(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// envBool parses a boolean environment variable
+func envBool(key string, fallback bool) (bool, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return false, fmt.Errorf("%s: invalid boolean %q", key, value)
+	}
+	return b, nil
+}
+
+// envDuration parses a duration environment variable such as "5s"
+func envDuration(key string, fallback time.Duration) (time.Duration, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return fallback, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("%s: invalid duration %q", key, value)
+	}
+	return d, nil
+}
+
+// envFloat parses a non-negative number environment variable, zero when unset
+func envFloat(key string) (float64, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return 0, nil
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil || f < 0 {
+		return 0, fmt.Errorf("%s: invalid amount %q", key, value)
+	}
+	return f, nil
+}
+
+// envInt parses a non-negative integer environment variable, zero when unset
+func envInt(key string) (int64, error) {
+	value := os.Getenv(key)
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%s: invalid count %q", key, value)
+	}
+	return n, nil
+}
+
+// envAPI reads the API setting of an OpenAI-compatible endpoint, APIAuto
+// when unset
+func envAPI(key string) (string, error) {
+	api := EnvOr(key, APIAuto)
+	if !slices.Contains([]string{APIAuto, APIResponses, APIChat}, api) {
+		return "", fmt.Errorf("%s: invalid value %q (expected %s, %s or %s)", key, api, APIAuto, APIResponses, APIChat)
+	}
+	return api, nil
+}
+
+// stateDir returns where persistent server state is kept: GPT5_PRO_MCP_STATE_DIR,
+// else $XDG_STATE_HOME/gpt-5-pro-mcp, else ~/.local/state/gpt-5-pro-mcp
+func stateDir() string {
+	if dir := os.Getenv("GPT5_PRO_MCP_STATE_DIR"); dir != "" {
+		return dir
+	}
+	if dir := os.Getenv("XDG_STATE_HOME"); dir != "" {
+		return filepath.Join(dir, "gpt-5-pro-mcp")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), "gpt-5-pro-mcp")
+	}
+	return filepath.Join(home, ".local", "state", "gpt-5-pro-mcp")
+}
+
+// splitList parses a comma-separated list, dropping empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,140 @@
+package conversation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Backend persists named conversations beyond the lifetime of the process
+type Backend interface {
+	Load(name string) (State, bool, error)
+	Save(name string, state State) error
+	Delete(name string) error
+	List() ([]Summary, error)
+}
+
+// Summary describes a stored conversation without its full history
+type Summary struct {
+	Name      string    `json:"name"`
+	Turns     int       `json:"turns"`
+	Preview   string    `json:"preview,omitempty"`
+	Cost      float64   `json:"cost_usd"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// FileBackend stores each conversation as a JSON file in a directory
+type FileBackend struct {
+	dir string
+}
+
+// record is the on-disk format of a conversation file
+type record struct {
+	Name  string `json:"name"`
+	State State  `json:"state"`
+}
+
+// NewFileBackend creates a file backend rooted at dir, creating it if needed
+func NewFileBackend(dir string) (*FileBackend, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create conversation directory: %w", err)
+	}
+	return &FileBackend{dir: dir}, nil
+}
+
+// Load reads a conversation by name
+func (b *FileBackend) Load(name string) (State, bool, error) {
+	data, err := os.ReadFile(b.path(name))
+	if errors.Is(err, os.ErrNotExist) {
+		return State{}, false, nil
+	}
+	if err != nil {
+		return State{}, false, fmt.Errorf("failed to read conversation: %w", err)
+	}
+
+	var rec record
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return State{}, false, fmt.Errorf("failed to parse conversation %s: %w", name, err)
+	}
+	return rec.State, true, nil
+}
+
+// Save writes a conversation atomically so a crash never leaves a torn file
+func (b *FileBackend) Save(name string, state State) error {
+	data, err := json.Marshal(record{Name: name, State: state})
+	if err != nil {
+		return fmt.Errorf("failed to encode conversation: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(b.dir, ".conversation-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write conversation: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write conversation: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), b.path(name)); err != nil {
+		return fmt.Errorf("failed to save conversation: %w", err)
+	}
+	return nil
+}
+
+// Delete removes a conversation; deleting a missing conversation is not an error
+func (b *FileBackend) Delete(name string) error {
+	if err := os.Remove(b.path(name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to delete conversation: %w", err)
+	}
+	return nil
+}
+
+// List returns summaries of all stored conversations, most recent first
+func (b *FileBackend) List() ([]Summary, error) {
+	entries, err := os.ReadDir(b.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list conversations: %w", err)
+	}
+
+	var summaries []Summary
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+
+		data, err := os.ReadFile(filepath.Join(b.dir, entry.Name()))
+		if err != nil {
+			continue
+		}
+		var rec record
+		if err := json.Unmarshal(data, &rec); err != nil {
+			continue
+		}
+		summaries = append(summaries, rec.State.summary(rec.Name))
+	}
+
+	sortSummaries(summaries)
+	return summaries, nil
+}
+
+// sortSummaries orders summaries most recently updated first
+func sortSummaries(summaries []Summary) {
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].UpdatedAt.After(summaries[j].UpdatedAt)
+	})
+}
+
+// path maps a conversation name to a file, escaping path separators
+func (b *FileBackend) path(name string) string {
+	return filepath.Join(b.dir, url.PathEscape(name)+".json")
+}
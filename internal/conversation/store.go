@@ -0,0 +1,386 @@
+package conversation
+
+import (
+	"cmp"
+	"container/list"
+	"context"
+	"encoding/json"
+	"log"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/lox/gpt-5-pro-mcp/internal/usage"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/openai/openai-go"
+)
+
+const (
+	// DefaultMaxEntries bounds how many conversations are kept in memory
+	DefaultMaxEntries = 1000
+	// DefaultTTL is how long an idle conversation is kept before eviction
+	DefaultTTL = 24 * time.Hour
+	// ReviewPrefix starts the names of the conversations code_review
+	// creates. They stay in memory only, so they expire like session
+	// defaults, and List leaves them out.
+	ReviewPrefix = "review-"
+
+	namedPrefix   = "conversation:"
+	sessionPrefix = "session:"
+	previewLength = 120
+)
+
+// State holds everything needed to continue a conversation
+type State struct {
+	Provider      string                                   `json:"provider,omitempty"`    // API holding the history below
+	ResponseID    string                                   `json:"response_id,omitempty"` // Responses API: last response ID
+	Messages      []openai.ChatCompletionMessageParamUnion `json:"messages,omitempty"`    // Chat Completions: full history
+	History       json.RawMessage                          `json:"history,omitempty"`     // Other APIs: full history in their own format
+	Turns         int                                      `json:"turns"`                 // Number of prompts answered
+	Preview       string                                   `json:"preview,omitempty"`     // Start of the first prompt
+	Usage         usage.Usage                              `json:"usage"`                 // Tokens and cost across all turns
+	ContextTokens int64                                    `json:"context_tokens"`        // Tokens carried into the next request
+	UpdatedAt     time.Time                                `json:"updated_at"`
+
+	generation uint64 // deletions of the conversation before this state was read
+}
+
+// Record notes that prompt was sent as a new turn of the conversation
+func (s *State) Record(prompt string) {
+	s.Turns++
+	if s.Preview == "" {
+		s.Preview = prompt
+		if len(s.Preview) > previewLength {
+			n := previewLength
+			for n > 0 && !utf8.RuneStart(s.Preview[n]) {
+				n-- // don't split a character
+			}
+			s.Preview = s.Preview[:n] + "..."
+		}
+	}
+}
+
+// Reset starts the conversation afresh, keeping its turn count and usage
+// so its spending budget carries over
+func (s *State) Reset() {
+	*s = State{Turns: s.Turns, Usage: s.Usage, generation: s.generation}
+}
+
+// ResetHistory drops what the API needs to continue the conversation,
+// keeping its turns and usage, so another API can take it over
+func (s *State) ResetHistory() {
+	s.Provider = ""
+	s.ResponseID = ""
+	s.Messages = nil
+	s.History = nil
+	s.ContextTokens = 0
+}
+
+func (s State) summary(name string) Summary {
+	return Summary{
+		Name:      name,
+		Turns:     s.Turns,
+		Preview:   s.Preview,
+		Cost:      s.Usage.Cost,
+		UpdatedAt: s.UpdatedAt,
+	}
+}
+
+// sessionKey returns the key of the calling MCP session's default conversation
+func sessionKey(ctx context.Context) string {
+	sessionID := "default"
+	if session := server.ClientSessionFromContext(ctx); session != nil && session.SessionID() != "" {
+		sessionID = session.SessionID()
+	}
+	return sessionPrefix + sessionID
+}
+
+// Store is a bounded, concurrency-safe set of conversations with LRU and
+// idle-time eviction. Named conversations are written through to an optional
+// Backend so they survive restarts; session defaults live in memory only.
+// Named conversations are shared by every session connected to the server:
+// any of them can list, resume or delete one by name.
+type Store struct {
+	mu          sync.Mutex
+	entries     map[string]*list.Element
+	order       *list.List // front is most recently used
+	locks       map[string]*keyLock
+	aliases     map[string]string // session key -> resumed named conversation key
+	generations map[string]uint64 // key -> number of times it was deleted
+	backend     Backend
+	maxEntries  int
+	ttl         time.Duration
+}
+
+type entry struct {
+	key      string
+	state    State
+	lastUsed time.Time
+}
+
+type keyLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+// NewStore creates a conversation store holding at most maxEntries
+// conversations in memory, each evicted after ttl without use. backend may be
+// nil to keep everything in memory.
+func NewStore(maxEntries int, ttl time.Duration, backend Backend) *Store {
+	if maxEntries <= 0 {
+		maxEntries = DefaultMaxEntries
+	}
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	return &Store{
+		entries:     make(map[string]*list.Element),
+		order:       list.New(),
+		locks:       make(map[string]*keyLock),
+		aliases:     make(map[string]string),
+		generations: make(map[string]uint64),
+		backend:     backend,
+		maxEntries:  maxEntries,
+		ttl:         ttl,
+	}
+}
+
+// KeyFor derives the conversation key for a tool call.
+// An explicit conversationID names a conversation directly, so callers can
+// share or resume it deliberately; otherwise each MCP session gets its own
+// default conversation so concurrent clients never continue each other's.
+// A session that resumed a named conversation continues that one instead.
+func (s *Store) KeyFor(ctx context.Context, conversationID string) string {
+	if conversationID != "" {
+		return namedPrefix + conversationID
+	}
+
+	key := sessionKey(ctx)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if named, ok := s.aliases[key]; ok {
+		return named
+	}
+	return key
+}
+
+// Lock serializes tool calls on the same conversation. Calls on different
+// keys proceed in parallel. The returned function releases the lock.
+func (s *Store) Lock(key string) func() {
+	s.mu.Lock()
+	l, ok := s.locks[key]
+	if !ok {
+		l = &keyLock{}
+		s.locks[key] = l
+	}
+	l.refs++
+	s.mu.Unlock()
+
+	l.mu.Lock()
+	return func() {
+		l.mu.Unlock()
+
+		s.mu.Lock()
+		l.refs--
+		if l.refs == 0 {
+			delete(s.locks, key)
+		}
+		s.mu.Unlock()
+	}
+}
+
+// Get returns the state for key, if present and not expired. Named
+// conversations missing from memory are loaded from the backend.
+func (s *Store) Get(key string) (State, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state, ok := s.get(key)
+	state.generation = s.generations[key]
+	return state, ok
+}
+
+// get looks key up in memory, then in the backend. Callers must hold s.mu.
+func (s *Store) get(key string) (State, bool) {
+	s.evictExpired()
+
+	if elem, ok := s.entries[key]; ok {
+		e := elem.Value.(*entry)
+		e.lastUsed = time.Now()
+		s.order.MoveToFront(elem)
+		return e.state, true
+	}
+
+	name, saved := savedName(key)
+	if !saved || s.backend == nil {
+		return State{}, false
+	}
+
+	state, ok, err := s.backend.Load(name)
+	if err != nil {
+		log.Printf("WARNING: Failed to load conversation %s: %v", name, err)
+		return State{}, false
+	}
+	if !ok {
+		return State{}, false
+	}
+
+	log.Printf("Loaded persisted conversation: name=%s turns=%d", name, state.Turns)
+	s.insert(key, state, time.Now())
+	return state, true
+}
+
+// Put stores the state for key, evicting the least recently used
+// conversation from memory when the store is full. A state read before the
+// conversation was deleted is dropped, so a call that was in flight during
+// the deletion doesn't bring the conversation back.
+func (s *Store) Put(key string, state State) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if state.generation != s.generations[key] {
+		log.Printf("Conversation was deleted during the call, not saving it: key=%s", key)
+		return
+	}
+
+	now := time.Now()
+	state.UpdatedAt = now
+
+	if elem, ok := s.entries[key]; ok {
+		e := elem.Value.(*entry)
+		e.state = state
+		e.lastUsed = now
+		s.order.MoveToFront(elem)
+	} else {
+		s.insert(key, state, now)
+	}
+
+	if name, saved := savedName(key); saved && s.backend != nil {
+		if err := s.backend.Save(name, state); err != nil {
+			log.Printf("WARNING: Failed to persist conversation %s: %v", name, err)
+		}
+	}
+}
+
+// Delete removes the conversation for key from memory and the backend
+func (s *Store) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if elem, ok := s.entries[key]; ok {
+		s.remove(elem)
+	}
+	s.generations[key]++
+	for session, named := range s.aliases {
+		if named == key {
+			delete(s.aliases, session)
+		}
+	}
+
+	if name, named := strings.CutPrefix(key, namedPrefix); named && s.backend != nil {
+		return s.backend.Delete(name)
+	}
+	return nil
+}
+
+// ForgetSession drops a disconnected session's default conversation and
+// which named conversation it resumed; nothing can reach them afterwards
+func (s *Store) ForgetSession(sessionID string) {
+	key := sessionPrefix + cmp.Or(sessionID, "default")
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if elem, ok := s.entries[key]; ok {
+		s.remove(elem)
+	}
+	delete(s.aliases, key)
+}
+
+// Exists reports whether a named conversation is stored
+func (s *Store) Exists(name string) bool {
+	_, ok := s.Get(namedPrefix + name)
+	return ok
+}
+
+// Resume makes the calling session's default conversation continue the
+// named conversation
+func (s *Store) Resume(ctx context.Context, name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.aliases[sessionKey(ctx)] = namedPrefix + name
+}
+
+// List returns summaries of the named conversations other than reviews,
+// most recent first
+func (s *Store) List() ([]Summary, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	seen := make(map[string]bool)
+	var summaries []Summary
+
+	for elem := s.order.Front(); elem != nil; elem = elem.Next() {
+		e := elem.Value.(*entry)
+		if name, saved := savedName(e.key); saved {
+			summaries = append(summaries, e.state.summary(name))
+			seen[name] = true
+		}
+	}
+
+	if s.backend != nil {
+		persisted, err := s.backend.List()
+		if err != nil {
+			return nil, err
+		}
+		for _, summary := range persisted {
+			if !seen[summary.Name] {
+				summaries = append(summaries, summary)
+			}
+		}
+	}
+
+	sortSummaries(summaries)
+	return summaries, nil
+}
+
+// savedName returns the name of a named conversation that is persisted and
+// listed, which every one but a review is
+func savedName(key string) (string, bool) {
+	name, named := strings.CutPrefix(key, namedPrefix)
+	return name, named && !strings.HasPrefix(name, ReviewPrefix)
+}
+
+// insert adds a new entry and enforces the size bound. Callers must hold s.mu.
+func (s *Store) insert(key string, state State, now time.Time) {
+	s.entries[key] = s.order.PushFront(&entry{key: key, state: state, lastUsed: now})
+
+	for s.order.Len() > s.maxEntries {
+		oldest := s.order.Back()
+		log.Printf("Evicting least recently used conversation: key=%s", oldest.Value.(*entry).key)
+		s.remove(oldest)
+	}
+}
+
+// evictExpired drops conversations idle for longer than the TTL from memory.
+// Persisted conversations remain in the backend. Callers must hold s.mu.
+func (s *Store) evictExpired() {
+	cutoff := time.Now().Add(-s.ttl)
+	for elem := s.order.Back(); elem != nil; {
+		e := elem.Value.(*entry)
+		if e.lastUsed.After(cutoff) {
+			return
+		}
+		prev := elem.Prev()
+		log.Printf("Evicting idle conversation: key=%s", e.key)
+		s.remove(elem)
+		elem = prev
+	}
+}
+
+// remove deletes an element from both indexes. Callers must hold s.mu.
+func (s *Store) remove(elem *list.Element) {
+	delete(s.entries, elem.Value.(*entry).key)
+	s.order.Remove(elem)
+}
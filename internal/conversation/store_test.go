@@ -0,0 +1,106 @@
+package conversation
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/lox/gpt-5-pro-mcp/internal/usage"
+)
+
+func TestPutAfterDeleteIsDropped(t *testing.T) {
+	store := NewStore(0, 0, nil)
+	key := namedPrefix + "investigation"
+	store.Put(key, State{Turns: 1})
+
+	// A call reads the conversation, then it is deleted while the call runs
+	inFlight, ok := store.Get(key)
+	if !ok {
+		t.Fatal("conversation not found")
+	}
+	if err := store.Delete(key); err != nil {
+		t.Fatal(err)
+	}
+	inFlight.Turns++
+	store.Put(key, inFlight)
+	if _, ok := store.Get(key); ok {
+		t.Fatal("in-flight call brought the deleted conversation back")
+	}
+
+	// Calls that start after the deletion save as usual, fresh or not
+	fresh, _ := store.Get(key)
+	fresh.Reset()
+	fresh.Record("again")
+	store.Put(key, fresh)
+	if state, ok := store.Get(key); !ok || state.Turns != 1 {
+		t.Fatalf("got %+v, %t; want the new conversation", state, ok)
+	}
+}
+
+func TestResetKeepsUsage(t *testing.T) {
+	state := State{ResponseID: "resp_1", Turns: 3, Preview: "first", Usage: usage.Usage{Requests: 5, Cost: 1.5}, ContextTokens: 900}
+	state.Reset()
+	if state.ResponseID != "" || state.Preview != "" || state.ContextTokens != 0 {
+		t.Errorf("history survived the reset: %+v", state)
+	}
+	if state.Turns != 3 || state.Usage.Cost != 1.5 {
+		t.Errorf("reset dropped turns or usage: %+v", state)
+	}
+}
+
+func TestPreviewKeepsCharactersWhole(t *testing.T) {
+	var state State
+	state.Record(strings.Repeat("a", previewLength-1) + "é and more")
+	if !utf8.ValidString(state.Preview) {
+		t.Fatalf("preview %q is not valid UTF-8", state.Preview)
+	}
+	if want := strings.Repeat("a", previewLength-1) + "..."; state.Preview != want {
+		t.Errorf("Preview = %q, want %q", state.Preview, want)
+	}
+}
+
+func TestForgetSession(t *testing.T) {
+	store := NewStore(0, 0, nil)
+	store.Put(namedPrefix+"shared", State{Turns: 1})
+	store.Put(sessionPrefix+"abc", State{Turns: 2})
+	store.aliases[sessionPrefix+"abc"] = namedPrefix + "shared"
+
+	store.ForgetSession("abc")
+	if _, ok := store.Get(sessionPrefix + "abc"); ok {
+		t.Error("session conversation survived the session")
+	}
+	if len(store.aliases) != 0 {
+		t.Errorf("aliases = %v, want none", store.aliases)
+	}
+	if _, ok := store.Get(namedPrefix + "shared"); !ok {
+		t.Error("named conversation went with the session that resumed it")
+	}
+}
+
+func TestReviewConversationsStayInMemory(t *testing.T) {
+	backend, err := NewFileBackend(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := NewStore(0, 0, backend)
+	store.Put(namedPrefix+"design", State{Turns: 1})
+	store.Put(namedPrefix+ReviewPrefix+"abc", State{Turns: 1})
+
+	if _, ok := store.Get(namedPrefix + ReviewPrefix + "abc"); !ok {
+		t.Error("review conversation can't be continued")
+	}
+	summaries, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(summaries) != 1 || summaries[0].Name != "design" {
+		t.Errorf("List() = %+v, want only the design conversation", summaries)
+	}
+	saved, err := backend.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(saved) != 1 || saved[0].Name != "design" {
+		t.Errorf("saved %+v, want only the design conversation", saved)
+	}
+}
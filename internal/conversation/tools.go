@@ -0,0 +1,74 @@
+package conversation
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// HandleList lists named conversations that can be resumed
+func (s *Store) HandleList(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	summaries, err := s.List()
+	if err != nil {
+		log.Printf("ERROR: Failed to list conversations: %v", err)
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to list conversations: %v", err)), nil
+	}
+
+	if len(summaries) == 0 {
+		return mcp.NewToolResultText("No saved conversations. Pass conversation_id to gpt-5-pro to start a named conversation."), nil
+	}
+
+	var builder strings.Builder
+	builder.WriteString(fmt.Sprintf("%d saved conversations:\n", len(summaries)))
+	for _, summary := range summaries {
+		builder.WriteString(fmt.Sprintf("\n- %s (%d turns, $%.2f, updated %s)\n",
+			summary.Name, summary.Turns, summary.Cost, summary.UpdatedAt.Local().Format(time.DateTime)))
+		if summary.Preview != "" {
+			builder.WriteString(fmt.Sprintf("  %s\n", summary.Preview))
+		}
+	}
+
+	return mcp.NewToolResultText(builder.String()), nil
+}
+
+// HandleResume makes the calling session continue a named conversation
+func (s *Store) HandleResume(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	name, err := request.RequireString("conversation_id")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	if !s.Exists(name) {
+		return mcp.NewToolResultError(fmt.Sprintf("Conversation %q not found. Use list_conversations to see saved conversations.", name)), nil
+	}
+
+	s.Resume(ctx, name)
+	log.Printf("Resumed conversation: name=%s session=%s", name, sessionKey(ctx))
+
+	return mcp.NewToolResultText(fmt.Sprintf(
+		"Resumed conversation %q. Subsequent gpt-5-pro calls in this session continue it.", name)), nil
+}
+
+// HandleDelete removes a named conversation from memory and disk
+func (s *Store) HandleDelete(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	name, err := request.RequireString("conversation_id")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+
+	if !s.Exists(name) {
+		return mcp.NewToolResultError(fmt.Sprintf("Conversation %q not found", name)), nil
+	}
+
+	if err := s.Delete(namedPrefix + name); err != nil {
+		log.Printf("ERROR: Failed to delete conversation %s: %v", name, err)
+		return mcp.NewToolResultError(fmt.Sprintf("Failed to delete conversation: %v", err)), nil
+	}
+
+	log.Printf("Deleted conversation: name=%s", name)
+	return mcp.NewToolResultText(fmt.Sprintf("Deleted conversation %q", name)), nil
+}
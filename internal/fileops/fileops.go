@@ -1,111 +1,56 @@
 package fileops
 
 import (
-	"bufio"
+	"bytes"
 	"context"
 	"fmt"
-	"os"
-	"path/filepath"
-	"regexp"
-	"strings"
 )
 
-// Handler provides file operation capabilities
-type Handler struct{}
+// ctxCheckInterval is how many lines GrepFiles scans between cancellation checks
+const ctxCheckInterval = 10000
 
-// New creates a new file operations handler
-func New() *Handler {
-	return &Handler{}
-}
+// sniffLen is how much of a file looksBinary needs, the same as git uses
+const sniffLen = 8000
 
-// ReadFile reads a file and returns its contents
-func (h *Handler) ReadFile(ctx context.Context, path string) (string, error) {
-	// Expand ~ to home directory
-	if strings.HasPrefix(path, "~") {
-		home, err := os.UserHomeDir()
-		if err != nil {
-			return "", fmt.Errorf("failed to get home directory: %w", err)
-		}
-		path = filepath.Join(home, path[1:])
-	}
+// Handler provides file operation capabilities, confined to a sandbox
+type Handler struct {
+	sandbox *Sandbox
+	limits  GrepLimits
+}
 
-	// Read the file
-	content, err := os.ReadFile(path)
-	if err != nil {
-		return "", fmt.Errorf("failed to read file: %w", err)
-	}
+// New creates a new file operations handler
+func New(sandbox *Sandbox, limits GrepLimits) *Handler {
+	return &Handler{sandbox: sandbox, limits: limits.withDefaults()}
+}
 
-	return string(content), nil
+// Roots returns the workspace roots for the calling session, primary first
+func (h *Handler) Roots(ctx context.Context) []string {
+	return h.sandbox.Roots(ctx)
 }
 
-// GrepFiles searches for a pattern in files
-func (h *Handler) GrepFiles(ctx context.Context, pattern, pathPattern string, ignoreCase bool) (string, error) {
-	// Compile regex
-	flags := ""
-	if ignoreCase {
-		flags = "(?i)"
-	}
-	re, err := regexp.Compile(flags + pattern)
+// GrepFiles searches for a pattern in the text files matching pathPattern
+func (h *Handler) GrepFiles(ctx context.Context, pattern, pathPattern string, opts GrepOptions) (string, error) {
+	s, err := h.newSearch(pattern, opts)
 	if err != nil {
-		return "", fmt.Errorf("invalid regex pattern: %w", err)
+		return "", err
 	}
 
-	// Expand ~ to home directory
-	if strings.HasPrefix(pathPattern, "~") {
-		home, err := os.UserHomeDir()
-		if err != nil {
-			return "", fmt.Errorf("failed to get home directory: %w", err)
-		}
-		pathPattern = filepath.Join(home, pathPattern[1:])
+	found, stats, walked, err := h.grep(ctx, s, pathPattern)
+	if ctx.Err() != nil {
+		return "", fmt.Errorf("search interrupted: %w", ctx.Err())
 	}
-
-	// Find matching files
-	matches, err := filepath.Glob(pathPattern)
 	if err != nil {
-		return "", fmt.Errorf("invalid path pattern: %w", err)
+		return "", err
 	}
-
-	if len(matches) == 0 {
+	if walked == 0 {
 		return "No files matched the pattern", nil
 	}
 
-	var results []string
-
-	// Search each file
-	for _, path := range matches {
-		info, err := os.Stat(path)
-		if err != nil || info.IsDir() {
-			continue
-		}
-
-		file, err := os.Open(path)
-		if err != nil {
-			continue
-		}
-
-		scanner := bufio.NewScanner(file)
-		lineNum := 0
-		var fileResults []string
-
-		for scanner.Scan() {
-			lineNum++
-			line := scanner.Text()
-			if re.MatchString(line) {
-				fileResults = append(fileResults, fmt.Sprintf("%d:%s", lineNum, line))
-			}
-		}
-
-		file.Close()
-
-		if len(fileResults) > 0 {
-			results = append(results, fmt.Sprintf("\n%s:", path))
-			results = append(results, fileResults...)
-		}
-	}
-
-	if len(results) == 0 {
-		return "No matches found", nil
-	}
+	return formatGrep(found, stats, s), nil
+}
 
-	return strings.Join(results, "\n"), nil
+// looksBinary reports whether the start of a file contains a NUL byte,
+// which is how git tells binary files from text
+func looksBinary(head []byte) bool {
+	return bytes.IndexByte(head, 0) >= 0
 }
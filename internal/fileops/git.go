@@ -0,0 +1,335 @@
+package fileops
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+const (
+	// DefaultGitLogCount is how many commits git_log shows by default
+	DefaultGitLogCount = 20
+	// MaxGitLogCount is the most commits git_log shows
+	MaxGitLogCount = 100
+)
+
+// gitRevision matches the revisions the git tools accept: names, hashes
+// and suffixes such as ~2, ^ or @{1}, but nothing that reads as an option
+var gitRevision = regexp.MustCompile(`^[A-Za-z0-9_./@{}~^][A-Za-z0-9_./@{}~^-]*$`)
+
+// GitDiffOptions choose what git_diff compares. With no refs it shows
+// unstaged changes, or staged ones with Staged; with Base alone it compares
+// Base to the working tree; with both refs it compares them.
+type GitDiffOptions struct {
+	Path   string // File or directory to limit the diff to, default the primary root
+	Base   string
+	Head   string
+	Staged bool
+}
+
+// GitDiff shows changes in the repository holding opts.Path. It returns an
+// empty string when nothing changed.
+func (h *Handler) GitDiff(ctx context.Context, opts GitDiffOptions) (string, error) {
+	if opts.Head != "" && opts.Base == "" {
+		return "", fmt.Errorf("head needs a base to compare against")
+	}
+	if opts.Staged && opts.Head != "" {
+		return "", fmt.Errorf("staged compares the index and can't be used with head")
+	}
+	if err := checkRevisions(opts.Base, opts.Head); err != nil {
+		return "", err
+	}
+	dir, pathspec, err := h.gitTarget(ctx, opts.Path)
+	if err != nil {
+		return "", err
+	}
+
+	args := []string{"diff", "--no-ext-diff", "--no-textconv", "--stat", "--patch"}
+	if opts.Staged {
+		args = append(args, "--cached")
+	}
+	args = append(args, "--end-of-options")
+	for _, rev := range []string{opts.Base, opts.Head} {
+		if rev != "" {
+			args = append(args, rev)
+		}
+	}
+	return h.git(ctx, dir, append(append(args, "--"), pathspec...)...)
+}
+
+// GitLog lists the commits touching path, newest first, up to count of them
+// reachable from ref, or from HEAD when ref is empty
+func (h *Handler) GitLog(ctx context.Context, path, ref string, count int) (string, error) {
+	if count < 0 || count > MaxGitLogCount {
+		return "", fmt.Errorf("max_count must be between 1 and %d, or 0 for the default of %d", MaxGitLogCount, DefaultGitLogCount)
+	}
+	if count == 0 {
+		count = DefaultGitLogCount
+	}
+	if err := checkRevisions(ref); err != nil {
+		return "", err
+	}
+	dir, pathspec, err := h.gitTarget(ctx, path)
+	if err != nil {
+		return "", err
+	}
+
+	args := []string{"log", "--no-ext-diff", "--no-textconv", "--date=short", "--shortstat",
+		"--format=%h %ad %an%n    %s", "-n", strconv.Itoa(count), "--end-of-options"}
+	if ref != "" {
+		args = append(args, ref)
+	}
+	out, err := h.git(ctx, dir, append(append(args, "--"), pathspec...)...)
+	if err != nil {
+		return "", err
+	}
+	if out == "" {
+		return "No commits found", nil
+	}
+	return out, nil
+}
+
+// GitBlame shows who last changed each line of a file between startLine
+// and endLine, inclusive; zero values mean the start and end of the file
+func (h *Handler) GitBlame(ctx context.Context, path string, startLine, endLine int) (string, error) {
+	if startLine < 0 || endLine < 0 || (endLine > 0 && endLine < startLine) {
+		return "", fmt.Errorf("invalid line range %d-%d", startLine, endLine)
+	}
+	real, err := h.sandbox.Resolve(ctx, path)
+	if err != nil {
+		return "", err
+	}
+	if info, err := os.Stat(real); err != nil || info.IsDir() {
+		return "", fmt.Errorf("%s is not a file", path)
+	}
+
+	args := []string{"blame", "--no-textconv", "--date=short"}
+	if startLine > 0 || endLine > 0 {
+		args = append(args, "-L", fmt.Sprintf("%d,%s", max(startLine, 1), optionalLine(endLine)))
+	}
+	return h.git(ctx, filepath.Dir(real), append(args, "--", real)...)
+}
+
+// GitShow shows a commit's message, stats and patch, limited to path
+func (h *Handler) GitShow(ctx context.Context, rev, path string) (string, error) {
+	if rev == "" {
+		rev = "HEAD"
+	}
+	if err := checkRevisions(rev); err != nil {
+		return "", err
+	}
+	dir, pathspec, err := h.gitTarget(ctx, path)
+	if err != nil {
+		return "", err
+	}
+
+	args := []string{"show", "--no-ext-diff", "--no-textconv", "--date=iso", "--stat", "--patch", "--end-of-options", rev, "--"}
+	return h.git(ctx, dir, append(args, pathspec...)...)
+}
+
+// hunkHeader matches the new-side range of a unified diff hunk
+var hunkHeader = regexp.MustCompile(`^@@ -\d+(?:,\d+)? \+(\d+)(?:,(\d+))? @@`)
+
+// GitChangeContext returns the code around each change in the diff opts
+// selects, as it reads after the change: lines of context either side of
+// every hunk, numbered, for each changed file. Files are read from Head
+// when it is set, from the index when Staged, and otherwise from the
+// working tree. Deleted and binary files are skipped.
+func (h *Handler) GitChangeContext(ctx context.Context, opts GitDiffOptions, lines int) (string, error) {
+	if err := checkRevisions(opts.Base, opts.Head); err != nil {
+		return "", err
+	}
+	dir, pathspec, err := h.gitTarget(ctx, opts.Path)
+	if err != nil {
+		return "", err
+	}
+	top, err := h.git(ctx, dir, "rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", err
+	}
+
+	// The file names come NUL-separated so no quoting gets in the way, and
+	// in the same order as the sections of the patch
+	args := []string{"diff", "--no-ext-diff", "--no-textconv", "--no-color", "--no-relative", "--diff-filter=d"}
+	if opts.Staged {
+		args = append(args, "--cached")
+	}
+	args = append(args, "--end-of-options")
+	for _, rev := range []string{opts.Base, opts.Head} {
+		if rev != "" {
+			args = append(args, rev)
+		}
+	}
+	args = append(append(args, "--"), pathspec...)
+	names, err := h.git(ctx, dir, slices.Concat(args[:1], []string{"--name-only", "-z"}, args[1:])...)
+	if err != nil {
+		return "", err
+	}
+	diff, err := h.git(ctx, dir, slices.Concat(args[:1], []string{"--unified=0"}, args[1:])...)
+	if err != nil {
+		return "", err
+	}
+	files := strings.Split(strings.TrimSuffix(names, "\x00"), "\x00")
+	if names == "" {
+		files = nil
+	}
+
+	// Changed line ranges per file, on the new side
+	type lineRange struct{ from, to int }
+	ranges := make(map[string][]lineRange)
+	section := -1
+	current := ""
+	for line := range strings.Lines(diff) {
+		line = strings.TrimSuffix(line, "\n")
+		if strings.HasPrefix(line, "diff --git ") {
+			section++
+			current = ""
+			if section < len(files) {
+				current = files[section]
+			}
+			continue
+		}
+		m := hunkHeader.FindStringSubmatch(line)
+		if current == "" || m == nil {
+			continue
+		}
+		start, _ := strconv.Atoi(m[1])
+		count := 1
+		if m[2] != "" {
+			count, _ = strconv.Atoi(m[2])
+		}
+		r := lineRange{max(start-lines, 1), start + max(count, 1) - 1 + lines}
+		if rs := ranges[current]; len(rs) > 0 && r.from <= rs[len(rs)-1].to+1 {
+			rs[len(rs)-1].to = max(rs[len(rs)-1].to, r.to)
+		} else {
+			ranges[current] = append(rs, r)
+		}
+	}
+
+	var b strings.Builder
+	for _, name := range files {
+		if len(ranges[name]) == 0 {
+			continue // binary, or only its mode changed
+		}
+		if b.Len() > MaxReadBytes {
+			fmt.Fprintf(&b, "[context for the remaining files left out; read them with read_file]\n")
+			break
+		}
+		var content string
+		switch {
+		case opts.Head != "":
+			content, err = h.git(ctx, top, "show", "--no-textconv", "--end-of-options", opts.Head+":"+name)
+		case opts.Staged:
+			content, err = h.git(ctx, top, "show", "--no-textconv", "--end-of-options", ":"+name)
+		default:
+			var real string
+			if real, err = h.sandbox.Resolve(ctx, filepath.Join(top, name)); err == nil {
+				var data []byte
+				data, err = os.ReadFile(real)
+				content = string(data)
+			}
+		}
+		if err != nil || looksBinary([]byte(content[:min(len(content), sniffLen)])) {
+			continue
+		}
+
+		fileLines := strings.Split(content, "\n")
+		fmt.Fprintf(&b, "==> %s\n", name)
+		for i, r := range ranges[name] {
+			if i > 0 {
+				b.WriteString("...\n")
+			}
+			for n := r.from; n <= min(r.to, len(fileLines)); n++ {
+				fmt.Fprintf(&b, "%6d\t%s\n", n, displayLine([]byte(fileLines[n-1])))
+			}
+		}
+		b.WriteString("\n")
+	}
+	return strings.TrimSuffix(b.String(), "\n"), nil
+}
+
+// gitTarget resolves path through the sandbox and returns the directory to
+// run git in and a pathspec that covers path but none of the denied files.
+// Git only ever sees paths the model could read.
+func (h *Handler) gitTarget(ctx context.Context, path string) (string, []string, error) {
+	if path == "" {
+		path = "."
+	}
+	real, err := h.sandbox.Resolve(ctx, path)
+	if err != nil {
+		return "", nil, err
+	}
+	info, err := os.Stat(real)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	dir := real
+	if !info.IsDir() {
+		dir = filepath.Dir(real)
+	}
+	pathspec := []string{real}
+	for _, pattern := range h.sandbox.deny {
+		pathspec = append(pathspec, ":(exclude,glob)**/"+pattern, ":(exclude,glob)**/"+pattern+"/**")
+	}
+	return dir, pathspec, nil
+}
+
+// git runs a read-only git command in dir. External diff drivers,
+// textconv filters, fsmonitor hooks and optional index refreshes are
+// turned off, so nothing in the repository's config runs or writes. The
+// output is capped at MaxReadBytes.
+func (h *Handler) git(ctx context.Context, dir string, args ...string) (string, error) {
+	base := []string{"--no-pager", "-c", "core.fsmonitor=false", "-c", "diff.external=", "-c", "core.pager=cat"}
+	cmd := exec.CommandContext(ctx, "git", append(base, args...)...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GIT_OPTIONAL_LOCKS=0", "GIT_TERMINAL_PROMPT=0", "GIT_PAGER=cat")
+
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if ctx.Err() != nil {
+		return "", fmt.Errorf("git %s interrupted: %w", args[0], ctx.Err())
+	}
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return "", fmt.Errorf("git %s failed: %s", args[0], strings.TrimSpace(stderr.String()))
+		}
+		return "", fmt.Errorf("git %s failed: %w", args[0], err)
+	}
+
+	text := strings.TrimRight(string(out), "\n")
+	if len(text) > MaxReadBytes {
+		text = cutUTF8(text, MaxReadBytes) +
+			fmt.Sprintf("\n[output cut at %d bytes of %d; narrow the path or range to see the rest]", MaxReadBytes, len(out))
+	}
+	return text, nil
+}
+
+// checkRevisions rejects revisions git could mistake for options or that
+// use syntax beyond plain names and ancestry
+func checkRevisions(revs ...string) error {
+	for _, rev := range revs {
+		if rev != "" && !gitRevision.MatchString(rev) {
+			return fmt.Errorf("invalid git revision %q", rev)
+		}
+	}
+	return nil
+}
+
+// optionalLine renders the end of a blame range, empty for the end of file
+func optionalLine(n int) string {
+	if n == 0 {
+		return ""
+	}
+	return strconv.Itoa(n)
+}
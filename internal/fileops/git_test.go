@@ -0,0 +1,110 @@
+package fileops
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// gitRepo creates a repository with one commit of files, then applies
+// changes to the working tree
+func gitRepo(t *testing.T, files, changes map[string]string) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	root, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	run := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", args...)
+		cmd.Dir = root
+		cmd.Env = append(os.Environ(), "GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+			"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com", "GIT_CONFIG_NOSYSTEM=1", "HOME="+root)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	write := func(files map[string]string) {
+		for name, content := range files {
+			path := filepath.Join(root, name)
+			if content == "" {
+				os.Remove(path)
+				continue
+			}
+			if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	run("init", "-q")
+	run("config", "core.quotepath", "true")
+	write(files)
+	run("add", "-A")
+	run("commit", "-q", "-m", "initial")
+	write(changes)
+	return root
+}
+
+func TestGitChangeContextQuotedPaths(t *testing.T) {
+	original := "one\ntwo\nthree\nfour\nfive\n"
+	changed := "one\ntwo\nTHREE\nfour\nfive\n"
+	root := gitRepo(t, map[string]string{
+		"with space.go": original,
+		"naïve.go":      original,
+		"tab\there.go":  original,
+		"deleted.go":    original,
+	}, map[string]string{
+		"with space.go": changed,
+		"naïve.go":      changed,
+		"tab\there.go":  changed,
+		"deleted.go":    "",
+	})
+
+	h := newTestHandler(t, root, GrepLimits{})
+	out, err := h.GitChangeContext(context.Background(), GitDiffOptions{}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"with space.go", "naïve.go", "tab\there.go"} {
+		want := "==> " + name + "\n     2\ttwo\n     3\tTHREE\n     4\tfour\n"
+		if !strings.Contains(out, want) {
+			t.Errorf("missing context for %q:\n%s", name, out)
+		}
+	}
+	if strings.Contains(out, "deleted.go") || strings.Contains(out, "/dev/null") {
+		t.Errorf("deleted file in context:\n%s", out)
+	}
+}
+
+func TestGitDiffNoChanges(t *testing.T) {
+	root := gitRepo(t, map[string]string{"main.go": "package main\n"}, nil)
+	h := newTestHandler(t, root, GrepLimits{})
+
+	diff, err := h.GitDiff(context.Background(), GitDiffOptions{Base: "HEAD"})
+	if err != nil || diff != "" {
+		t.Errorf("GitDiff() = %q, %v; want nothing", diff, err)
+	}
+}
+
+func TestGitLogMaxCount(t *testing.T) {
+	root := gitRepo(t, map[string]string{"main.go": "package main\n"}, nil)
+	h := newTestHandler(t, root, GrepLimits{})
+
+	for _, count := range []int{0, 1, MaxGitLogCount} {
+		if _, err := h.GitLog(context.Background(), "", "", count); err != nil {
+			t.Errorf("GitLog(max_count=%d) = %v", count, err)
+		}
+	}
+	for _, count := range []int{-1, MaxGitLogCount + 1} {
+		if _, err := h.GitLog(context.Background(), "", "", count); err == nil {
+			t.Errorf("GitLog(max_count=%d) succeeded", count)
+		}
+	}
+}
@@ -0,0 +1,622 @@
+package fileops
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"go/types"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+const (
+	// MaxGoFiles caps the Go files one symbol lookup parses
+	MaxGoFiles = 5000
+	// MaxDefinitions caps the declarations find_definition returns
+	MaxDefinitions = 20
+	// MaxReferences caps the sites find_references returns
+	MaxReferences = 500
+	// maxTypeChecked is how many packages find_references type-checks
+	// before it falls back to matching names
+	maxTypeChecked = 20
+	// maxDefinitionBytes is how much source one definition shows
+	maxDefinitionBytes = 16 * 1024
+)
+
+// goPackage is the parsed files of one package in one directory
+type goPackage struct {
+	dir   string
+	name  string
+	files []*ast.File
+}
+
+// goSymbol is a symbol name as the model gives it: Name, Type.Name or pkg.Name
+type goSymbol struct {
+	qual string // type or package qualifier, empty for any
+	name string
+}
+
+// parseSymbol splits a symbol into its qualifier and name
+func parseSymbol(symbol string) (goSymbol, error) {
+	parts := strings.Split(strings.TrimSpace(symbol), ".")
+	switch {
+	case len(parts) == 1 && parts[0] != "":
+		return goSymbol{name: parts[0]}, nil
+	case len(parts) == 2 && parts[0] != "" && parts[1] != "":
+		return goSymbol{qual: parts[0], name: parts[1]}, nil
+	}
+	return goSymbol{}, fmt.Errorf("invalid symbol %q (expected Name, Type.Name or package.Name)", symbol)
+}
+
+// goDefinition is a declaration of a symbol
+type goDefinition struct {
+	pkg   *goPackage
+	ident *ast.Ident // the declared name
+	node  ast.Node   // the whole declaration
+	doc   *ast.CommentGroup
+}
+
+// parseGoPackages parses the Go files below dir, grouped by package. Files
+// that don't parse are counted and skipped.
+func (h *Handler) parseGoPackages(ctx context.Context, dir string) (*token.FileSet, []*goPackage, int, error) {
+	if dir == "" {
+		dir = "."
+	}
+
+	fset := token.NewFileSet()
+	byKey := make(map[string]*goPackage)
+	var packages []*goPackage
+	parsed, failed := 0, 0
+	_, err := h.walkGlob(ctx, filepath.Join(dir, "**/*.go"), func(path string) error {
+		if parsed == MaxGoFiles {
+			return errEnough
+		}
+		file, err := parser.ParseFile(fset, path, nil, parser.ParseComments|parser.SkipObjectResolution)
+		if err != nil {
+			failed++
+			return nil
+		}
+		parsed++
+
+		key := filepath.Dir(path) + "\x00" + file.Name.Name
+		pkg := byKey[key]
+		if pkg == nil {
+			pkg = &goPackage{dir: filepath.Dir(path), name: file.Name.Name}
+			byKey[key] = pkg
+			packages = append(packages, pkg)
+		}
+		pkg.files = append(pkg.files, file)
+		return nil
+	})
+	if ctx.Err() != nil {
+		return nil, nil, 0, fmt.Errorf("search interrupted: %w", ctx.Err())
+	}
+	if err != nil && !errors.Is(err, errEnough) {
+		return nil, nil, 0, err
+	}
+	if parsed == 0 {
+		return nil, nil, failed, fmt.Errorf("no Go files found in %s", dir)
+	}
+	return fset, packages, failed, nil
+}
+
+// definitions finds the declarations of sym. Unqualified names match
+// package-level declarations and methods; qualified ones match by package
+// name, or as the methods and fields of a type.
+func definitions(packages []*goPackage, sym goSymbol) []goDefinition {
+	var defs []goDefinition
+	add := func(pkg *goPackage, ident *ast.Ident, node ast.Node, doc *ast.CommentGroup) {
+		if ident.Name == sym.name {
+			defs = append(defs, goDefinition{pkg: pkg, ident: ident, node: node, doc: doc})
+		}
+	}
+
+	for _, pkg := range packages {
+		topLevel := sym.qual == "" || sym.qual == pkg.name
+		for _, file := range pkg.files {
+			for _, decl := range file.Decls {
+				switch decl := decl.(type) {
+				case *ast.FuncDecl:
+					if decl.Recv == nil {
+						if topLevel {
+							add(pkg, decl.Name, decl, decl.Doc)
+						}
+					} else if recv := receiverName(decl.Recv); sym.qual == "" || sym.qual == recv {
+						add(pkg, decl.Name, decl, decl.Doc)
+					}
+
+				case *ast.GenDecl:
+					for _, spec := range decl.Specs {
+						// A lone spec's doc comment sits on the declaration
+						node, doc := ast.Node(spec), specDoc(spec)
+						if len(decl.Specs) == 1 {
+							node, doc = decl, decl.Doc
+						}
+						switch spec := spec.(type) {
+						case *ast.TypeSpec:
+							if topLevel {
+								add(pkg, spec.Name, node, doc)
+							}
+							if sym.qual == spec.Name.Name {
+								for _, field := range typeMembers(spec.Type) {
+									for _, name := range field.Names {
+										add(pkg, name, field, field.Doc)
+									}
+								}
+							}
+						case *ast.ValueSpec:
+							if topLevel {
+								for _, name := range spec.Names {
+									add(pkg, name, node, doc)
+								}
+							}
+						}
+					}
+				}
+			}
+		}
+	}
+	return defs
+}
+
+// FindDefinition returns the source of each declaration of symbol below
+// dir, with its doc comment and position
+func (h *Handler) FindDefinition(ctx context.Context, symbol, dir string) (string, error) {
+	sym, err := parseSymbol(symbol)
+	if err != nil {
+		return "", err
+	}
+	fset, packages, failed, err := h.parseGoPackages(ctx, dir)
+	if err != nil {
+		return "", err
+	}
+
+	defs := definitions(packages, sym)
+	if len(defs) == 0 {
+		return fmt.Sprintf("No declaration of %s found%s", symbol, parseFailures(failed)), nil
+	}
+
+	var b strings.Builder
+	for i, def := range defs {
+		if i == MaxDefinitions {
+			fmt.Fprintf(&b, "[%d more declarations not shown; qualify the symbol to narrow it down]\n", len(defs)-i)
+			break
+		}
+		start := def.node.Pos()
+		if def.doc != nil && def.doc.Pos() < start {
+			start = def.doc.Pos()
+		}
+		from, to := fset.Position(start), fset.Position(def.node.End())
+		fmt.Fprintf(&b, "%s:%d-%d (package %s)\n", from.Filename, from.Line, to.Line, def.pkg.name)
+
+		src, err := os.ReadFile(from.Filename)
+		if err != nil || to.Offset > len(src) {
+			b.WriteString("[source unavailable]\n\n")
+			continue
+		}
+		text := string(src[from.Offset:to.Offset])
+		if len(text) > maxDefinitionBytes {
+			text = cutUTF8(text, maxDefinitionBytes) +
+				fmt.Sprintf("\n[cut short; read_file lines %d-%d for the rest]", from.Line, to.Line)
+		}
+		b.WriteString(text + "\n\n")
+	}
+	fmt.Fprintf(&b, "[%d declarations%s]", len(defs), parseFailures(failed))
+	return b.String(), nil
+}
+
+// FindReferences returns every use of symbol below dir with its position.
+// Packages that type-check are resolved with go/types, so only uses of
+// the declarations found count; elsewhere identifiers are matched by name.
+func (h *Handler) FindReferences(ctx context.Context, symbol, dir string) (string, error) {
+	sym, err := parseSymbol(symbol)
+	if err != nil {
+		return "", err
+	}
+	fset, packages, failed, err := h.parseGoPackages(ctx, dir)
+	if err != nil {
+		return "", err
+	}
+
+	defs := definitions(packages, sym)
+	declared := make(map[declKey]bool)
+	for _, def := range defs {
+		declared[keyOf(fset.Position(def.ident.Pos()), sym.name)] = true
+	}
+
+	// Only packages naming the symbol need resolving; without a declaration
+	// to compare against, names are all there is
+	candidates := make(map[*goPackage][]*ast.Ident)
+	var check []*goPackage
+	for _, pkg := range packages {
+		if idents := candidateIdents(pkg, sym); len(idents) > 0 {
+			candidates[pkg] = idents
+			if len(defs) > 0 && len(check) < maxTypeChecked {
+				check = append(check, pkg)
+			}
+		}
+	}
+	exports := goListExports(ctx, check)
+
+	imp := importer.ForCompiler(fset, "gc", func(path string) (io.ReadCloser, error) {
+		if pkg, ok := exports.byPath[path]; ok && pkg.export != "" {
+			return os.Open(pkg.export)
+		}
+		return nil, fmt.Errorf("no export data for %s", path)
+	})
+	var refs []token.Position
+	unresolved := 0
+	for _, pkg := range packages {
+		if ctx.Err() != nil {
+			return "", fmt.Errorf("search interrupted: %w", ctx.Err())
+		}
+		if len(candidates[pkg]) == 0 {
+			continue
+		}
+
+		var info *types.Info
+		if listed, ok := exports.byDir[pkg.dir]; ok && slices.Contains(check, pkg) {
+			path := listed.path
+			if strings.HasSuffix(pkg.name, "_test") {
+				path += "_test"
+			}
+			info = typeCheck(fset, imp, path, pkg)
+		}
+		if info == nil {
+			unresolved++
+		}
+		for _, ident := range candidates[pkg] {
+			if info != nil {
+				obj := info.Uses[ident]
+				if obj == nil {
+					obj = info.Defs[ident]
+				}
+				if obj == nil || !declared[keyOf(fset.Position(obj.Pos()), obj.Name())] {
+					continue
+				}
+			}
+			refs = append(refs, fset.Position(ident.Pos()))
+		}
+	}
+
+	if len(refs) == 0 {
+		return fmt.Sprintf("No references to %s found%s", symbol, parseFailures(failed)), nil
+	}
+	slices.SortFunc(refs, func(a, b token.Position) int {
+		if c := strings.Compare(a.Filename, b.Filename); c != 0 {
+			return c
+		}
+		return a.Offset - b.Offset
+	})
+
+	var b strings.Builder
+	lines := make(map[string][]string)
+	files := 0
+	for i, ref := range refs {
+		if i == MaxReferences {
+			fmt.Fprintf(&b, "[%d more references not shown]\n", len(refs)-i)
+			break
+		}
+		src, ok := lines[ref.Filename]
+		if !ok {
+			data, _ := os.ReadFile(ref.Filename)
+			src = strings.Split(string(data), "\n")
+			lines[ref.Filename] = src
+			files++
+		}
+		text := ""
+		if ref.Line <= len(src) {
+			text = displayLine([]byte(strings.TrimSpace(src[ref.Line-1])))
+		}
+		mark := ""
+		if declared[keyOf(ref, sym.name)] {
+			mark = " (declaration)"
+		}
+		fmt.Fprintf(&b, "%s:%d:%d%s: %s\n", ref.Filename, ref.Line, ref.Column, mark, text)
+	}
+
+	fmt.Fprintf(&b, "[%d references in %d files", len(refs), files)
+	switch {
+	case unresolved == 0:
+		b.WriteString("; resolved with go/types")
+	case len(defs) == 0:
+		b.WriteString("; no declaration found, so matched by name only")
+	default:
+		fmt.Fprintf(&b, "; %d packages could not be type-checked and were matched by name", unresolved)
+	}
+	b.WriteString(parseFailures(failed) + "]")
+	return b.String(), nil
+}
+
+// candidateIdents returns the identifiers in pkg named like sym, as bare
+// names or as the selector of a qualified one
+func candidateIdents(pkg *goPackage, sym goSymbol) []*ast.Ident {
+	var idents []*ast.Ident
+	for _, file := range pkg.files {
+		ast.Inspect(file, func(n ast.Node) bool {
+			if ident, ok := n.(*ast.Ident); ok && ident.Name == sym.name {
+				idents = append(idents, ident)
+			}
+			return true
+		})
+	}
+	return idents
+}
+
+// declKey identifies a declaration across packages loaded from source and
+// from export data, whose columns aren't exact
+type declKey struct {
+	file string
+	line int
+	name string
+}
+
+func keyOf(pos token.Position, name string) declKey {
+	return declKey{pos.Filename, pos.Line, name}
+}
+
+// listedPackage is a package as go list reports it
+type listedPackage struct {
+	path   string
+	export string // compiled export data, empty if the package doesn't build
+}
+
+// goExports maps packages to their export data
+type goExports struct {
+	byPath map[string]listedPackage
+	byDir  map[string]listedPackage
+}
+
+// goListExports asks the go command to build export data for pkgs and
+// everything they and their tests import, one module at a time. It runs
+// offline and never edits go.mod; packages in modules that don't load are
+// left out.
+func goListExports(ctx context.Context, pkgs []*goPackage) goExports {
+	exports := goExports{
+		byPath: make(map[string]listedPackage),
+		byDir:  make(map[string]listedPackage),
+	}
+	modules := make(map[string][]string)
+	for _, pkg := range pkgs {
+		if root := moduleRoot(pkg.dir); root != "" && !slices.Contains(modules[root], pkg.dir) {
+			modules[root] = append(modules[root], pkg.dir)
+		}
+	}
+
+	for root, dirs := range modules {
+		args := append([]string{"list", "-e", "-export", "-deps", "-test", "-f", "{{.ImportPath}}\t{{.Dir}}\t{{.Export}}", "--"}, dirs...)
+		cmd := exec.CommandContext(ctx, "go", args...)
+		cmd.Dir = root
+		cmd.Env = append(os.Environ(), "GOFLAGS=", "GOPROXY=off")
+		out, err := cmd.Output()
+		if err != nil {
+			continue
+		}
+		for line := range strings.Lines(string(out)) {
+			fields := strings.Split(strings.TrimSuffix(line, "\n"), "\t")
+			if len(fields) != 3 {
+				continue
+			}
+			// Test variants, "p [p.test]", are only wanted for packages
+			// that have no plain build
+			path, variant, _ := strings.Cut(fields[0], " ")
+			if _, ok := exports.byPath[path]; ok && variant != "" {
+				continue
+			}
+			pkg := listedPackage{path: path, export: fields[2]}
+			exports.byPath[path] = pkg
+			if fields[1] != "" && variant == "" {
+				exports.byDir[fields[1]] = pkg
+			}
+		}
+	}
+	return exports
+}
+
+// moduleRoot returns the directory of the go.mod governing dir, or ""
+func moduleRoot(dir string) string {
+	for {
+		if _, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// typeCheck resolves the identifiers of pkg. It returns nil if the package
+// doesn't type-check.
+func typeCheck(fset *token.FileSet, imp types.Importer, path string, pkg *goPackage) *types.Info {
+	info := &types.Info{
+		Defs: make(map[*ast.Ident]types.Object),
+		Uses: make(map[*ast.Ident]types.Object),
+	}
+	failed := false
+	conf := types.Config{
+		Importer: imp,
+		Error:    func(error) { failed = true },
+	}
+	_, _ = conf.Check(path, fset, pkg.files, info)
+	if failed {
+		return nil
+	}
+	return info
+}
+
+// FileOutline lists the declarations in a Go file with their line ranges
+// and signatures, and the first line of each doc comment
+func (h *Handler) FileOutline(ctx context.Context, path string) (string, error) {
+	real, err := h.sandbox.Resolve(ctx, path)
+	if err != nil {
+		return "", err
+	}
+	if filepath.Ext(real) != ".go" {
+		return "", fmt.Errorf("%s is not a Go file", path)
+	}
+
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, real, nil, parser.ParseComments|parser.SkipObjectResolution)
+	if file == nil {
+		return "", fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s (package %s)\n", real, file.Name.Name)
+	if err != nil {
+		fmt.Fprintf(&b, "[parse errors, outline may be incomplete: %v]\n", err)
+	}
+	entry := func(indent string, node ast.Node, doc *ast.CommentGroup, text string) {
+		from, to := fset.Position(node.Pos()).Line, fset.Position(node.End()).Line
+		lines := fmt.Sprintf("%d", from)
+		if to > from {
+			lines += fmt.Sprintf("-%d", to)
+		}
+		fmt.Fprintf(&b, "%s%-9s %s\n", indent, lines, text)
+		if summary := docSummary(doc); summary != "" {
+			fmt.Fprintf(&b, "%s%9s // %s\n", indent, "", summary)
+		}
+	}
+
+	for _, decl := range file.Decls {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			sig := *decl
+			sig.Body, sig.Doc = nil, nil
+			entry("", decl, decl.Doc, oneLine(fset, &sig))
+
+		case *ast.GenDecl:
+			if decl.Tok == token.IMPORT {
+				entry("", decl, nil, fmt.Sprintf("import (%d packages)", len(decl.Specs)))
+				continue
+			}
+			for _, spec := range decl.Specs {
+				doc := specDoc(spec)
+				if len(decl.Specs) == 1 {
+					doc = decl.Doc
+				}
+				switch spec := spec.(type) {
+				case *ast.TypeSpec:
+					header := *spec
+					members := typeMembers(spec.Type)
+					switch spec.Type.(type) {
+					case *ast.StructType:
+						header.Type = &ast.Ident{Name: "struct"}
+					case *ast.InterfaceType:
+						header.Type = &ast.Ident{Name: "interface"}
+					}
+					header.Doc, header.Comment = nil, nil
+					entry("", spec, doc, "type "+oneLine(fset, &header))
+					for _, field := range members {
+						entry("  ", field, field.Doc, fieldLine(fset, field))
+					}
+				case *ast.ValueSpec:
+					value := *spec
+					value.Doc, value.Comment = nil, nil
+					entry("", spec, doc, decl.Tok.String()+" "+oneLine(fset, &value))
+				}
+			}
+		}
+	}
+	return strings.TrimSuffix(b.String(), "\n"), nil
+}
+
+// receiverName returns the type name of a method receiver, without any
+// pointer or type parameters
+func receiverName(recv *ast.FieldList) string {
+	if recv == nil || len(recv.List) == 0 {
+		return ""
+	}
+	expr := recv.List[0].Type
+	for {
+		switch e := expr.(type) {
+		case *ast.StarExpr:
+			expr = e.X
+		case *ast.IndexExpr:
+			expr = e.X
+		case *ast.IndexListExpr:
+			expr = e.X
+		case *ast.Ident:
+			return e.Name
+		default:
+			return ""
+		}
+	}
+}
+
+// typeMembers returns the fields of a struct or the methods of an interface
+func typeMembers(expr ast.Expr) []*ast.Field {
+	switch t := expr.(type) {
+	case *ast.StructType:
+		return t.Fields.List
+	case *ast.InterfaceType:
+		return t.Methods.List
+	}
+	return nil
+}
+
+// specDoc returns the doc comment of a spec inside a grouped declaration
+func specDoc(spec ast.Spec) *ast.CommentGroup {
+	switch spec := spec.(type) {
+	case *ast.TypeSpec:
+		return spec.Doc
+	case *ast.ValueSpec:
+		return spec.Doc
+	}
+	return nil
+}
+
+// docSummary returns the first line of a doc comment
+func docSummary(doc *ast.CommentGroup) string {
+	if doc == nil {
+		return ""
+	}
+	first, _, _ := strings.Cut(strings.TrimSpace(doc.Text()), "\n")
+	return first
+}
+
+// oneLine prints a node on a single line, cut short if it is long
+func oneLine(fset *token.FileSet, node ast.Node) string {
+	var buf bytes.Buffer
+	if err := printer.Fprint(&buf, fset, node); err != nil {
+		return "?"
+	}
+	return displayLine(bytes.Join(bytes.Fields(buf.Bytes()), []byte(" ")))
+}
+
+// fieldLine prints a struct field or interface method on a single line
+func fieldLine(fset *token.FileSet, field *ast.Field) string {
+	var names []string
+	for _, name := range field.Names {
+		names = append(names, name.Name)
+	}
+	typ := oneLine(fset, field.Type)
+	if fn, ok := field.Type.(*ast.FuncType); ok && len(names) == 1 {
+		// Interface methods read as "Name(args) results"
+		return names[0] + strings.TrimPrefix(oneLine(fset, fn), "func")
+	}
+	if len(names) == 0 {
+		return typ
+	}
+	return strings.Join(names, ", ") + " " + typ
+}
+
+// parseFailures notes Go files that could not be parsed
+func parseFailures(failed int) string {
+	if failed == 0 {
+		return ""
+	}
+	return fmt.Sprintf("; %d files could not be parsed", failed)
+}
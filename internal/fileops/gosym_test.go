@@ -0,0 +1,325 @@
+package fileops
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// goModule writes a small module under mod/, a package that doesn't
+// compile inside it, and a package outside any module
+func goModule(t *testing.T) string {
+	t.Helper()
+	root, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for path, content := range map[string]string{
+		"mod/go.mod": "module example.com/shapes\n\ngo 1.21\n",
+		"mod/shapes/shapes.go": `// Package shapes measures shapes
+package shapes
+
+// Shape is anything with an area
+type Shape interface {
+	// Area returns the area
+	Area() float64
+}
+
+// Square is a square.
+// It has four sides.
+type Square struct {
+	Side float64 // length of a side
+}
+
+// Area returns the square's area
+func (s Square) Area() float64 {
+	return s.Side * s.Side
+}
+
+const (
+	// Unit is one
+	Unit = 1
+	Zero = 0
+)
+`,
+		"mod/cmd/area/main.go": `package main
+
+import (
+	"fmt"
+
+	"example.com/shapes/shapes"
+)
+
+// Area is unrelated to shapes.Square.Area
+func Area() int { return 0 }
+
+func main() {
+	fmt.Println(shapes.Square{Side: shapes.Unit}.Area(), Area())
+}
+`,
+		"mod/broken/broken.go": "package broken\n\nfunc Area() int { return missing }\n\nvar _ = Area()\n",
+		"loose/loose.go":       "package loose\n\nfunc Area() int { return 1 }\n\nvar _ = Area()\n",
+	} {
+		full := filepath.Join(root, path)
+		if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestModuleRoot(t *testing.T) {
+	root := goModule(t)
+	for dir, want := range map[string]string{
+		"mod":           "mod",
+		"mod/cmd/area":  "mod",
+		"mod/shapes":    "mod",
+		"loose":         "",
+		"missing/below": "",
+	} {
+		if want != "" {
+			want = filepath.Join(root, want)
+		}
+		if got := moduleRoot(filepath.Join(root, dir)); got != want {
+			t.Errorf("moduleRoot(%s) = %q, want %q", dir, got, want)
+		}
+	}
+}
+
+func TestGoListExports(t *testing.T) {
+	root := goModule(t)
+	pkgs := []*goPackage{
+		{dir: filepath.Join(root, "mod/shapes"), name: "shapes"},
+		{dir: filepath.Join(root, "mod/broken"), name: "broken"},
+		{dir: filepath.Join(root, "loose"), name: "loose"},
+	}
+	exports := goListExports(context.Background(), pkgs)
+
+	shapes := exports.byDir[pkgs[0].dir]
+	if shapes.path != "example.com/shapes/shapes" || shapes.export == "" {
+		t.Errorf("shapes listed as %+v, want its import path and export data", shapes)
+	}
+	if broken, ok := exports.byDir[pkgs[1].dir]; !ok || broken.export != "" {
+		t.Errorf("broken listed as %+v, %v; want it listed without export data", broken, ok)
+	}
+	if _, ok := exports.byDir[pkgs[2].dir]; ok {
+		t.Error("a package outside any module was listed")
+	}
+}
+
+func TestFindReferences(t *testing.T) {
+	root := goModule(t)
+	h := newTestHandler(t, root, GrepLimits{})
+
+	tests := []struct {
+		name   string
+		symbol string
+		dir    string
+		want   []string
+	}{
+		{
+			name:   "function, not the method of the same name",
+			symbol: "Area",
+			dir:    "mod/cmd",
+			want: []string{
+				"mod/cmd/area/main.go:10:6 (declaration): func Area() int { return 0 }",
+				"mod/cmd/area/main.go:13:55: fmt.Println(shapes.Square{Side: shapes.Unit}.Area(), Area())",
+				"[2 references in 1 files; resolved with go/types]",
+			},
+		},
+		{
+			name:   "method, not the function or interface method of that name",
+			symbol: "Square.Area",
+			dir:    "mod",
+			want: []string{
+				// broken doesn't compile, so its Area matches by name
+				"mod/broken/broken.go:3:6: func Area() int { return missing }",
+				"mod/broken/broken.go:5:9: var _ = Area()",
+				"mod/cmd/area/main.go:13:47: fmt.Println(shapes.Square{Side: shapes.Unit}.Area(), Area())",
+				"mod/shapes/shapes.go:17:17 (declaration): func (s Square) Area() float64 {",
+				"[4 references in 3 files; 1 packages could not be type-checked and were matched by name]",
+			},
+		},
+		{
+			name:   "field",
+			symbol: "Square.Side",
+			dir:    "mod",
+			want: []string{
+				"mod/cmd/area/main.go:13:28: fmt.Println(shapes.Square{Side: shapes.Unit}.Area(), Area())",
+				"mod/shapes/shapes.go:13:2 (declaration): Side float64 // length of a side",
+				"mod/shapes/shapes.go:18:11: return s.Side * s.Side",
+				"mod/shapes/shapes.go:18:20: return s.Side * s.Side",
+				"[4 references in 2 files; resolved with go/types]",
+			},
+		},
+		{
+			name:   "package-qualified constant",
+			symbol: "shapes.Unit",
+			dir:    "mod",
+			want: []string{
+				"mod/cmd/area/main.go:13:41: fmt.Println(shapes.Square{Side: shapes.Unit}.Area(), Area())",
+				"mod/shapes/shapes.go:23:2 (declaration): Unit = 1",
+				"[2 references in 2 files; resolved with go/types]",
+			},
+		},
+		{
+			name:   "outside a module",
+			symbol: "Area",
+			dir:    "loose",
+			want: []string{
+				"loose/loose.go:3:6 (declaration): func Area() int { return 1 }",
+				"loose/loose.go:5:9: var _ = Area()",
+				"[2 references in 1 files; 1 packages could not be type-checked and were matched by name]",
+			},
+		},
+		{
+			name:   "no declaration",
+			symbol: "Println",
+			dir:    "mod/cmd",
+			want: []string{
+				"mod/cmd/area/main.go:13:6: fmt.Println(shapes.Square{Side: shapes.Unit}.Area(), Area())",
+				"[1 references in 1 files; no declaration found, so matched by name only]",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := h.FindReferences(context.Background(), tt.symbol, tt.dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = strings.ReplaceAll(got, root+"/", "")
+			if want := strings.Join(tt.want, "\n"); got != want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, want)
+			}
+		})
+	}
+}
+
+func TestFindDefinition(t *testing.T) {
+	root := goModule(t)
+	h := newTestHandler(t, root, GrepLimits{})
+
+	tests := []struct {
+		symbol string
+		want   []string
+	}{
+		{
+			symbol: "Square.Area",
+			want: []string{
+				"mod/shapes/shapes.go:16-19 (package shapes)",
+				"// Area returns the square's area",
+				"func (s Square) Area() float64 {",
+				"\treturn s.Side * s.Side",
+				"}",
+				"",
+				"[1 declarations]",
+			},
+		},
+		{
+			symbol: "Shape.Area",
+			want: []string{
+				"mod/shapes/shapes.go:6-7 (package shapes)",
+				"// Area returns the area",
+				"\tArea() float64",
+				"",
+				"[1 declarations]",
+			},
+		},
+		{
+			symbol: "Square",
+			want: []string{
+				"mod/shapes/shapes.go:10-14 (package shapes)",
+				"// Square is a square.",
+				"// It has four sides.",
+				"type Square struct {",
+				"\tSide float64 // length of a side",
+				"}",
+				"",
+				"[1 declarations]",
+			},
+		},
+		{
+			symbol: "shapes.Unit",
+			want: []string{
+				"mod/shapes/shapes.go:22-23 (package shapes)",
+				"// Unit is one",
+				"\tUnit = 1",
+				"",
+				"[1 declarations]",
+			},
+		},
+		{
+			symbol: "main.Area",
+			want: []string{
+				"mod/cmd/area/main.go:9-10 (package main)",
+				"// Area is unrelated to shapes.Square.Area",
+				"func Area() int { return 0 }",
+				"",
+				"[1 declarations]",
+			},
+		},
+		{
+			symbol: "Circle",
+			want:   []string{"No declaration of Circle found"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.symbol, func(t *testing.T) {
+			got, err := h.FindDefinition(context.Background(), tt.symbol, "mod")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = strings.ReplaceAll(got, root+"/", "")
+			if want := strings.Join(tt.want, "\n"); got != want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, want)
+			}
+		})
+	}
+
+	for _, symbol := range []string{"", "a.b.c", "Square."} {
+		if _, err := h.FindDefinition(context.Background(), symbol, "mod"); err == nil {
+			t.Errorf("FindDefinition accepted %q", symbol)
+		}
+	}
+	if _, err := h.FindDefinition(context.Background(), "Area", "missing"); err == nil {
+		t.Error("FindDefinition succeeded in a directory without Go files")
+	}
+}
+
+func TestFileOutline(t *testing.T) {
+	root := goModule(t)
+	h := newTestHandler(t, root, GrepLimits{})
+
+	got, err := h.FileOutline(context.Background(), "mod/shapes/shapes.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := strings.Join([]string{
+		filepath.Join(root, "mod/shapes/shapes.go") + " (package shapes)",
+		"5-8       type Shape interface",
+		"          // Shape is anything with an area",
+		"  7         Area() float64",
+		"            // Area returns the area",
+		"12-14     type Square struct",
+		"          // Square is a square.",
+		"  13        Side float64",
+		"17-19     func (s Square) Area() float64",
+		"          // Area returns the square's area",
+		"23        const Unit = 1",
+		"          // Unit is one",
+		"24        const Zero = 0",
+	}, "\n")
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+
+	if _, err := h.FileOutline(context.Background(), "mod/go.mod"); err == nil {
+		t.Error("FileOutline accepted a file that isn't Go")
+	}
+}
@@ -0,0 +1,574 @@
+package fileops
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"regexp"
+	"runtime"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// DefaultGrepMaxMatches caps the matches one search returns
+	DefaultGrepMaxMatches = 500
+	// DefaultGrepMaxFileMatches caps the matches returned from one file
+	DefaultGrepMaxFileMatches = 50
+
+	// MaxGrepContext is the most context lines a search may ask for
+	MaxGrepContext = 20
+
+	// grepBufferSize is the read buffer per file; longer lines are reassembled
+	grepBufferSize = 64 * 1024
+	// maxLineBytes is how much of a line is searched. Longer lines, such as
+	// minified code, are searched up to here and counted as truncated.
+	maxLineBytes = 1 << 20
+	// maxLineDisplay is how much of a matching line is shown
+	maxLineDisplay = 500
+	// maxMultilineBytes is how much of a file a multiline search reads
+	maxMultilineBytes = 8 << 20
+	// maxMatchLines is how many lines of one multiline match are shown
+	maxMatchLines = 100
+)
+
+// GrepLimits bound the work and output of grep_files; zero fields take the defaults
+type GrepLimits struct {
+	Workers        int // Files searched in parallel, default the number of CPUs
+	MaxMatches     int // Matches per search; the search stops once reached
+	MaxFileMatches int // Matches per file; the rest of the file is skipped
+}
+
+// withDefaults fills in zero limits
+func (l GrepLimits) withDefaults() GrepLimits {
+	if l.Workers <= 0 {
+		l.Workers = runtime.NumCPU()
+	}
+	if l.MaxMatches <= 0 {
+		l.MaxMatches = DefaultGrepMaxMatches
+	}
+	if l.MaxFileMatches <= 0 {
+		l.MaxFileMatches = DefaultGrepMaxFileMatches
+	}
+	return l
+}
+
+// GrepOutput selects what grep_files reports
+type GrepOutput string
+
+const (
+	GrepContent   GrepOutput = "content"    // Matching lines, with any context
+	GrepFilesOnly GrepOutput = "files_only" // Paths of the files that match
+	GrepCount     GrepOutput = "count"      // Number of matching lines per file
+)
+
+// GrepOutputs lists the valid output modes
+var GrepOutputs = []GrepOutput{GrepContent, GrepFilesOnly, GrepCount}
+
+// GrepOptions adjust a search; the zero value lists matching lines
+type GrepOptions struct {
+	IgnoreCase  bool
+	FixedString bool       // Pattern is literal text rather than a regex
+	Multiline   bool       // Matches may span lines; ^ and $ match at line breaks
+	Before      int        // Lines of context before each match
+	After       int        // Lines of context after each match
+	MaxResults  int        // Matches, or files when not listing content; zero for the server limit
+	Output      GrepOutput // Empty for GrepContent
+}
+
+// search is a validated grep_files request
+type search struct {
+	re         *regexp.Regexp
+	output     GrepOutput
+	multiline  bool
+	before     int
+	after      int
+	maxResults int // matches, or files when not listing content
+	maxFile    int // matches kept per file
+}
+
+// newSearch checks opts against the handler's limits and compiles pattern
+func (h *Handler) newSearch(pattern string, opts GrepOptions) (*search, error) {
+	if opts.Output == "" {
+		opts.Output = GrepContent
+	}
+	if !slices.Contains(GrepOutputs, opts.Output) {
+		return nil, fmt.Errorf("invalid output mode %q (expected content, files_only or count)", opts.Output)
+	}
+	if opts.Before < 0 || opts.Before > MaxGrepContext || opts.After < 0 || opts.After > MaxGrepContext {
+		return nil, fmt.Errorf("context lines must be between 0 and %d", MaxGrepContext)
+	}
+	if opts.MaxResults < 0 {
+		return nil, fmt.Errorf("max_results must not be negative")
+	}
+
+	if opts.FixedString {
+		pattern = regexp.QuoteMeta(pattern)
+	}
+	flags := ""
+	if opts.IgnoreCase {
+		flags += "i"
+	}
+	if opts.Multiline {
+		flags += "m"
+	}
+	if flags != "" {
+		pattern = "(?" + flags + ")" + pattern
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid regex pattern: %w", err)
+	}
+
+	s := &search{
+		re:         re,
+		output:     opts.Output,
+		multiline:  opts.Multiline,
+		before:     opts.Before,
+		after:      opts.After,
+		maxResults: h.limits.MaxMatches,
+		maxFile:    h.limits.MaxFileMatches,
+	}
+	if opts.MaxResults > 0 {
+		s.maxResults = min(opts.MaxResults, s.maxResults)
+	}
+	switch s.output {
+	case GrepFilesOnly:
+		s.before, s.after, s.maxFile = 0, 0, 1
+	case GrepCount:
+		s.before, s.after, s.maxFile = 0, 0, math.MaxInt
+	}
+	return s, nil
+}
+
+// results is how much of the result budget a file uses
+func (s *search) results(file fileMatches) int {
+	if s.output == GrepContent {
+		return file.matches
+	}
+	return 1
+}
+
+// grepLine is a line of output: part of a match, or context around one
+type grepLine struct {
+	num   int
+	text  string
+	match bool // part of a match rather than context
+	first bool // the line a match starts on
+}
+
+// fileMatches is the outcome of searching one file
+type fileMatches struct {
+	index       int // position in walk order
+	path        string
+	lines       []grepLine // matches and their context, when listing content
+	matches     int        // matching lines, or multiline matches
+	capped      bool       // stopped at the per-file cap
+	truncated   int        // lines longer than maxLineBytes
+	longMatches int        // multiline matches longer than maxMatchLines
+	partial     bool       // larger than maxMultilineBytes
+	binary      bool
+	failed      bool // could not be opened or read
+}
+
+// grepStats summarizes a search
+type grepStats struct {
+	files       int // files searched
+	binary      int
+	failed      int
+	truncated   int // over-long lines
+	longMatches int
+	partial     int
+	capped      bool
+	elapsed     time.Duration
+}
+
+// grep searches the files matching pathPattern with a pool of workers. It
+// stops early once maxResults is reached, and returns the files with
+// matches in walk order.
+func (h *Handler) grep(ctx context.Context, s *search, pathPattern string) ([]fileMatches, grepStats, int, error) {
+	start := time.Now()
+	searchCtx, stop := context.WithCancel(ctx)
+	defer stop()
+
+	type job struct {
+		index int
+		path  string
+	}
+	jobs := make(chan job)
+	results := make(chan fileMatches)
+
+	var workers sync.WaitGroup
+	for range h.limits.Workers {
+		workers.Go(func() {
+			for j := range jobs {
+				if searchCtx.Err() != nil {
+					continue
+				}
+				result := s.searchFile(searchCtx, j.path)
+				result.index = j.index
+				results <- result
+			}
+		})
+	}
+
+	var walked int
+	var walkErr error
+	go func() {
+		defer close(jobs)
+		index := 0
+		walked, walkErr = h.walkGlob(searchCtx, pathPattern, func(path string) error {
+			select {
+			case jobs <- job{index: index, path: path}:
+				index++
+				return nil
+			case <-searchCtx.Done():
+				return searchCtx.Err()
+			}
+		})
+	}()
+	go func() {
+		workers.Wait()
+		close(results)
+	}()
+
+	var found []fileMatches
+	var stats grepStats
+	total := 0
+	for result := range results {
+		stats.files++
+		stats.truncated += result.truncated
+		stats.longMatches += result.longMatches
+		if result.partial {
+			stats.partial++
+		}
+		switch {
+		case result.binary:
+			stats.binary++
+		case result.failed:
+			stats.failed++
+		case result.matches > 0:
+			found = append(found, result)
+			total += s.results(result)
+			if total >= s.maxResults && !stats.capped {
+				stats.capped = true
+				stop()
+			}
+		}
+	}
+	stats.elapsed = time.Since(start)
+
+	if err := ctx.Err(); err != nil {
+		return nil, stats, walked, err
+	}
+	if walkErr != nil && !stats.capped {
+		return nil, stats, walked, walkErr
+	}
+
+	// Workers finish out of order; report in walk order, up to the cap
+	slices.SortFunc(found, func(a, b fileMatches) int { return a.index - b.index })
+	remaining := s.maxResults
+	for i := range found {
+		if remaining <= 0 {
+			found = found[:i]
+			break
+		}
+		if s.output == GrepContent && found[i].matches > remaining {
+			found[i].lines = trimMatches(found[i].lines, remaining, s.after)
+			found[i].matches = remaining
+			found[i].capped = true
+		}
+		remaining -= s.results(found[i])
+	}
+	return found, stats, walked, nil
+}
+
+// searchFile searches one file, keeping at most maxFile matches
+func (s *search) searchFile(ctx context.Context, path string) fileMatches {
+	result := fileMatches{path: path}
+
+	file, err := os.Open(path)
+	if err != nil {
+		result.failed = true
+		return result
+	}
+	defer file.Close()
+
+	reader := bufio.NewReaderSize(file, grepBufferSize)
+	if head, _ := reader.Peek(sniffLen); looksBinary(head) {
+		result.binary = true
+		return result
+	}
+
+	if s.multiline {
+		s.searchWhole(reader, &result)
+	} else {
+		s.searchLines(ctx, reader, &result)
+	}
+	return result
+}
+
+// searchLines matches a file line by line, keeping the context asked for
+// as it goes. Lines of any length are handled; only their first
+// maxLineBytes are searched.
+func (s *search) searchLines(ctx context.Context, reader *bufio.Reader, result *fileMatches) {
+	content := s.output == GrepContent
+
+	var long []byte // a line spanning more than one buffer
+	overlong := false
+	var before []grepLine // the lines since the last output, for context
+	afterLeft := 0        // context lines still owed to the last match
+	lineNum := 0
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		if err == bufio.ErrBufferFull {
+			long = appendCapped(long, chunk, &overlong)
+			continue
+		}
+		if err != nil && len(chunk) == 0 && len(long) == 0 {
+			result.failed = !errors.Is(err, io.EOF)
+			return
+		}
+
+		line := chunk
+		if len(long) > 0 {
+			long = appendCapped(long, chunk, &overlong)
+			line = long
+		}
+		if overlong {
+			result.truncated++
+		}
+		line = bytes.TrimSuffix(bytes.TrimSuffix(line, []byte("\n")), []byte("\r"))
+
+		lineNum++
+		if lineNum%ctxCheckInterval == 0 && ctx.Err() != nil {
+			return
+		}
+		switch {
+		case !result.capped && s.re.Match(line):
+			result.matches++
+			if content {
+				result.lines = append(result.lines, before...)
+				result.lines = append(result.lines, grepLine{num: lineNum, text: displayLine(line), match: true, first: true})
+				before, afterLeft = before[:0], s.after
+			}
+			result.capped = result.matches >= s.maxFile
+		case afterLeft > 0:
+			result.lines = append(result.lines, grepLine{num: lineNum, text: displayLine(line)})
+			afterLeft--
+		case s.before > 0 && !result.capped:
+			if len(before) == s.before {
+				before = append(before[:0], before[1:]...)
+			}
+			before = append(before, grepLine{num: lineNum, text: displayLine(line)})
+		}
+		if result.capped && afterLeft == 0 {
+			return
+		}
+
+		if err != nil {
+			result.failed = !errors.Is(err, io.EOF)
+			return
+		}
+		long, overlong = long[:0], false
+	}
+}
+
+// searchWhole matches the pattern against the whole file, so a match may
+// span lines. Only the first maxMultilineBytes of the file are searched.
+func (s *search) searchWhole(reader *bufio.Reader, result *fileMatches) {
+	data, err := io.ReadAll(io.LimitReader(reader, maxMultilineBytes+1))
+	if err != nil {
+		result.failed = true
+		return
+	}
+	if len(data) > maxMultilineBytes {
+		data = data[:maxMultilineBytes]
+		result.partial = true
+	}
+
+	// starts[n] is the offset of line n+1
+	starts := []int{0}
+	for i, b := range data {
+		if b == '\n' && i+1 < len(data) {
+			starts = append(starts, i+1)
+		}
+	}
+	lineOf := func(offset int) int {
+		return sort.Search(len(starts), func(i int) bool { return starts[i] > offset })
+	}
+
+	// Matches starting on the same line, or overlapping lines, count as one
+	type span struct{ first, last int }
+	var spans []span
+	for _, loc := range s.re.FindAllIndex(data, -1) {
+		first, last := lineOf(loc[0]), lineOf(max(loc[0], loc[1]-1))
+		if n := len(spans); n > 0 && first <= spans[n-1].last {
+			spans[n-1].last = max(spans[n-1].last, last)
+			continue
+		}
+		if len(spans) == s.maxFile {
+			result.capped = true
+			break
+		}
+		spans = append(spans, span{first, last})
+	}
+	result.matches = len(spans)
+	if s.output != GrepContent {
+		return
+	}
+
+	text := func(n int) string {
+		end := len(data)
+		if n < len(starts) {
+			end = starts[n]
+		}
+		return displayLine(bytes.TrimSuffix(bytes.TrimSuffix(data[starts[n-1]:end], []byte("\n")), []byte("\r")))
+	}
+	matched := make(map[int]bool)
+	firsts := make(map[int]bool)
+	for i, sp := range spans {
+		if sp.last-sp.first >= maxMatchLines {
+			spans[i].last = sp.first + maxMatchLines - 1
+			result.longMatches++
+		}
+		firsts[sp.first] = true
+		for n := sp.first; n <= spans[i].last; n++ {
+			matched[n] = true
+		}
+	}
+	shown := 0
+	for _, sp := range spans {
+		from := max(sp.first-s.before, shown+1)
+		to := min(sp.last+s.after, len(starts))
+		for n := from; n <= to; n++ {
+			result.lines = append(result.lines, grepLine{num: n, text: text(n), match: matched[n], first: firsts[n]})
+		}
+		shown = max(shown, to)
+	}
+}
+
+// trimMatches keeps the lines of the first n matches and their context
+func trimMatches(lines []grepLine, n, after int) []grepLine {
+	seen, last := 0, 0
+	for i, line := range lines {
+		if line.first {
+			if seen == n {
+				return lines[:i]
+			}
+			seen++
+		}
+		if line.match {
+			last = line.num
+		} else if seen == n && line.num > last+after {
+			return lines[:i]
+		}
+	}
+	return lines
+}
+
+// appendCapped appends chunk to a partial line, dropping whatever would
+// take it past maxLineBytes and recording that in overlong
+func appendCapped(line, chunk []byte, overlong *bool) []byte {
+	if room := maxLineBytes - len(line); len(chunk) > room {
+		chunk = chunk[:room]
+		*overlong = true
+	}
+	return append(line, chunk...)
+}
+
+// displayLine shortens a long matching line to maxLineDisplay bytes,
+// without splitting a character
+func displayLine(line []byte) string {
+	if len(line) <= maxLineDisplay {
+		return string(line)
+	}
+	cut := maxLineDisplay
+	for cut > 0 && !utf8.RuneStart(line[cut]) {
+		cut--
+	}
+	return fmt.Sprintf("%s… [%d more bytes]", line[:cut], len(line)-cut)
+}
+
+// formatGrep renders search results and a summary line for the model.
+// Matching lines read "N:text" and context lines "N-text", with "--"
+// between groups that aren't adjacent, as grep does.
+func formatGrep(found []fileMatches, stats grepStats, s *search) string {
+	var b strings.Builder
+	matches := 0
+	for _, file := range found {
+		matches += file.matches
+		switch s.output {
+		case GrepFilesOnly:
+			b.WriteString("\n" + file.path)
+			continue
+		case GrepCount:
+			fmt.Fprintf(&b, "\n%s:%d", file.path, file.matches)
+			continue
+		}
+
+		fmt.Fprintf(&b, "\n%s:", file.path)
+		if file.capped {
+			fmt.Fprintf(&b, " (first %d matches)", file.matches)
+		}
+		prev := 0
+		for _, line := range file.lines {
+			if prev > 0 && line.num > prev+1 && (s.before > 0 || s.after > 0) {
+				b.WriteString("\n--")
+			}
+			sep := "-"
+			if line.match {
+				sep = ":"
+			}
+			fmt.Fprintf(&b, "\n%d%s%s", line.num, sep, line.text)
+			prev = line.num
+		}
+		b.WriteString("\n")
+	}
+
+	if len(found) == 0 {
+		b.WriteString("No matches found\n")
+	} else if s.output != GrepContent {
+		b.WriteString("\n")
+	}
+	if s.output == GrepFilesOnly {
+		fmt.Fprintf(&b, "\n[%d matching files; searched %d files in %s",
+			len(found), stats.files, stats.elapsed.Round(time.Millisecond))
+	} else {
+		fmt.Fprintf(&b, "\n[%d matches in %d files; searched %d files in %s",
+			matches, len(found), stats.files, stats.elapsed.Round(time.Millisecond))
+	}
+	if stats.binary > 0 {
+		fmt.Fprintf(&b, "; skipped %d binary", stats.binary)
+	}
+	if stats.failed > 0 {
+		fmt.Fprintf(&b, "; %d unreadable", stats.failed)
+	}
+	if stats.truncated > 0 {
+		fmt.Fprintf(&b, "; %d lines over %d bytes searched only in part", stats.truncated, maxLineBytes)
+	}
+	if stats.partial > 0 {
+		fmt.Fprintf(&b, "; %d files over %d bytes searched only in part", stats.partial, maxMultilineBytes)
+	}
+	if stats.longMatches > 0 {
+		fmt.Fprintf(&b, "; %d matches over %d lines shown in part", stats.longMatches, maxMatchLines)
+	}
+	b.WriteString("]")
+	if stats.capped {
+		unit := "matches"
+		if s.output != GrepContent {
+			unit = "files"
+		}
+		fmt.Fprintf(&b, "\nStopped after %d %s; narrow the pattern or path to see the rest.", s.maxResults, unit)
+	}
+	return strings.TrimPrefix(b.String(), "\n")
+}
@@ -0,0 +1,330 @@
+package fileops
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// writeTree generates dirs directories of files source files each, where
+// every file has lines lines and every tenth line mentions "needle"
+func writeTree(tb testing.TB, dirs, files, lines int) string {
+	tb.Helper()
+	root, err := filepath.EvalSymlinks(tb.TempDir())
+	if err != nil {
+		tb.Fatal(err)
+	}
+
+	var b strings.Builder
+	for i := range lines {
+		if i%10 == 0 {
+			fmt.Fprintf(&b, "\tneedle := lookup(%d) // find the needle\n", i)
+		} else {
+			fmt.Fprintf(&b, "\tvalue%d := compute(value%d, %d)\n", i, i-1, i)
+		}
+	}
+	content := []byte(b.String())
+
+	for d := range dirs {
+		dir := filepath.Join(root, fmt.Sprintf("pkg%03d", d))
+		if err := os.Mkdir(dir, 0o755); err != nil {
+			tb.Fatal(err)
+		}
+		for f := range files {
+			if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("file%03d.go", f)), content, 0o644); err != nil {
+				tb.Fatal(err)
+			}
+		}
+	}
+	return root
+}
+
+func newTestHandler(tb testing.TB, root string, limits GrepLimits) *Handler {
+	tb.Helper()
+	sandbox, err := NewSandbox([]string{root}, DefaultDenyPatterns)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return New(sandbox, limits)
+}
+
+// grepPaths runs a search and returns the files it reported, in order, and
+// the total matches
+func grepPaths(t *testing.T, h *Handler, root string, opts GrepOptions) ([]string, int, grepStats) {
+	t.Helper()
+	s, err := h.newSearch("needle", opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found, stats, _, err := h.grep(context.Background(), s, root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	matches := 0
+	for _, file := range found {
+		rel, _ := filepath.Rel(root, file.path)
+		paths = append(paths, filepath.ToSlash(rel))
+		matches += file.matches
+	}
+	return paths, matches, stats
+}
+
+func TestGrepWalkOrder(t *testing.T) {
+	root := writeTree(t, 8, 12, 30)
+
+	var want []string
+	for d := range 8 {
+		for f := range 12 {
+			want = append(want, fmt.Sprintf("pkg%03d/file%03d.go", d, f))
+		}
+	}
+
+	tests := []struct {
+		name    string
+		workers int
+	}{
+		{"one worker", 1},
+		{"four workers", 4},
+		{"more workers than files per directory", 32},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for range 5 {
+				h := newTestHandler(t, root, GrepLimits{Workers: tt.workers})
+				paths, matches, stats := grepPaths(t, h, root, GrepOptions{Output: GrepCount})
+				if !slices.Equal(paths, want) {
+					t.Fatalf("files out of walk order:\n got %v\nwant %v", paths, want)
+				}
+				if matches != len(want)*3 || stats.files != len(want) || stats.capped {
+					t.Fatalf("got %d matches in %d files searched (capped %t), want %d in %d",
+						matches, stats.files, stats.capped, len(want)*3, len(want))
+				}
+			}
+		})
+	}
+}
+
+func TestGrepMatchCap(t *testing.T) {
+	root := writeTree(t, 4, 10, 50) // 40 files of 5 matches each
+
+	tests := []struct {
+		name        string
+		limits      GrepLimits
+		opts        GrepOptions
+		wantFiles   []string
+		wantMatches int
+		wantCapped  bool
+	}{
+		{
+			name:        "search cap splits a file",
+			limits:      GrepLimits{MaxMatches: 12},
+			wantFiles:   []string{"pkg000/file000.go", "pkg000/file001.go", "pkg000/file002.go"},
+			wantMatches: 12,
+			wantCapped:  true,
+		},
+		{
+			name:        "max_results below the server cap",
+			limits:      GrepLimits{MaxMatches: 100},
+			opts:        GrepOptions{MaxResults: 5},
+			wantFiles:   []string{"pkg000/file000.go"},
+			wantMatches: 5,
+			wantCapped:  true,
+		},
+		{
+			name:        "max_results can't raise the server cap",
+			limits:      GrepLimits{MaxMatches: 7},
+			opts:        GrepOptions{MaxResults: 100},
+			wantFiles:   []string{"pkg000/file000.go", "pkg000/file001.go"},
+			wantMatches: 7,
+			wantCapped:  true,
+		},
+		{
+			name:        "per-file cap",
+			limits:      GrepLimits{MaxMatches: 6, MaxFileMatches: 2},
+			wantFiles:   []string{"pkg000/file000.go", "pkg000/file001.go", "pkg000/file002.go"},
+			wantMatches: 6,
+			wantCapped:  true,
+		},
+		{
+			name:        "files_only counts files",
+			limits:      GrepLimits{MaxMatches: 3},
+			opts:        GrepOptions{Output: GrepFilesOnly},
+			wantFiles:   []string{"pkg000/file000.go", "pkg000/file001.go", "pkg000/file002.go"},
+			wantMatches: 3,
+			wantCapped:  true,
+		},
+		{
+			name:        "under the cap",
+			limits:      GrepLimits{MaxMatches: 500},
+			opts:        GrepOptions{Output: GrepCount},
+			wantMatches: 200,
+		},
+	}
+	for _, tt := range tests {
+		for _, workers := range []int{1, 8} {
+			t.Run(fmt.Sprintf("%s/workers=%d", tt.name, workers), func(t *testing.T) {
+				tt.limits.Workers = workers
+				h := newTestHandler(t, root, tt.limits)
+				paths, matches, stats := grepPaths(t, h, root, tt.opts)
+				if tt.wantFiles != nil && !slices.Equal(paths, tt.wantFiles) {
+					t.Errorf("files = %v, want %v", paths, tt.wantFiles)
+				}
+				if matches != tt.wantMatches {
+					t.Errorf("matches = %d, want %d", matches, tt.wantMatches)
+				}
+				if stats.capped != tt.wantCapped {
+					t.Errorf("capped = %t, want %t", stats.capped, tt.wantCapped)
+				}
+			})
+		}
+	}
+}
+
+func BenchmarkGrep(b *testing.B) {
+	root := writeTree(b, 50, 40, 400) // 2000 files, about 11MB
+
+	for _, bench := range []struct {
+		name    string
+		pattern string
+		opts    GrepOptions
+	}{
+		{"rare", `lookup\(390\)`, GrepOptions{MaxResults: 10000}},
+		{"capped", "needle", GrepOptions{MaxResults: 100}},
+		{"fixed string", "compute(value99,", GrepOptions{FixedString: true, Output: GrepCount}},
+		{"multiline", `needle.*\n.*value1 :=`, GrepOptions{Multiline: true, Output: GrepFilesOnly}},
+	} {
+		for _, workers := range []int{1, 8} {
+			b.Run(fmt.Sprintf("%s/workers=%d", bench.name, workers), func(b *testing.B) {
+				h := newTestHandler(b, root, GrepLimits{Workers: workers, MaxMatches: 10000})
+				b.ReportAllocs()
+				for b.Loop() {
+					if _, err := h.GrepFiles(context.Background(), bench.pattern, root, bench.opts); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestGrepOutput(t *testing.T) {
+	root, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(root, "notes.txt")
+	lines := []string{"alpha", "beta", "needle one", "gamma", "delta", "Needle two (x)", "epsilon", "zeta", "eta", "theta", "needle three", "iota"}
+	if err := os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	h := newTestHandler(t, root, GrepLimits{})
+
+	tests := []struct {
+		name    string
+		pattern string
+		opts    GrepOptions
+		want    string // output before the summary line
+		summary string // start of the summary line
+	}{
+		{
+			name:    "matching lines",
+			pattern: "needle",
+			want:    "notes.txt:\n3:needle one\n11:needle three",
+			summary: "[2 matches in 1 files",
+		},
+		{
+			name:    "ignore case",
+			pattern: "NEEDLE",
+			opts:    GrepOptions{IgnoreCase: true},
+			want:    "notes.txt:\n3:needle one\n6:Needle two (x)\n11:needle three",
+			summary: "[3 matches in 1 files",
+		},
+		{
+			name:    "context groups split by --, adjacent ones merged",
+			pattern: "(?i)needle",
+			opts:    GrepOptions{Before: 1, After: 1},
+			want:    "notes.txt:\n2-beta\n3:needle one\n4-gamma\n5-delta\n6:Needle two (x)\n7-epsilon\n--\n10-theta\n11:needle three\n12-iota",
+		},
+		{
+			name:    "overlapping context shown once",
+			pattern: "(?i)needle",
+			opts:    GrepOptions{Before: 2, After: 3},
+			want: "notes.txt:\n1-alpha\n2-beta\n3:needle one\n4-gamma\n5-delta\n6:Needle two (x)\n7-epsilon\n8-zeta\n9-eta\n" +
+				"10-theta\n11:needle three\n12-iota",
+		},
+		{
+			name:    "fixed string",
+			pattern: "two (x)",
+			opts:    GrepOptions{FixedString: true},
+			want:    "notes.txt:\n6:Needle two (x)",
+		},
+		{
+			name:    "multiline match across lines",
+			pattern: `one\ngamma`,
+			opts:    GrepOptions{Multiline: true, After: 1},
+			want:    "notes.txt:\n3:needle one\n4:gamma\n5-delta",
+			summary: "[1 matches in 1 files",
+		},
+		{
+			name:    "multiline anchors at line breaks",
+			pattern: `^eta$`,
+			opts:    GrepOptions{Multiline: true},
+			want:    "notes.txt:\n9:eta",
+		},
+		{
+			name:    "files only",
+			pattern: "needle",
+			opts:    GrepOptions{Output: GrepFilesOnly},
+			want:    "notes.txt",
+			summary: "[1 matching files",
+		},
+		{
+			name:    "count",
+			pattern: "(?i)needle",
+			opts:    GrepOptions{Output: GrepCount},
+			want:    "notes.txt:3",
+			summary: "[3 matches in 1 files",
+		},
+		{
+			name:    "no matches",
+			pattern: "absent",
+			want:    "No matches found",
+			summary: "[0 matches in 0 files; searched 1 files",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := h.GrepFiles(context.Background(), tt.pattern, root, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			out = strings.ReplaceAll(out, root+string(filepath.Separator), "")
+			body, summary, _ := strings.Cut(out, "\n\n[")
+			if body != tt.want {
+				t.Errorf("output:\n%s\nwant:\n%s", body, tt.want)
+			}
+			if !strings.HasPrefix("["+summary, tt.summary) {
+				t.Errorf("summary = %q, want it to start with %q", "["+summary, tt.summary)
+			}
+		})
+	}
+}
+
+func TestGrepRejectsBadOptions(t *testing.T) {
+	h := newTestHandler(t, t.TempDir(), GrepLimits{})
+	for _, opts := range []GrepOptions{
+		{Before: MaxGrepContext + 1},
+		{After: -1},
+		{MaxResults: -1},
+		{Output: "lines"},
+	} {
+		if _, err := h.newSearch("needle", opts); err == nil {
+			t.Errorf("newSearch accepted %+v", opts)
+		}
+	}
+}
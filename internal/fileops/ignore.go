@@ -0,0 +1,110 @@
+package fileops
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+// ignoreFileNames are the ignore files read in every directory the walker
+// enters. Rules in later files override earlier ones.
+var ignoreFileNames = []string{".gitignore", ".ignore"}
+
+// ignoreRule is one line of an ignore file, rewritten as a doublestar
+// pattern relative to the file's directory
+type ignoreRule struct {
+	pattern string
+	negate  bool // a leading ! re-includes what earlier rules ignored
+	dirOnly bool // a trailing / only matches directories
+}
+
+// ignoreList holds the rules from the ignore files of one directory
+type ignoreList struct {
+	dir   string
+	rules []ignoreRule
+}
+
+// loadIgnores reads the ignore files in dir. It returns nil if there are
+// none or they hold no rules.
+func loadIgnores(dir string) *ignoreList {
+	list := &ignoreList{dir: dir}
+	for _, name := range ignoreFileNames {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			continue
+		}
+		list.rules = append(list.rules, parseIgnore(data)...)
+	}
+	if len(list.rules) == 0 {
+		return nil
+	}
+	return list
+}
+
+// parseIgnore parses gitignore syntax: blank lines and # comments are
+// skipped, ! negates, a trailing / matches directories only, and a pattern
+// with no other / matches at any depth
+func parseIgnore(data []byte) []ignoreRule {
+	var rules []ignoreRule
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if !strings.HasSuffix(line, `\ `) {
+			line = strings.TrimRight(line, " ")
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var rule ignoreRule
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+
+		if strings.Contains(line, "/") {
+			line = strings.TrimPrefix(line, "/")
+		} else {
+			line = "**/" + line
+		}
+		if !doublestar.ValidatePattern(line) {
+			continue
+		}
+		rule.pattern = line
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// ignored reports whether path is ignored by lists, ordered from the
+// outermost directory in. As in git, the last matching rule wins.
+func ignored(lists []*ignoreList, path string, isDir bool) bool {
+	result := false
+	for _, list := range lists {
+		rel, err := filepath.Rel(list.dir, path)
+		if err != nil || !within(list.dir, path) {
+			continue
+		}
+		rel = filepath.ToSlash(rel)
+		for _, rule := range list.rules {
+			if rule.dirOnly && !isDir {
+				continue
+			}
+			if doublestar.MatchUnvalidated(rule.pattern, rel) {
+				result = !rule.negate
+			}
+		}
+	}
+	return result
+}
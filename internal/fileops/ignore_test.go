@@ -0,0 +1,108 @@
+package fileops
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestParseIgnore(t *testing.T) {
+	tests := []struct {
+		line string
+		want []ignoreRule
+	}{
+		{"*.log", []ignoreRule{{pattern: "**/*.log"}}},
+		{"!keep.log", []ignoreRule{{pattern: "**/keep.log", negate: true}}},
+		{"build/", []ignoreRule{{pattern: "**/build", dirOnly: true}}},
+		{"/todo.txt", []ignoreRule{{pattern: "todo.txt"}}},
+		{"docs/*.md", []ignoreRule{{pattern: "docs/*.md"}}},
+		{"**/generated", []ignoreRule{{pattern: "**/generated"}}},
+		{"!/dist/", []ignoreRule{{pattern: "dist", negate: true, dirOnly: true}}},
+		{"trailing   ", []ignoreRule{{pattern: "**/trailing"}}},
+		{"# comment", nil},
+		{"", nil},
+		{"!", nil},
+		{"/", nil},
+		{"[unclosed", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			if got := parseIgnore([]byte(tt.line + "\r\n")); !slices.Equal(got, tt.want) {
+				t.Errorf("parseIgnore(%q) = %+v, want %+v", tt.line, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWalkHonorsIgnoreFiles(t *testing.T) {
+	root, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, content := range map[string]string{
+		".gitignore":         "*.log\n!keep.log\nbuild/\n/root-only.txt\ndocs/*.md\n",
+		".ignore":            "secret.txt\n",
+		"main.go":            "",
+		"debug.log":          "",
+		"keep.log":           "",
+		"root-only.txt":      "",
+		"local.txt":          "",
+		"secret.txt":         "",
+		"build/out.go":       "",
+		"docs/guide.md":      "",
+		"docs/deep/notes.md": "",
+		"sub/.gitignore":     "!debug.log\nlocal.txt\n",
+		"sub/build":          "", // a file, which build/ doesn't match
+		"sub/debug.log":      "",
+		"sub/other.log":      "",
+		"sub/local.txt":      "",
+		"sub/root-only.txt":  "",
+	} {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sandbox, err := NewSandbox([]string{root}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := &Handler{sandbox: sandbox}
+
+	tests := []struct {
+		pattern string
+		want    []string
+	}{
+		{".", []string{
+			".gitignore", ".ignore", "docs/deep/notes.md", "keep.log", "local.txt", "main.go",
+			"sub/.gitignore", "sub/build", "sub/debug.log", "sub/root-only.txt",
+		}},
+		// Searching below the root still applies the root's ignore files
+		{"sub", []string{"sub/.gitignore", "sub/build", "sub/debug.log", "sub/root-only.txt"}},
+		{"**/*.log", []string{"keep.log", "sub/debug.log"}},
+		// A file named directly is searched whatever the ignore files say
+		{"debug.log", []string{"debug.log"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern, func(t *testing.T) {
+			var got []string
+			_, err := h.walkGlob(context.Background(), filepath.Join(root, tt.pattern), func(path string) error {
+				rel, _ := filepath.Rel(root, path)
+				got = append(got, filepath.ToSlash(rel))
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			slices.Sort(got)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("walked %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,216 @@
+package fileops
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+const (
+	// DefaultListDepth is how many levels list_directory shows by default
+	DefaultListDepth = 2
+	// MaxListDepth is the deepest listing list_directory gives
+	MaxListDepth = 6
+	// MaxListEntries caps the entries one listing shows
+	MaxListEntries = 1000
+	// MaxFindResults caps the files find_files returns
+	MaxFindResults = 500
+)
+
+// errEnough stops a walk once it has found as much as was asked for
+var errEnough = errors.New("enough results")
+
+// lister builds a depth-limited tree of a directory
+type lister struct {
+	ctx      context.Context
+	sandbox  *Sandbox
+	maxDepth int
+	out      strings.Builder
+
+	dirs, files int
+	capped      bool
+}
+
+// ListDirectory returns the tree below a directory, depth levels deep, with
+// file sizes. Entries are filtered as grep_files filters them: ignored
+// files, DefaultExcludes and denied names are left out.
+func (h *Handler) ListDirectory(ctx context.Context, path string, depth int) (string, error) {
+	if depth == 0 {
+		depth = DefaultListDepth
+	}
+	if depth < 0 || depth > MaxListDepth {
+		return "", fmt.Errorf("depth must be between 1 and %d", MaxListDepth)
+	}
+	if path == "" {
+		path = "."
+	}
+
+	real, err := h.sandbox.Resolve(ctx, path)
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(real)
+	if err != nil {
+		return "", fmt.Errorf("failed to list directory: %w", err)
+	}
+	if !info.IsDir() {
+		return "", fmt.Errorf("%s is not a directory", path)
+	}
+
+	l := &lister{ctx: ctx, sandbox: h.sandbox, maxDepth: depth}
+	fmt.Fprintf(&l.out, "%s/\n", real)
+	root := containingRoot(h.sandbox.Roots(ctx), real)
+	if err := l.list(real, 1, ancestorIgnores(root, real)); err != nil {
+		return "", fmt.Errorf("listing interrupted: %w", err)
+	}
+
+	fmt.Fprintf(&l.out, "[%d directories, %d files", l.dirs, l.files)
+	if l.capped {
+		fmt.Fprintf(&l.out, "; stopped after %d entries, list a subdirectory to see more", MaxListEntries)
+	}
+	l.out.WriteString("]")
+	return l.out.String(), nil
+}
+
+// list writes the entries of dir, which sits depth levels below the listed
+// directory. Directories at the depth limit show how many entries they hold.
+func (l *lister) list(dir string, depth int, lists []*ignoreList) error {
+	if err := l.ctx.Err(); err != nil {
+		return err
+	}
+
+	indent := strings.Repeat("  ", depth)
+	for _, entry := range l.entries(dir, lists) {
+		if l.dirs+l.files >= MaxListEntries {
+			l.capped = true
+			return nil
+		}
+		name := entry.Name()
+		full := filepath.Join(dir, name)
+
+		switch {
+		case entry.IsDir():
+			l.dirs++
+			sub := lists
+			if list := loadIgnores(full); list != nil {
+				sub = append(slices.Clip(lists), list)
+			}
+			if depth >= l.maxDepth {
+				fmt.Fprintf(&l.out, "%s%s/ (%d entries)\n", indent, name, len(l.entries(full, sub)))
+				continue
+			}
+			fmt.Fprintf(&l.out, "%s%s/\n", indent, name)
+			if err := l.list(full, depth+1, sub); err != nil {
+				return err
+			}
+		case entry.Type()&os.ModeSymlink != 0:
+			l.files++
+			// Only name targets the sandbox would open, so a link can't
+			// reveal paths outside the roots
+			target, err := os.Readlink(full)
+			if err != nil {
+				target = "?"
+			}
+			if _, err := l.sandbox.Resolve(l.ctx, full); err != nil {
+				fmt.Fprintf(&l.out, "%s%s (symlink)\n", indent, name)
+				continue
+			}
+			fmt.Fprintf(&l.out, "%s%s -> %s\n", indent, name, target)
+		default:
+			l.files++
+			size := "?"
+			if info, err := entry.Info(); err == nil {
+				size = formatSize(info.Size())
+			}
+			fmt.Fprintf(&l.out, "%s%s (%s)\n", indent, name, size)
+		}
+	}
+	return nil
+}
+
+// entries reads dir, leaving out what the walker would skip. Unreadable
+// directories have no entries.
+func (l *lister) entries(dir string, lists []*ignoreList) []os.DirEntry {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	return slices.DeleteFunc(entries, func(entry os.DirEntry) bool {
+		name := entry.Name()
+		if entry.IsDir() && slices.Contains(DefaultExcludes, name) {
+			return true
+		}
+		return l.sandbox.deniedName(name) != "" || ignored(lists, filepath.Join(dir, name), entry.IsDir())
+	})
+}
+
+// FindFiles returns the files below dir whose name matches pattern, or
+// whose path relative to dir does when pattern contains a slash. It stops
+// after maxResults files, at most MaxFindResults.
+func (h *Handler) FindFiles(ctx context.Context, pattern, dir string, maxResults int) (string, error) {
+	if maxResults < 0 {
+		return "", fmt.Errorf("max_results must not be negative")
+	}
+	if maxResults == 0 || maxResults > MaxFindResults {
+		maxResults = MaxFindResults
+	}
+	if pattern == "" {
+		return "", fmt.Errorf("pattern is required")
+	}
+	if dir == "" {
+		dir = "."
+	}
+
+	glob := pattern
+	if !strings.Contains(pattern, "/") {
+		glob = "**/" + pattern
+	}
+
+	var found []string
+	capped := false
+	_, err := h.walkGlob(ctx, filepath.Join(dir, glob), func(path string) error {
+		if len(found) == maxResults {
+			capped = true
+			return errEnough
+		}
+		size := "?"
+		if info, err := os.Stat(path); err == nil {
+			size = formatSize(info.Size())
+		}
+		found = append(found, fmt.Sprintf("%s (%s)", path, size))
+		return nil
+	})
+	if ctx.Err() != nil {
+		return "", fmt.Errorf("search interrupted: %w", ctx.Err())
+	}
+	if err != nil && !errors.Is(err, errEnough) {
+		return "", err
+	}
+
+	if len(found) == 0 {
+		return "No files found", nil
+	}
+	result := strings.Join(found, "\n") + fmt.Sprintf("\n\n[%d files", len(found))
+	if capped {
+		result += "; stopped at the limit, narrow the pattern or path to see the rest"
+	}
+	return result + "]", nil
+}
+
+// formatSize renders a byte count for people and models to read
+func formatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,174 @@
+package fileops
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// listTree builds a workspace with ignored, denied, excluded and linked
+// entries next to the ones a listing shows
+func listTree(t *testing.T) (root, outside string) {
+	t.Helper()
+	root, outside = workspace(t)
+	for path, content := range map[string]string{
+		".gitignore":                 "*.log\n",
+		"app.log":                    "ignored\n",
+		"node_modules/dep/index.js":  "excluded\n",
+		"cmd/tool/main.go":           "package main\n",
+		"cmd/tool/deep/util.go":      "package deep\n",
+		"cmd/tool/deep/util_test.go": "package deep\n",
+	} {
+		full := filepath.Join(root, path)
+		if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for link, target := range map[string]string{
+		"inside": "cmd/tool/main.go",
+		"escape": filepath.Join(outside, "secret.go"),
+		"config": ".env",
+	} {
+		if err := os.Symlink(target, filepath.Join(root, link)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root, outside
+}
+
+func TestListDirectory(t *testing.T) {
+	root, outside := listTree(t)
+	h := newTestHandler(t, root, GrepLimits{})
+
+	tests := []struct {
+		name  string
+		path  string
+		depth int
+		want  []string
+	}{
+		{
+			name: "default depth",
+			want: []string{
+				root + "/",
+				"  .gitignore (6 B)",
+				"  cmd/",
+				"    tool/ (2 entries)",
+				"  config (symlink)",
+				"  escape (symlink)",
+				"  inside -> cmd/tool/main.go",
+				"  main.go (13 B)",
+				"[2 directories, 5 files]",
+			},
+		},
+		{
+			name:  "subdirectory",
+			path:  "cmd/tool",
+			depth: 1,
+			want: []string{
+				filepath.Join(root, "cmd/tool") + "/",
+				"  deep/ (2 entries)",
+				"  main.go (13 B)",
+				"[1 directories, 1 files]",
+			},
+		},
+		{
+			name:  "deeper",
+			path:  "cmd",
+			depth: 3,
+			want: []string{
+				filepath.Join(root, "cmd") + "/",
+				"  tool/",
+				"    deep/",
+				"      util.go (13 B)",
+				"      util_test.go (13 B)",
+				"    main.go (13 B)",
+				"[2 directories, 3 files]",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := h.ListDirectory(context.Background(), tt.path, tt.depth)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := strings.Join(tt.want, "\n"); got != want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, want)
+			}
+			if strings.Contains(got, outside) {
+				t.Errorf("listing reveals %s", outside)
+			}
+		})
+	}
+
+	for _, path := range []string{outside, "main.go", "missing"} {
+		if _, err := h.ListDirectory(context.Background(), path, 0); err == nil {
+			t.Errorf("ListDirectory(%q) succeeded", path)
+		}
+	}
+	if _, err := h.ListDirectory(context.Background(), ".", MaxListDepth+1); err == nil {
+		t.Errorf("ListDirectory accepted depth %d", MaxListDepth+1)
+	}
+}
+
+func TestFindFiles(t *testing.T) {
+	root, _ := listTree(t)
+	h := newTestHandler(t, root, GrepLimits{})
+
+	tests := []struct {
+		name       string
+		pattern    string
+		dir        string
+		maxResults int
+		want       []string
+	}{
+		{
+			name:    "by name",
+			pattern: "*.go",
+			want:    []string{"cmd/tool/deep/util.go (13 B)", "cmd/tool/deep/util_test.go (13 B)", "cmd/tool/main.go (13 B)", "main.go (13 B)", "", "[4 files]"},
+		},
+		{
+			name:    "by path",
+			pattern: "cmd/*/main.go",
+			want:    []string{"cmd/tool/main.go (13 B)", "", "[1 files]"},
+		},
+		{
+			name:    "below a directory",
+			pattern: "*_test.go",
+			dir:     "cmd",
+			want:    []string{"cmd/tool/deep/util_test.go (13 B)", "", "[1 files]"},
+		},
+		{
+			name:       "capped",
+			pattern:    "*.go",
+			maxResults: 2,
+			want:       []string{"cmd/tool/deep/util.go (13 B)", "cmd/tool/deep/util_test.go (13 B)", "", "[2 files; stopped at the limit, narrow the pattern or path to see the rest]"},
+		},
+		{
+			name:    "ignored and excluded",
+			pattern: "*.{log,js}",
+			want:    []string{"No files found"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := h.FindFiles(context.Background(), tt.pattern, tt.dir, tt.maxResults)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = strings.ReplaceAll(got, root+"/", "")
+			if want := strings.Join(tt.want, "\n"); got != want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, want)
+			}
+		})
+	}
+
+	if _, err := h.FindFiles(context.Background(), "", "", 0); err == nil {
+		t.Error("FindFiles accepted an empty pattern")
+	}
+}
@@ -0,0 +1,184 @@
+package fileops
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// MaxReadBytes caps the output of one read_file call, whatever max_bytes asks for
+const MaxReadBytes = 128 * 1024
+
+// ReadOptions select part of a file; the zero value reads it all, up to MaxReadBytes
+type ReadOptions struct {
+	StartLine int // First line to return, counting from 1
+	EndLine   int // Last line to return, zero for the end of the file
+	MaxBytes  int // Output cap below MaxReadBytes, zero for MaxReadBytes
+}
+
+// ReadFile reads lines of a file and returns them numbered, stopping at
+// the output cap with a notice saying how to read on. Binary and non-UTF-8
+// files are described rather than returned.
+func (h *Handler) ReadFile(ctx context.Context, path string, opts ReadOptions) (string, error) {
+	if opts.StartLine < 0 || opts.EndLine < 0 || opts.MaxBytes < 0 {
+		return "", fmt.Errorf("start_line, end_line and max_bytes must not be negative")
+	}
+	if opts.EndLine > 0 && opts.EndLine < opts.StartLine {
+		return "", fmt.Errorf("end_line %d is before start_line %d", opts.EndLine, opts.StartLine)
+	}
+
+	path, err := h.sandbox.Resolve(ctx, path)
+	if err != nil {
+		return "", err
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read file: %w", err)
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return "", fmt.Errorf("failed to read file: %w", err)
+	}
+	if info.IsDir() {
+		return "", fmt.Errorf("%s is a directory", path)
+	}
+
+	reader := bufio.NewReaderSize(file, grepBufferSize)
+	head, _ := reader.Peek(sniffLen)
+	if looksBinary(head) {
+		return fmt.Sprintf("%s is a binary file (%d bytes, %s); its contents are not shown.",
+			path, info.Size(), http.DetectContentType(head)), nil
+	}
+	if !validUTF8(head, len(head) == sniffLen) {
+		return fmt.Sprintf("%s is not UTF-8 text (%d bytes, %s); its contents are not shown. grep_files can still search it.",
+			path, info.Size(), http.DetectContentType(head)), nil
+	}
+
+	limit := MaxReadBytes
+	if opts.MaxBytes > 0 {
+		limit = min(opts.MaxBytes, limit)
+	}
+	start := max(opts.StartLine, 1)
+
+	var b strings.Builder
+	var line []byte
+	overlong := false
+	inLine := false // bytes of the next line have been read
+	capped := false
+	more := false // lines follow the ones read
+	cutLines := 0 // lines cut to fit, at maxLineBytes or the output cap
+	lineNum, first, last := 0, 0, 0
+
+	// Stop once the range or the output cap is filled, so a few lines of a
+	// huge file don't cost a read of all of it
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		inLine = inLine || len(chunk) > 0
+		want := !capped && lineNum+1 >= start && (opts.EndLine == 0 || lineNum+1 <= opts.EndLine)
+		if want {
+			line = appendCapped(line, chunk, &overlong)
+		}
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+
+		ended := inLine
+		if inLine {
+			lineNum++
+			if want {
+				entry := fmt.Sprintf("%6d\t%s\n", lineNum, strings.TrimRight(string(line), "\r\n"))
+				if b.Len()+len(entry) > limit {
+					capped = true
+					// A first line too long to show whole is shown in part
+					if first == 0 {
+						b.WriteString(cutUTF8(entry, limit) + "\n")
+						first, last = lineNum, lineNum
+						cutLines++
+					}
+				} else {
+					b.WriteString(entry)
+					if first == 0 {
+						first = lineNum
+					}
+					last = lineNum
+					if overlong {
+						cutLines++
+					}
+				}
+			}
+			line, overlong, inLine = line[:0], false, false
+			if lineNum%ctxCheckInterval == 0 && ctx.Err() != nil {
+				return "", fmt.Errorf("read interrupted: %w", ctx.Err())
+			}
+		}
+
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				return "", fmt.Errorf("failed to read file: %w", err)
+			}
+			break
+		}
+		if ended && (capped || (opts.EndLine > 0 && lineNum >= opts.EndLine)) {
+			_, err := reader.Peek(1)
+			more = last < lineNum || err == nil
+			break
+		}
+	}
+
+	switch {
+	case lineNum == 0:
+		return fmt.Sprintf("%s is empty", path), nil
+	case first == 0:
+		return "", fmt.Errorf("start_line %d is past the end of %s, which has %d lines", start, path, lineNum)
+	}
+
+	if cutLines > 0 {
+		fmt.Fprintf(&b, "[%d lines were too long to show in full; use grep_files to search them]\n", cutLines)
+	}
+	switch {
+	case capped && more:
+		fmt.Fprintf(&b, "[Showing lines %d-%d of a %d-byte file; output is capped at %d bytes. Call read_file with start_line=%d to read on.]",
+			first, last, info.Size(), limit, last+1)
+	case more:
+		fmt.Fprintf(&b, "[Showing lines %d-%d; more lines follow in this %d-byte file]", first, last, info.Size())
+	case first > 1:
+		fmt.Fprintf(&b, "[Showing lines %d-%d of %d]", first, last, lineNum)
+	}
+	return strings.TrimSuffix(b.String(), "\n"), nil
+}
+
+// validUTF8 reports whether head is UTF-8 text. When more of the file
+// follows, head may end part way through a character.
+func validUTF8(head []byte, more bool) bool {
+	if utf8.Valid(head) {
+		return true
+	}
+	if !more {
+		return false
+	}
+	for cut := 1; cut < utf8.UTFMax && cut < len(head); cut++ {
+		if utf8.Valid(head[:len(head)-cut]) && !utf8.FullRune(head[len(head)-cut:]) {
+			return true
+		}
+	}
+	return false
+}
+
+// cutUTF8 shortens s to at most n bytes without splitting a character
+func cutUTF8(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
@@ -0,0 +1,119 @@
+package fileops
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReadFile(t *testing.T) {
+	root, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{
+		"five.txt":  "one\ntwo\nthree\nfour\nfive\n",
+		"crlf.txt":  "first\r\nsecond", // no final newline
+		"long.txt":  strings.Repeat("x", 40) + "\n",
+		"empty.txt": "",
+		"data.bin":  "PK\x03\x04\x00\x00binary",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	h := newTestHandler(t, root, GrepLimits{})
+
+	tests := []struct {
+		name string
+		file string
+		opts ReadOptions
+		want string
+	}{
+		{
+			name: "whole file",
+			file: "five.txt",
+			want: "     1\tone\n     2\ttwo\n     3\tthree\n     4\tfour\n     5\tfive",
+		},
+		{
+			name: "range in the middle stops reading",
+			file: "five.txt",
+			opts: ReadOptions{StartLine: 2, EndLine: 3},
+			want: "     2\ttwo\n     3\tthree\n[Showing lines 2-3; more lines follow in this 24-byte file]",
+		},
+		{
+			name: "range to the end",
+			file: "five.txt",
+			opts: ReadOptions{StartLine: 4},
+			want: "     4\tfour\n     5\tfive\n[Showing lines 4-5 of 5]",
+		},
+		{
+			name: "range past the end",
+			file: "five.txt",
+			opts: ReadOptions{StartLine: 4, EndLine: 50},
+			want: "     4\tfour\n     5\tfive\n[Showing lines 4-5 of 5]",
+		},
+		{
+			name: "range ending on the last line",
+			file: "five.txt",
+			opts: ReadOptions{EndLine: 5},
+			want: "     1\tone\n     2\ttwo\n     3\tthree\n     4\tfour\n     5\tfive",
+		},
+		{
+			name: "byte cap",
+			file: "five.txt",
+			opts: ReadOptions{MaxBytes: 25},
+			want: "     1\tone\n     2\ttwo\n[Showing lines 1-2 of a 24-byte file; output is capped at 25 bytes. Call read_file with start_line=3 to read on.]",
+		},
+		{
+			name: "line longer than the cap",
+			file: "long.txt",
+			opts: ReadOptions{MaxBytes: 12},
+			want: "     1\txxxxx\n[1 lines were too long to show in full; use grep_files to search them]",
+		},
+		{
+			name: "carriage returns and no final newline",
+			file: "crlf.txt",
+			want: "     1\tfirst\n     2\tsecond",
+		},
+		{
+			name: "empty",
+			file: "empty.txt",
+			want: filepath.Join(root, "empty.txt") + " is empty",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := h.ReadFile(context.Background(), filepath.Join(root, tt.file), tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("binary", func(t *testing.T) {
+		got, err := h.ReadFile(context.Background(), filepath.Join(root, "data.bin"), ReadOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(got, "is a binary file") {
+			t.Errorf("got %q, want a description of the binary file", got)
+		}
+	})
+
+	for _, opts := range []ReadOptions{
+		{StartLine: 9},
+		{StartLine: 3, EndLine: 2},
+		{MaxBytes: -1},
+	} {
+		if _, err := h.ReadFile(context.Background(), filepath.Join(root, "five.txt"), opts); err == nil {
+			t.Errorf("ReadFile accepted %+v", opts)
+		}
+	}
+}
@@ -0,0 +1,294 @@
+package fileops
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// DefaultDenyPatterns match secrets the model must never read, even inside
+// an allowed root. Each pattern is matched against every path component
+// below the root.
+var DefaultDenyPatterns = []string{
+	".env", ".env.*", "*.pem", "*.key", "*.p12", "*.pfx",
+	"id_rsa", "id_dsa", "id_ecdsa", "id_ed25519",
+	".ssh", ".gnupg", ".aws", ".netrc", ".pgpass", ".git-credentials",
+}
+
+var (
+	// ErrOutsideRoots is returned for paths outside every allowed root
+	ErrOutsideRoots = errors.New("path is outside the allowed workspace roots")
+	// ErrDenied is returned for paths matching a deny pattern
+	ErrDenied = errors.New("path matches a deny pattern")
+)
+
+// Sandbox confines file access to a set of root directories and keeps
+// sensitive files out of reach. Paths are resolved through symlinks before
+// they are checked, so a link inside a root can't point outside it.
+//
+// Roots configured explicitly apply to every MCP session. Otherwise each
+// session uses the roots its client advertised, falling back to the working
+// directory. Clients of a network transport may be anyone who can reach the
+// server, so there client roots can only narrow the working directory.
+type Sandbox struct {
+	mu          sync.RWMutex
+	roots       []string            // absolute, symlink-free
+	clientRoots map[string][]string // session ID -> roots advertised by the client
+	deny        []string
+	configured  bool // roots were set explicitly and client roots don't replace them
+	confined    bool // client roots are limited to the parts of roots they overlap
+}
+
+// NewSandbox creates a sandbox over roots. With no roots it allows the
+// working directory until client roots are known.
+func NewSandbox(roots, deny []string) (*Sandbox, error) {
+	s := &Sandbox{
+		clientRoots: make(map[string][]string),
+		deny:        deny,
+		configured:  len(roots) > 0,
+	}
+	if len(roots) == 0 {
+		wd, err := os.Getwd()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get working directory: %w", err)
+		}
+		roots = []string{wd}
+	}
+
+	for _, root := range roots {
+		resolved, err := resolveRoot(root)
+		if err != nil {
+			return nil, err
+		}
+		s.roots = append(s.roots, resolved)
+	}
+	return s, nil
+}
+
+// Roots returns the allowed root directories for the calling session. The
+// first is the primary root that relative paths are resolved against.
+func (s *Sandbox) Roots(ctx context.Context) []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]string(nil), s.rootsFor(ctx)...)
+}
+
+// ConfineClientRoots limits client roots to the parts of the working
+// directory they overlap, rather than letting them replace it. Network
+// transports call it, so a remote client can't advertise / and read the
+// whole machine.
+func (s *Sandbox) ConfineClientRoots() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.confined = true
+}
+
+// SetClientRoots records the roots advertised by an MCP client session.
+// Roots that don't exist on this machine, or when confined lie outside the
+// working directory, are skipped. It does nothing when roots were
+// configured explicitly.
+func (s *Sandbox) SetClientRoots(sessionID string, roots []string) error {
+	if s.configured {
+		return nil
+	}
+
+	var resolved []string
+	var errs []error
+	for _, root := range roots {
+		real, err := resolveRoot(root)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		resolved = append(resolved, real)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.confined {
+		var inside []string
+		for _, root := range resolved {
+			overlap := overlappingRoots(root, s.roots)
+			if len(overlap) == 0 {
+				errs = append(errs, fmt.Errorf("%w: %s (allowed roots: %s)", ErrOutsideRoots, root, strings.Join(s.roots, ", ")))
+			}
+			for _, root := range overlap {
+				if !slices.Contains(inside, root) {
+					inside = append(inside, root)
+				}
+			}
+		}
+		resolved = inside
+	}
+	if len(resolved) == 0 {
+		delete(s.clientRoots, sessionID)
+	} else {
+		s.clientRoots[sessionID] = resolved
+	}
+	return errors.Join(errs...)
+}
+
+// ForgetSession drops the roots of a disconnected session
+func (s *Sandbox) ForgetSession(sessionID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.clientRoots, sessionID)
+}
+
+// Abs expands ~ and makes path absolute, resolving relative paths against
+// the calling session's primary root
+func (s *Sandbox) Abs(ctx context.Context, path string) (string, error) {
+	expanded, err := expandHome(path)
+	if err != nil {
+		return "", err
+	}
+	if !filepath.IsAbs(expanded) {
+		expanded = filepath.Join(s.Roots(ctx)[0], expanded)
+	}
+	return filepath.Clean(expanded), nil
+}
+
+// Resolve makes path absolute and resolves symlinks, then checks the result
+// is inside one of the calling session's roots and matches no deny pattern.
+// It returns the real path to open.
+func (s *Sandbox) Resolve(ctx context.Context, path string) (string, error) {
+	abs, err := s.Abs(ctx, path)
+	if err != nil {
+		return "", err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	roots := s.rootsFor(ctx)
+
+	// Check the path as given too, so a symlink can't disguise a denied name
+	if err := s.checkDenied(roots, path, abs); err != nil {
+		return "", err
+	}
+
+	real, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve %s: %w", path, err)
+	}
+	if containingRoot(roots, real) == "" {
+		return "", fmt.Errorf("%w: %s (allowed roots: %s)", ErrOutsideRoots, path, strings.Join(roots, ", "))
+	}
+	if err := s.checkDenied(roots, path, real); err != nil {
+		return "", err
+	}
+	return real, nil
+}
+
+// rootsFor returns the roots that apply to the calling session. Callers must hold s.mu.
+func (s *Sandbox) rootsFor(ctx context.Context) []string {
+	if !s.configured {
+		if session := server.ClientSessionFromContext(ctx); session != nil {
+			if roots, ok := s.clientRoots[session.SessionID()]; ok {
+				return roots
+			}
+		}
+	}
+	return s.roots
+}
+
+// checkDenied reports whether a component of abs below its root matches a
+// deny pattern; for paths outside every root only the file name is checked
+func (s *Sandbox) checkDenied(roots []string, path, abs string) error {
+	components := []string{filepath.Base(abs)}
+	if root := containingRoot(roots, abs); root != "" {
+		rel, _ := filepath.Rel(root, abs)
+		components = strings.Split(rel, string(filepath.Separator))
+	}
+
+	for _, component := range components {
+		if pattern := s.deniedName(component); pattern != "" {
+			return fmt.Errorf("%w: %s (%q)", ErrDenied, path, pattern)
+		}
+	}
+	return nil
+}
+
+// deniedName returns the deny pattern matching a single path component, or ""
+func (s *Sandbox) deniedName(name string) string {
+	for _, pattern := range s.deny {
+		if ok, _ := filepath.Match(pattern, name); ok {
+			return pattern
+		}
+	}
+	return ""
+}
+
+// containingRoot returns the root containing abs, or ""
+func containingRoot(roots []string, abs string) string {
+	for _, root := range roots {
+		if within(root, abs) {
+			return root
+		}
+	}
+	return ""
+}
+
+// overlappingRoots returns what root shares with the allowed roots: root
+// itself if it lies inside one of them, and any of them inside root
+func overlappingRoots(root string, allowed []string) []string {
+	if containingRoot(allowed, root) != "" {
+		return []string{root}
+	}
+	var overlap []string
+	for _, limit := range allowed {
+		if within(root, limit) {
+			overlap = append(overlap, limit)
+		}
+	}
+	return overlap
+}
+
+// resolveRoot makes a root absolute and symlink-free. Roots may be given as
+// file:// URIs, as MCP clients advertise them.
+func resolveRoot(root string) (string, error) {
+	if u, err := url.Parse(root); err == nil && u.Scheme == "file" {
+		root = u.Path
+	}
+	expanded, err := expandHome(root)
+	if err != nil {
+		return "", err
+	}
+	abs, err := filepath.Abs(expanded)
+	if err != nil {
+		return "", fmt.Errorf("invalid root %s: %w", root, err)
+	}
+	real, err := filepath.EvalSymlinks(abs)
+	if err != nil {
+		return "", fmt.Errorf("invalid root %s: %w", root, err)
+	}
+	return real, nil
+}
+
+// within reports whether path is root or inside it
+func within(root, path string) bool {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return false
+	}
+	return rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)))
+}
+
+// expandHome expands a leading ~ to the home directory
+func expandHome(path string) (string, error) {
+	if !strings.HasPrefix(path, "~") {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(home, path[1:]), nil
+}
@@ -0,0 +1,137 @@
+package fileops
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// testSession is a client session that only has an ID
+type testSession struct{ id string }
+
+func (s testSession) Initialize()                                         {}
+func (s testSession) Initialized() bool                                   { return true }
+func (s testSession) NotificationChannel() chan<- mcp.JSONRPCNotification { return nil }
+func (s testSession) SessionID() string                                   { return s.id }
+
+func sessionContext(id string) context.Context {
+	return server.NewMCPServer("test", "0").WithContext(context.Background(), testSession{id})
+}
+
+// workspace creates a root holding a file, next to a secret outside it
+func workspace(t *testing.T) (root, outside string) {
+	t.Helper()
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	root = filepath.Join(dir, "root")
+	outside = filepath.Join(dir, "outside")
+	for _, d := range []string{root, outside} {
+		if err := os.Mkdir(d, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for path, content := range map[string]string{
+		filepath.Join(root, "main.go"):      "package main\n",
+		filepath.Join(root, ".env"):         "TOKEN=x\n",
+		filepath.Join(outside, "secret.go"): "package secret\n",
+	} {
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root, outside
+}
+
+func TestSandboxResolve(t *testing.T) {
+	root, outside := workspace(t)
+	if err := os.Symlink(outside, filepath.Join(root, "escape")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(root, ".env"), filepath.Join(root, "config")); err != nil {
+		t.Fatal(err)
+	}
+	sandbox, err := NewSandbox([]string{root}, DefaultDenyPatterns)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path string
+		want error
+	}{
+		{"main.go", nil},
+		{filepath.Join(root, "main.go"), nil},
+		{"../outside/secret.go", ErrOutsideRoots},
+		{"sub/../../outside/secret.go", ErrOutsideRoots},
+		{filepath.Join(outside, "secret.go"), ErrOutsideRoots},
+		{"escape/secret.go", ErrOutsideRoots},
+		{".env", ErrDenied},
+		{"config", ErrDenied},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			_, err := sandbox.Resolve(context.Background(), tt.path)
+			if tt.want == nil && err != nil {
+				t.Fatalf("Resolve(%q) = %v, want success", tt.path, err)
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Fatalf("Resolve(%q) = %v, want %v", tt.path, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSandboxClientRoots(t *testing.T) {
+	root, outside := workspace(t)
+	sub := filepath.Join(root, "sub")
+	if err := os.Mkdir(sub, 0o755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		confined bool
+		client   []string
+		want     []string
+	}{
+		{"stdio client roots replace the working directory", false, []string{"file://" + outside}, []string{outside}},
+		{"confined root inside the working directory", true, []string{"file://" + sub}, []string{sub}},
+		{"confined filesystem root", true, []string{"file:///"}, []string{root}},
+		{"confined root outside the working directory", true, []string{"file://" + outside}, []string{root}},
+		{"confined mixed roots", true, []string{"file://" + outside, "file://" + sub}, []string{sub}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Chdir(root)
+			sandbox, err := NewSandbox(nil, DefaultDenyPatterns)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.confined {
+				sandbox.ConfineClientRoots()
+			}
+			_ = sandbox.SetClientRoots("client", tt.client)
+
+			ctx := sessionContext("client")
+			if got := sandbox.Roots(ctx); !slices.Equal(got, tt.want) {
+				t.Fatalf("Roots() = %v, want %v", got, tt.want)
+			}
+			if got := sandbox.Roots(sessionContext("other")); !slices.Equal(got, []string{root}) {
+				t.Fatalf("other session's Roots() = %v, want the working directory", got)
+			}
+
+			_, err = sandbox.Resolve(ctx, filepath.Join(outside, "secret.go"))
+			if readable := err == nil; readable != slices.Contains(tt.want, outside) {
+				t.Fatalf("Resolve(outside) = %v with roots %v", err, tt.want)
+			}
+		})
+	}
+}
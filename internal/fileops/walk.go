@@ -0,0 +1,186 @@
+package fileops
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+)
+
+// DefaultExcludes are directories the walker never enters. A pattern that
+// starts inside one of them, such as 'vendor/**/*.go', still searches it.
+var DefaultExcludes = []string{".git", "node_modules", "vendor"}
+
+// walker finds the files below a base directory that match a glob
+type walker struct {
+	ctx      context.Context
+	sandbox  *Sandbox
+	pattern  string // doublestar pattern relative to the base directory
+	maxDepth int    // deepest level the pattern can match; 0 for no limit
+	fn       func(path string) error
+
+	matched int
+	refused error // why the last refused file was refused
+}
+
+// walkGlob calls fn with the real path of every file matching pattern, in
+// lexical order. Patterns use doublestar syntax, where ** matches any
+// number of directories; a plain directory matches every file below it.
+// Files ignored by .gitignore or .ignore files, from the workspace root
+// down, are skipped, as are DefaultExcludes and anything the sandbox
+// refuses. It returns the number of files passed to fn.
+func (h *Handler) walkGlob(ctx context.Context, pattern string, fn func(path string) error) (int, error) {
+	abs, err := h.sandbox.Abs(ctx, pattern)
+	if err != nil {
+		return 0, err
+	}
+
+	base, rest := doublestar.SplitPattern(filepath.ToSlash(abs))
+	plain := !hasMeta(rest)
+	if plain {
+		base, rest = filepath.ToSlash(abs), "**"
+	}
+	if !doublestar.ValidatePattern(rest) {
+		return 0, fmt.Errorf("invalid path pattern: %s", pattern)
+	}
+
+	real, err := h.sandbox.Resolve(ctx, filepath.FromSlash(base))
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	info, err := os.Stat(real)
+	if err != nil {
+		return 0, nil
+	}
+	if !info.IsDir() {
+		// A plain file path names the file, whatever the ignore files say
+		if !plain {
+			return 0, nil
+		}
+		return 1, fn(real)
+	}
+
+	w := &walker{
+		ctx:     ctx,
+		sandbox: h.sandbox,
+		pattern: rest,
+		fn:      fn,
+	}
+	if !strings.Contains(rest, "**") {
+		w.maxDepth = strings.Count(rest, "/") + 1
+	}
+
+	root := containingRoot(h.sandbox.Roots(ctx), real)
+	if err := w.walk(real, "", 1, ancestorIgnores(root, real)); err != nil {
+		return w.matched, err
+	}
+	if w.matched == 0 && w.refused != nil {
+		return 0, fmt.Errorf("no file matching %s may be searched: %w", pattern, w.refused)
+	}
+	return w.matched, nil
+}
+
+// walk visits the entries of dir, whose path relative to the base directory
+// is rel and which sits depth levels below it. lists holds the ignore rules
+// that apply in dir.
+func (w *walker) walk(dir, rel string, depth int, lists []*ignoreList) error {
+	if err := w.ctx.Err(); err != nil {
+		return err
+	}
+
+	// Unreadable directories are skipped rather than failing the search
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		full := filepath.Join(dir, name)
+		entryRel := path.Join(rel, name)
+
+		if entry.IsDir() {
+			if w.maxDepth > 0 && depth >= w.maxDepth {
+				continue
+			}
+			if slices.Contains(DefaultExcludes, name) || w.sandbox.deniedName(name) != "" || ignored(lists, full, true) {
+				continue
+			}
+			sub := lists
+			if list := loadIgnores(full); list != nil {
+				sub = append(slices.Clip(lists), list)
+			}
+			if err := w.walk(full, entryRel, depth+1, sub); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if !doublestar.MatchUnvalidated(w.pattern, entryRel) || ignored(lists, full, false) {
+			continue
+		}
+
+		// The walk never follows links, so only they need resolving in full
+		real := full
+		if entry.Type()&fs.ModeSymlink != 0 {
+			resolved, err := w.sandbox.Resolve(w.ctx, full)
+			if err != nil {
+				if errors.Is(err, ErrOutsideRoots) || errors.Is(err, ErrDenied) {
+					w.refused = err
+				}
+				continue
+			}
+			if info, err := os.Stat(resolved); err != nil || info.IsDir() {
+				continue
+			}
+			real = resolved
+		} else if !entry.Type().IsRegular() {
+			continue
+		} else if pattern := w.sandbox.deniedName(name); pattern != "" {
+			w.refused = fmt.Errorf("%w: %s (%q)", ErrDenied, full, pattern)
+			continue
+		}
+
+		w.matched++
+		if err := w.fn(real); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ancestorIgnores loads the ignore files from root down to dir
+func ancestorIgnores(root, dir string) []*ignoreList {
+	dirs := []string{dir}
+	for root != "" && dir != root {
+		parent := filepath.Dir(dir)
+		if parent == dir || !within(root, parent) {
+			break
+		}
+		dir = parent
+		dirs = append(dirs, dir)
+	}
+
+	var lists []*ignoreList
+	for _, dir := range slices.Backward(dirs) {
+		if list := loadIgnores(dir); list != nil {
+			lists = append(lists, list)
+		}
+	}
+	return lists
+}
+
+// hasMeta reports whether a pattern contains glob syntax
+func hasMeta(pattern string) bool {
+	return strings.ContainsAny(pattern, `*?[{\`)
+}
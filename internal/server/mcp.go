@@ -12,14 +12,52 @@ type ToolHandler interface {
 	Handle(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error)
 }
 
-// New creates and configures a new MCP server with the GPT-5-Pro tool
-func New(handler ToolHandler) *server.MCPServer {
+// ReviewHandler defines the interface for the code review tool
+type ReviewHandler interface {
+	HandleCodeReview(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error)
+}
+
+// JobHandler defines the interface for the background job tools
+type JobHandler interface {
+	HandleGetJobResult(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error)
+	HandleCancelJob(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error)
+}
+
+// ConversationHandler defines the interface for the conversation management tools
+type ConversationHandler interface {
+	HandleList(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error)
+	HandleResume(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error)
+	HandleDelete(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error)
+	ForgetSession(sessionID string)
+}
+
+// RootsHandler receives the workspace roots advertised by each client session
+type RootsHandler interface {
+	SetClientRoots(sessionID string, roots []string) error
+	ForgetSession(sessionID string)
+}
+
+// New creates and configures a new MCP server with the GPT-5-Pro tool.
+// Tool calls are cancelled by mcp-go when the client sends notifications/cancelled.
+func New(handler ToolHandler, reviews ReviewHandler, jobs JobHandler, conversations ConversationHandler, roots RootsHandler) *server.MCPServer {
+	tracker := &rootsTracker{handler: roots}
+	hooks := &server.Hooks{}
+	hooks.AddOnUnregisterSession(tracker.forget)
+	hooks.AddOnUnregisterSession(func(ctx context.Context, session server.ClientSession) {
+		conversations.ForgetSession(session.SessionID())
+	})
+
 	s := server.NewMCPServer(
 		"GPT-5-Pro MCP",
 		"1.0.0",
 		server.WithToolCapabilities(false),
+		server.WithLogging(),
 		server.WithRecovery(),
+		server.WithHooks(hooks),
 	)
+	tracker.server = s
+	s.AddNotificationHandler(string(mcp.MethodNotificationInitialized), tracker.refresh)
+	s.AddNotificationHandler(string(mcp.MethodNotificationRootsListChanged), tracker.refresh)
 
 	gpt5ProTool := mcp.NewTool("gpt-5-pro",
 		mcp.WithDescription("Consult GPT-5-Pro for complex problems requiring deep reasoning. GPT-5-Pro has access to read files and search file contents."),
@@ -30,6 +68,29 @@ func New(handler ToolHandler) *server.MCPServer {
 		mcp.WithBoolean("continue",
 			mcp.Description("Continue previous conversation (true) or start fresh (false). Default: true"),
 		),
+		mcp.WithString("conversation_id",
+			mcp.Description("Optional conversation name. Calls with the same name share one conversation, which is saved to disk and can be resumed after a restart; without it each MCP session has its own in-memory conversation. Use distinct names for parallel agents."),
+		),
+		mcp.WithString("model",
+			mcp.Description("Optional model override for this call, e.g. a cheaper model for quick questions. Defaults to the server's configured model."),
+		),
+		mcp.WithString("reasoning_effort",
+			mcp.Description("Optional reasoning effort for this call. Defaults to the server's configured effort."),
+			mcp.Enum("minimal", "low", "medium", "high"),
+		),
+		mcp.WithString("verbosity",
+			mcp.Description("Optional answer verbosity for this call. Defaults to the server's configured verbosity."),
+			mcp.Enum("low", "medium", "high"),
+		),
+		mcp.WithNumber("timeout_seconds",
+			mcp.Description("Optional overall deadline for this consultation in seconds. Defaults to the server's configured timeout."),
+		),
+		mcp.WithBoolean("override_budget",
+			mcp.Description("Proceed even if this call would exceed a configured per-call, per-conversation or daily spending budget. Only set this when the user has explicitly approved the extra spend. Default: false"),
+		),
+		mcp.WithBoolean("wait",
+			mcp.Description("Wait for the answer (true) or return a job_id immediately and fetch the answer later with get_job_result (false). Use false for long consultations. Default: true"),
+		),
 		mcp.WithString("gathered_context",
 			mcp.Description("Optional JSON string containing code context gathered by Claude Code. Format: {\"files\": {\"path\": \"content\"}, \"functions\": {\"name\": \"impl\"}, \"metadata\": {\"key\": \"value\"}}"),
 		),
@@ -40,5 +101,92 @@ func New(handler ToolHandler) *server.MCPServer {
 
 	s.AddTool(gpt5ProTool, handler.Handle)
 
+	codeReviewTool := mcp.NewTool("code_review",
+		mcp.WithDescription("Ask GPT-5-Pro to review the changes since a git ref. The diff and the code around each change are computed and sent automatically; the review comes back as markdown plus structured findings (file, line, severity, message, suggested_fix). Runs in a fresh conversation, named in the result so gpt-5-pro can be asked follow-up questions about it; it never touches the session's own conversation."),
+		mcp.WithString("base",
+			mcp.Required(),
+			mcp.Description("Git ref to review changes since, e.g. main or HEAD~3"),
+		),
+		mcp.WithString("head",
+			mcp.Description("Git ref holding the changes. Defaults to the working tree, including uncommitted changes."),
+		),
+		mcp.WithString("path",
+			mcp.Description("Optional file or directory to limit the review to. Defaults to the primary workspace root."),
+		),
+		mcp.WithString("instructions",
+			mcp.Description("Optional extra guidance for the reviewer, e.g. what the change is meant to do or what to focus on"),
+		),
+		mcp.WithString("conversation_id",
+			mcp.Description("Optional conversation name to hold the review; any history it had is replaced. Defaults to a new conversation named review-<id>."),
+		),
+		mcp.WithString("model",
+			mcp.Description("Optional model override for this review. Defaults to the server's configured model."),
+		),
+		mcp.WithString("reasoning_effort",
+			mcp.Description("Optional reasoning effort for this review. Defaults to the server's configured effort."),
+			mcp.Enum("minimal", "low", "medium", "high"),
+		),
+		mcp.WithString("verbosity",
+			mcp.Description("Optional verbosity of the review. Defaults to the server's configured verbosity."),
+			mcp.Enum("low", "medium", "high"),
+		),
+		mcp.WithNumber("timeout_seconds",
+			mcp.Description("Optional overall deadline for the review in seconds. Defaults to the server's configured timeout."),
+		),
+		mcp.WithBoolean("override_budget",
+			mcp.Description("Proceed even if the review would exceed a configured spending budget. Only set this when the user has explicitly approved the extra spend. Default: false"),
+		),
+		mcp.WithReadOnlyHintAnnotation(true),
+	)
+	s.AddTool(codeReviewTool, reviews.HandleCodeReview)
+
+	getJobResultTool := mcp.NewTool("get_job_result",
+		mcp.WithDescription("Retrieve the answer of a gpt-5-pro consultation started with wait=false, or its status if it is still running."),
+		mcp.WithString("job_id",
+			mcp.Required(),
+			mcp.Description("The job_id returned by gpt-5-pro in this session, or the ID of a Responses API response this server created for the session"),
+		),
+		mcp.WithNumber("wait_seconds",
+			mcp.Description("Wait up to this many seconds for the job to finish before returning its status. Default: 0"),
+		),
+		mcp.WithReadOnlyHintAnnotation(true),
+	)
+	s.AddTool(getJobResultTool, jobs.HandleGetJobResult)
+
+	cancelJobTool := mcp.NewTool("cancel_job",
+		mcp.WithDescription("Cancel a running gpt-5-pro consultation started with wait=false."),
+		mcp.WithString("job_id",
+			mcp.Required(),
+			mcp.Description("The job_id returned by gpt-5-pro in this session, or the ID of a Responses API response this server created for the session"),
+		),
+		mcp.WithDestructiveHintAnnotation(true),
+	)
+	s.AddTool(cancelJobTool, jobs.HandleCancelJob)
+
+	listConversationsTool := mcp.NewTool("list_conversations",
+		mcp.WithDescription("List saved GPT-5-Pro conversations that can be resumed, most recent first. Saved conversations are shared by every client of this server."),
+		mcp.WithReadOnlyHintAnnotation(true),
+	)
+	s.AddTool(listConversationsTool, conversations.HandleList)
+
+	resumeConversationTool := mcp.NewTool("resume_conversation",
+		mcp.WithDescription("Resume a saved GPT-5-Pro conversation. Subsequent gpt-5-pro calls in this session without a conversation_id continue it."),
+		mcp.WithString("conversation_id",
+			mcp.Required(),
+			mcp.Description("Name of the conversation to resume, as shown by list_conversations"),
+		),
+	)
+	s.AddTool(resumeConversationTool, conversations.HandleResume)
+
+	deleteConversationTool := mcp.NewTool("delete_conversation",
+		mcp.WithDescription("Permanently delete a saved GPT-5-Pro conversation, for every client of this server. A call still running on it finishes but is not saved."),
+		mcp.WithString("conversation_id",
+			mcp.Required(),
+			mcp.Description("Name of the conversation to delete"),
+		),
+		mcp.WithDestructiveHintAnnotation(true),
+	)
+	s.AddTool(deleteConversationTool, conversations.HandleDelete)
+
 	return s
 }
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// rootsRequestTimeout bounds how long a client gets to answer roots/list
+const rootsRequestTimeout = 30 * time.Second
+
+// rootsTracker asks each client for its workspace roots once it has
+// initialized, and again whenever it reports that they changed
+type rootsTracker struct {
+	server  *server.MCPServer
+	handler RootsHandler
+}
+
+// refresh handles notifications/initialized and notifications/roots/list_changed.
+// The request runs in the background: the client's answer arrives on the
+// same connection the notification came in on.
+func (t *rootsTracker) refresh(ctx context.Context, notification mcp.JSONRPCNotification) {
+	session := server.ClientSessionFromContext(ctx)
+	if session == nil {
+		return
+	}
+	if withInfo, ok := session.(server.SessionWithClientInfo); ok && withInfo.GetClientCapabilities().Roots == nil {
+		log.Printf("Client does not advertise roots: session=%s", session.SessionID())
+		return
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), rootsRequestTimeout)
+		defer cancel()
+
+		result, err := t.server.RequestRoots(ctx, mcp.ListRootsRequest{})
+		if err != nil {
+			log.Printf("WARNING: Failed to list client roots: session=%s: %v", session.SessionID(), err)
+			return
+		}
+
+		uris := make([]string, 0, len(result.Roots))
+		for _, root := range result.Roots {
+			uris = append(uris, root.URI)
+		}
+		log.Printf("Client roots: session=%s roots=%v", session.SessionID(), uris)
+
+		if err := t.handler.SetClientRoots(session.SessionID(), uris); err != nil {
+			log.Printf("WARNING: Ignoring unusable client roots: session=%s: %v", session.SessionID(), err)
+		}
+	}()
+}
+
+// forget drops a disconnected session's roots
+func (t *rootsTracker) forget(ctx context.Context, session server.ClientSession) {
+	t.handler.ForgetSession(session.SessionID())
+}
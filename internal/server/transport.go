@@ -0,0 +1,102 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// Transport identifies how the MCP server is exposed to clients
+type Transport string
+
+const (
+	TransportStdio Transport = "stdio"
+	TransportSSE   Transport = "sse"
+	TransportHTTP  Transport = "http"
+)
+
+// shutdownTimeout bounds how long in-flight requests get to finish on shutdown
+const shutdownTimeout = 30 * time.Second
+
+// ParseTransport validates a transport name from the command line
+func ParseTransport(name string) (Transport, error) {
+	switch t := Transport(name); t {
+	case TransportStdio, TransportSSE, TransportHTTP:
+		return t, nil
+	default:
+		return "", fmt.Errorf("unknown transport %q (expected stdio, sse or http)", name)
+	}
+}
+
+// Serve runs the MCP server over the given transport until ctx is cancelled.
+// Network transports listen on addr and give each client connection its own
+// MCP session; on cancellation they stop accepting connections and wait for
+// in-flight requests to finish before returning.
+func Serve(ctx context.Context, s *server.MCPServer, transport Transport, addr string) error {
+	switch transport {
+	case TransportStdio:
+		log.Printf("Serving MCP over stdio")
+		err := server.NewStdioServer(s).Listen(ctx, os.Stdin, os.Stdout)
+		if errors.Is(err, context.Canceled) {
+			return nil
+		}
+		return err
+
+	case TransportSSE:
+		srv := newHTTPServer(addr)
+		sse := server.NewSSEServer(s, server.WithHTTPServer(srv), server.WithKeepAlive(true))
+		srv.Handler = sse
+		log.Printf("Serving MCP over SSE at http://%s%s", addr, sse.CompleteSsePath())
+		return serveHTTP(ctx, addr, sse.Start, sse.Shutdown)
+
+	case TransportHTTP:
+		srv := newHTTPServer(addr)
+		streamable := server.NewStreamableHTTPServer(s, server.WithStreamableHTTPServer(srv))
+		srv.Handler = streamable
+		log.Printf("Serving MCP over streamable HTTP at http://%s/mcp", addr)
+		return serveHTTP(ctx, addr, streamable.Start, streamable.Shutdown)
+
+	default:
+		return fmt.Errorf("unsupported transport: %s", transport)
+	}
+}
+
+// newHTTPServer creates the listener shared by the network transports
+func newHTTPServer(addr string) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+}
+
+// serveHTTP runs a network transport and shuts it down gracefully once ctx is done
+func serveHTTP(ctx context.Context, addr string, start func(string) error, shutdown func(context.Context) error) error {
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- start(addr)
+	}()
+
+	select {
+	case err := <-errCh:
+		if errors.Is(err, http.ErrServerClosed) {
+			return nil
+		}
+		return fmt.Errorf("failed to serve on %s: %w", addr, err)
+	case <-ctx.Done():
+	}
+
+	log.Printf("Shutting down, waiting up to %s for in-flight requests", shutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	if err := shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("graceful shutdown failed: %w", err)
+	}
+	return nil
+}
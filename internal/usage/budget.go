@@ -0,0 +1,81 @@
+package usage
+
+import "fmt"
+
+// charsPerToken is a rough average for English text and code, used to
+// estimate a request's size before sending it
+const charsPerToken = 4
+
+// EstimateTokens estimates how many tokens text of the given length takes
+func EstimateTokens(chars int) int64 {
+	return int64(chars+charsPerToken-1) / charsPerToken
+}
+
+// Limit caps spending in one scope. Zero fields are unlimited.
+type Limit struct {
+	Cost   float64 // USD
+	Tokens int64   // Input plus output tokens
+}
+
+// Budgets are the spending caps for a single tool call, a conversation and a
+// calendar day
+type Budgets struct {
+	Call         Limit
+	Conversation Limit
+	Day          Limit
+}
+
+// BudgetError reports a request refused because it would exceed a budget
+type BudgetError struct {
+	Scope    string // "call", "conversation" or "day"
+	Limit    Limit
+	Spent    Usage
+	Estimate Usage
+}
+
+func (e *BudgetError) Error() string {
+	if e.Limit.Cost > 0 && e.Spent.Cost+e.Estimate.Cost > e.Limit.Cost {
+		return fmt.Sprintf("%s budget of $%.2f would be exceeded: $%.4f spent, next request estimated at $%.4f",
+			e.Scope, e.Limit.Cost, e.Spent.Cost, e.Estimate.Cost)
+	}
+	return fmt.Sprintf("%s budget of %d tokens would be exceeded: %d spent, next request estimated at %d",
+		e.Scope, e.Limit.Tokens, e.Spent.tokens(), e.Estimate.tokens())
+}
+
+func (u Usage) tokens() int64 {
+	return u.InputTokens + u.OutputTokens
+}
+
+// exceededBy reports whether spending estimate on top of spent breaks the limit
+func (l Limit) exceededBy(spent, estimate Usage) bool {
+	if l.Cost > 0 && spent.Cost+estimate.Cost > l.Cost {
+		return true
+	}
+	return l.Tokens > 0 && spent.tokens()+estimate.tokens() > l.Tokens
+}
+
+// Check prices the estimated next request for model and returns a
+// *BudgetError if it would take the call, the conversation or today over
+// budget. Spending is checked before each request, so a single request may
+// overshoot a cap by its output tokens but no further request is sent.
+func (m *Meter) Check(model string, estimate, call, conversation Usage) error {
+	if price, ok := m.prices.Lookup(model); ok {
+		estimate.Cost = price.Cost(estimate)
+	}
+
+	scopes := []struct {
+		name  string
+		limit Limit
+		spent Usage
+	}{
+		{"call", m.budgets.Call, call},
+		{"conversation", m.budgets.Conversation, conversation},
+		{"day", m.budgets.Day, m.Today()},
+	}
+	for _, scope := range scopes {
+		if scope.limit.exceededBy(scope.spent, estimate) {
+			return &BudgetError{Scope: scope.name, Limit: scope.limit, Spent: scope.spent, Estimate: estimate}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package usage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// dayFormat keys the ledger by local calendar day
+const dayFormat = time.DateOnly
+
+// Ledger keeps per-day usage totals in a JSON file so they survive restarts.
+// Every server process with the same state directory shares the file, such
+// as one stdio server per client, so each update re-reads it under a file
+// lock and adds to the totals the other processes recorded.
+type Ledger struct {
+	mu   sync.Mutex
+	path string
+	days map[string]Usage // as last read, for when the file can't be
+}
+
+// OpenLedger loads the ledger at path, starting empty if it doesn't exist yet
+func OpenLedger(path string) (*Ledger, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create usage directory: %w", err)
+	}
+
+	l := &Ledger{path: path}
+	days, err := l.load()
+	if err != nil {
+		return nil, err
+	}
+	l.days = days
+	return l, nil
+}
+
+// Record adds u to today's total and saves the ledger
+func (l *Ledger) Record(u Usage) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	unlock, err := lockFile(l.path + ".lock")
+	if err != nil {
+		return fmt.Errorf("failed to lock usage ledger: %w", err)
+	}
+	defer unlock()
+
+	days, err := l.load()
+	if err != nil {
+		return err
+	}
+	day := time.Now().Format(dayFormat)
+	total := days[day]
+	total.Add(u)
+	days[day] = total
+	l.days = days
+	return l.save(days)
+}
+
+// Today returns today's total across every process sharing the ledger
+func (l *Ledger) Today() Usage {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// Writes replace the file whole, so it can be read without the lock
+	if days, err := l.load(); err != nil {
+		log.Printf("WARNING: %v", err)
+	} else {
+		l.days = days
+	}
+	return l.days[time.Now().Format(dayFormat)]
+}
+
+// load reads the ledger file, empty if it doesn't exist yet
+func (l *Ledger) load() (map[string]Usage, error) {
+	days := make(map[string]Usage)
+	data, err := os.ReadFile(l.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return days, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read usage ledger: %w", err)
+	}
+	if err := json.Unmarshal(data, &days); err != nil {
+		return nil, fmt.Errorf("failed to parse usage ledger %s: %w", l.path, err)
+	}
+	return days, nil
+}
+
+// save writes the ledger atomically. Callers must hold the file lock.
+func (l *Ledger) save(days map[string]Usage) error {
+	data, err := json.MarshalIndent(days, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode usage ledger: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(l.path), ".usage-*")
+	if err != nil {
+		return fmt.Errorf("failed to create temp file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write usage ledger: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write usage ledger: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), l.path); err != nil {
+		return fmt.Errorf("failed to save usage ledger: %w", err)
+	}
+	return nil
+}
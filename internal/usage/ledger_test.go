@@ -0,0 +1,48 @@
+package usage
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestLedgersSharingAFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "usage.json")
+	first, err := OpenLedger(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := OpenLedger(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Two server processes recording at once, each with its own ledger
+	var wg sync.WaitGroup
+	for _, ledger := range []*Ledger{first, second} {
+		for range 20 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if err := ledger.Record(Usage{Requests: 1, InputTokens: 100, Cost: 0.5}); err != nil {
+					t.Error(err)
+				}
+			}()
+		}
+	}
+	wg.Wait()
+
+	for name, ledger := range map[string]*Ledger{"first": first, "second": second} {
+		if today := ledger.Today(); today.Requests != 40 || today.InputTokens != 4000 || today.Cost != 20 {
+			t.Errorf("%s ledger: today = %+v, want all 40 requests", name, today)
+		}
+	}
+
+	reopened, err := OpenLedger(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if today := reopened.Today(); today.Requests != 40 {
+		t.Errorf("after reopening: today = %+v, want all 40 requests", today)
+	}
+}
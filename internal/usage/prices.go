@@ -0,0 +1,95 @@
+package usage
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Price is what a model costs in USD per million tokens
+type Price struct {
+	Input       float64 `json:"input"`
+	CachedInput float64 `json:"cached_input"`
+	CacheWrite  float64 `json:"cache_write,omitempty"` // Input written to the prompt cache; zero bills it as input
+	Output      float64 `json:"output"`                // Reasoning tokens are billed as output
+}
+
+// Cost returns the price of u's tokens
+func (p Price) Cost(u Usage) float64 {
+	cacheWrite := cmp.Or(p.CacheWrite, p.Input)
+	uncached := u.InputTokens - u.CachedInputTokens - u.CacheWriteTokens
+	return (float64(uncached)*p.Input + float64(u.CachedInputTokens)*p.CachedInput +
+		float64(u.CacheWriteTokens)*cacheWrite + float64(u.OutputTokens)*p.Output) / 1e6
+}
+
+// PriceTable maps model names to prices
+type PriceTable map[string]Price
+
+// DefaultPrices returns the list prices of the models this server is
+// commonly used with. Override or extend them with LoadPrices.
+func DefaultPrices() PriceTable {
+	return PriceTable{
+		"gpt-5-pro":  {Input: 15, CachedInput: 15, Output: 120},
+		"gpt-5":      {Input: 1.25, CachedInput: 0.125, Output: 10},
+		"gpt-5-mini": {Input: 0.25, CachedInput: 0.025, Output: 2},
+		"gpt-5-nano": {Input: 0.05, CachedInput: 0.005, Output: 0.4},
+		"o3-pro":     {Input: 20, CachedInput: 20, Output: 80},
+		"o3":         {Input: 2, CachedInput: 0.5, Output: 8},
+
+		"claude-opus-4-1":   {Input: 15, CachedInput: 1.5, CacheWrite: 18.75, Output: 75},
+		"claude-sonnet-4-5": {Input: 3, CachedInput: 0.3, CacheWrite: 3.75, Output: 15},
+		"claude-haiku-4-5":  {Input: 1, CachedInput: 0.1, CacheWrite: 1.25, Output: 5},
+
+		"gemini-2.5-pro":   {Input: 1.25, CachedInput: 0.31, Output: 10},
+		"gemini-2.5-flash": {Input: 0.3, CachedInput: 0.075, Output: 2.5},
+	}
+}
+
+// LoadPrices returns the default prices overlaid with those in the JSON file
+// at path, which maps model names to {"input", "cached_input", "output"}
+// and optionally "cache_write".
+// An empty path returns the defaults.
+func LoadPrices(path string) (PriceTable, error) {
+	prices := DefaultPrices()
+	if path == "" {
+		return prices, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read price table: %w", err)
+	}
+	var overrides PriceTable
+	if err := json.Unmarshal(data, &overrides); err != nil {
+		return nil, fmt.Errorf("failed to parse price table %s: %w", path, err)
+	}
+	for model, price := range overrides {
+		prices[model] = price
+	}
+	return prices, nil
+}
+
+// Lookup finds the price for model. Provider prefixes such as "openai/" and
+// dated snapshots such as "gpt-5-pro-2025-10-06" match their base model.
+func (t PriceTable) Lookup(model string) (Price, bool) {
+	if _, name, ok := strings.Cut(model, "/"); ok {
+		model = name
+	}
+	if price, ok := t[model]; ok {
+		return price, true
+	}
+
+	// Longest prefix wins, so gpt-5-pro-... doesn't match gpt-5
+	best := ""
+	for name := range t {
+		if strings.HasPrefix(model, name+"-") && len(name) > len(best) {
+			best = name
+		}
+	}
+	if best == "" {
+		return Price{}, false
+	}
+	return t[best], true
+}
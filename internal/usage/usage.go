@@ -0,0 +1,84 @@
+package usage
+
+import (
+	"fmt"
+	"log"
+)
+
+// Usage is the token consumption and cost of one or more API round-trips
+type Usage struct {
+	Requests          int     `json:"requests"`            // API round-trips
+	InputTokens       int64   `json:"input_tokens"`        // Including cached input tokens
+	CachedInputTokens int64   `json:"cached_input_tokens"` // Input tokens served from the prompt cache
+	CacheWriteTokens  int64   `json:"cache_write_tokens"`  // Input tokens written to the prompt cache
+	OutputTokens      int64   `json:"output_tokens"`       // Including reasoning tokens
+	ReasoningTokens   int64   `json:"reasoning_tokens"`    // Output tokens spent on hidden reasoning
+	Cost              float64 `json:"cost_usd"`            // Zero for models missing from the price table
+}
+
+// Add accumulates other into u
+func (u *Usage) Add(other Usage) {
+	u.Requests += other.Requests
+	u.InputTokens += other.InputTokens
+	u.CachedInputTokens += other.CachedInputTokens
+	u.CacheWriteTokens += other.CacheWriteTokens
+	u.OutputTokens += other.OutputTokens
+	u.ReasoningTokens += other.ReasoningTokens
+	u.Cost += other.Cost
+}
+
+// String formats the token counts and cost on one line
+func (u Usage) String() string {
+	cached := fmt.Sprintf("%d cached", u.CachedInputTokens)
+	if u.CacheWriteTokens > 0 {
+		cached += fmt.Sprintf(", %d written to cache", u.CacheWriteTokens)
+	}
+	return fmt.Sprintf("%d in (%s), %d out (%d reasoning), $%.4f",
+		u.InputTokens, cached, u.OutputTokens, u.ReasoningTokens, u.Cost)
+}
+
+// Meter prices API round-trips, records them in the daily ledger and
+// enforces spending budgets
+type Meter struct {
+	prices  PriceTable
+	ledger  *Ledger
+	budgets Budgets
+}
+
+// NewMeter creates a meter. ledger may be nil to skip daily accounting.
+func NewMeter(prices PriceTable, ledger *Ledger, budgets Budgets) *Meter {
+	return &Meter{prices: prices, ledger: ledger, budgets: budgets}
+}
+
+// Charge prices one round-trip's token counts for model, records it in the
+// ledger and returns it with the cost filled in
+func (m *Meter) Charge(model string, u Usage) Usage {
+	u.Requests = 1
+	if price, ok := m.prices.Lookup(model); ok {
+		u.Cost = price.Cost(u)
+	} else {
+		log.Printf("WARNING: No price for model %s, its cost is not counted", model)
+	}
+
+	log.Printf("Usage: model=%s %s", model, u)
+	if m.ledger != nil {
+		if err := m.ledger.Record(u); err != nil {
+			log.Printf("WARNING: Failed to record usage: %v", err)
+		}
+	}
+	return u
+}
+
+// Priced reports whether model has an entry in the price table
+func (m *Meter) Priced(model string) bool {
+	_, ok := m.prices.Lookup(model)
+	return ok
+}
+
+// Today returns the usage recorded so far today
+func (m *Meter) Today() Usage {
+	if m.ledger == nil {
+		return Usage{}
+	}
+	return m.ledger.Today()
+}
@@ -0,0 +1,109 @@
+package usage
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPriceCost(t *testing.T) {
+	tests := []struct {
+		name  string
+		price Price
+		usage Usage
+		want  float64
+	}{
+		{"uncached", Price{Input: 1.25, CachedInput: 0.125, Output: 10}, Usage{InputTokens: 1_000_000, OutputTokens: 100_000}, 2.25},
+		{"cached input at its own rate", Price{Input: 1.25, CachedInput: 0.125, Output: 10}, Usage{InputTokens: 1_000_000, CachedInputTokens: 800_000}, 0.35},
+		{"reasoning is part of output", Price{Input: 15, CachedInput: 15, Output: 120}, Usage{InputTokens: 1000, OutputTokens: 5000, ReasoningTokens: 4000}, 0.615},
+		{"nothing used", Price{Input: 15, Output: 120}, Usage{}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.price.Cost(tt.usage); math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("Cost() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLookup(t *testing.T) {
+	prices := DefaultPrices()
+	tests := []struct {
+		model string
+		want  string // key of the expected price, empty when unpriced
+	}{
+		{"gpt-5", "gpt-5"},
+		{"gpt-5-pro", "gpt-5-pro"},
+		{"gpt-5-pro-2025-10-06", "gpt-5-pro"},
+		{"gpt-5-mini-2025-08-07", "gpt-5-mini"},
+		{"openai/gpt-5-pro", "gpt-5-pro"},
+		{"gpt-5x", ""},
+		{"my-deployment", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.model, func(t *testing.T) {
+			price, ok := prices.Lookup(tt.model)
+			if ok != (tt.want != "") {
+				t.Fatalf("Lookup(%q) found = %t, want %t", tt.model, ok, tt.want != "")
+			}
+			if ok && price != prices[tt.want] {
+				t.Errorf("Lookup(%q) = %+v, want the price of %s", tt.model, price, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadPrices(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "prices.json")
+	if err := os.WriteFile(path, []byte(`{"gpt-5": {"input": 1, "cached_input": 0.5, "output": 2}, "my-model": {"input": 3, "output": 4}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	prices, err := LoadPrices(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := prices["gpt-5"]; got.Input != 1 || got.CachedInput != 0.5 || got.Output != 2 {
+		t.Errorf("gpt-5 = %+v, want the override", got)
+	}
+	if _, ok := prices.Lookup("my-model"); !ok {
+		t.Error("added model missing")
+	}
+	if _, ok := prices.Lookup("gpt-5-pro"); !ok {
+		t.Error("defaults dropped by the override")
+	}
+
+	if _, err := LoadPrices(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("missing price file accepted")
+	}
+}
+
+func TestMeterCharge(t *testing.T) {
+	ledger, err := OpenLedger(filepath.Join(t.TempDir(), "usage.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	meter := NewMeter(PriceTable{"gpt-5": {Input: 1.25, CachedInput: 0.125, Output: 10}}, ledger, Budgets{})
+
+	// A conversation adds up its round-trips, priced or not
+	var conversation Usage
+	conversation.Add(meter.Charge("gpt-5", Usage{InputTokens: 1_000_000, CachedInputTokens: 800_000, OutputTokens: 100_000}))
+	conversation.Add(meter.Charge("unknown-model", Usage{InputTokens: 500, OutputTokens: 50}))
+
+	want := Usage{Requests: 2, InputTokens: 1_000_500, CachedInputTokens: 800_000, OutputTokens: 100_050, Cost: 1.35}
+	if math.Abs(conversation.Cost-want.Cost) > 1e-9 {
+		t.Errorf("conversation cost = %v, want %v", conversation.Cost, want.Cost)
+	}
+	conversation.Cost = want.Cost
+	if conversation != want {
+		t.Errorf("conversation = %+v, want %+v", conversation, want)
+	}
+	if today := meter.Today(); today.Requests != 2 || math.Abs(today.Cost-want.Cost) > 1e-9 {
+		t.Errorf("today = %+v, want both requests", today)
+	}
+	if meter.Priced("unknown-model") {
+		t.Error("unknown model reported as priced")
+	}
+}
@@ -1,53 +1,79 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"log"
-	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"syscall"
 
 	"github.com/lox/gpt-5-pro-mcp/internal/client"
+	"github.com/lox/gpt-5-pro-mcp/internal/config"
+	"github.com/lox/gpt-5-pro-mcp/internal/conversation"
 	"github.com/lox/gpt-5-pro-mcp/internal/fileops"
 	"github.com/lox/gpt-5-pro-mcp/internal/server"
-	mcpserver "github.com/mark3labs/mcp-go/server"
+	"github.com/lox/gpt-5-pro-mcp/internal/usage"
 )
 
 func main() {
-	// Check for OPENAI_API_KEY first, fall back to OPENROUTER_API_KEY
-	apiKey := os.Getenv("OPENAI_API_KEY")
-	baseURL := ""
-	useResponsesAPI := true // Default to Responses API
-
-	if apiKey == "" {
-		// Fall back to OpenRouter configuration
-		apiKey = os.Getenv("OPENROUTER_API_KEY")
-		baseURL = os.Getenv("OPENROUTER_BASE_URL")
-
-		if apiKey == "" {
-			log.Fatal("Either OPENAI_API_KEY or OPENROUTER_API_KEY environment variable is required")
-		}
-
-		if baseURL == "" {
-			baseURL = "https://openrouter.ai/api/v1"
-		}
-
-		log.Printf("Using OpenRouter with Chat Completions API at: %s", baseURL)
-		useResponsesAPI = false // OpenRouter uses Chat Completions
-	} else {
-		// Check for custom OpenAI base URL (for aihubmix, etc.)
-		baseURL = os.Getenv("OPENAI_BASE_URL")
-		if baseURL != "" {
-			log.Printf("Using custom OpenAI-compatible API with base URL: %s", baseURL)
-			log.Printf("Custom base URL detected - using Chat Completions API (/v1/chat/completions)")
-			useResponsesAPI = false // Custom endpoints use Chat Completions
-		} else {
-			log.Printf("Using official OpenAI API with Responses API (/v1/responses)")
-		}
-	}
-
-	f := fileops.New()
-	c := client.New(apiKey, baseURL, f, useResponsesAPI)
-	s := server.New(c)
-
-	if err := mcpserver.ServeStdio(s); err != nil {
+	transportFlag := flag.String("transport", config.EnvOr("MCP_TRANSPORT", "stdio"), "MCP transport: stdio, sse or http")
+	addr := flag.String("addr", config.EnvOr("MCP_ADDR", "127.0.0.1:8080"), "Listen address for the sse and http transports")
+	flag.Parse()
+
+	transport, err := server.ParseTransport(*transportFlag)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	sandbox, err := fileops.NewSandbox(cfg.Roots, slices.Concat(fileops.DefaultDenyPatterns, cfg.Deny))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if transport != server.TransportStdio {
+		sandbox.ConfineClientRoots()
+	}
+	log.Printf("File access confined to: %v", sandbox.Roots(context.Background()))
+
+	f := fileops.New(sandbox, fileops.GrepLimits{
+		Workers:        int(cfg.GrepWorkers),
+		MaxMatches:     int(cfg.GrepMaxMatches),
+		MaxFileMatches: int(cfg.GrepMaxFileMatches),
+	})
+	backend, err := conversation.NewFileBackend(filepath.Join(cfg.StateDir, "conversations"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	conversations := conversation.NewStore(conversation.DefaultMaxEntries, conversation.DefaultTTL, backend)
+
+	prices, err := usage.LoadPrices(cfg.PriceFile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	ledger, err := usage.OpenLedger(filepath.Join(cfg.StateDir, "usage.json"))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	budgets := usage.Budgets{
+		Call:         usage.Limit{Cost: cfg.MaxCallCost, Tokens: cfg.MaxCallTokens},
+		Conversation: usage.Limit{Cost: cfg.MaxConversationCost, Tokens: cfg.MaxConversationTokens},
+		Day:          usage.Limit{Cost: cfg.MaxDailyCost, Tokens: cfg.MaxDailyTokens},
+	}
+
+	c := client.New(cfg, f, conversations, usage.NewMeter(prices, ledger, budgets))
+	s := server.New(c, c, c, conversations, sandbox)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	if err := server.Serve(ctx, s, transport, *addr); err != nil {
 		log.Fatal(err)
 	}
 }